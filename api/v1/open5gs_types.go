@@ -10,6 +10,21 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// PausedAnnotation pauses the Open5GS instance or the Open5GSUser it is set
+// on, like spec.paused, when its value is "true". On an Open5GS instance it
+// may instead list the network functions to freeze, e.g. "upf,smf".
+const PausedAnnotation = "open5gs/paused"
+
+// AdoptLabel marks a pre-existing resource as adoptable by the Open5GS
+// instance that generates a resource of the same name, when its adoption
+// policy is IfLabeled. Its value must be "true".
+const AdoptLabel = "open5gs/adopt"
+
+// ResourceConflictCondition is true while resources the instance generates
+// exist without being owned by it and cannot be adopted. They are left
+// untouched.
+const ResourceConflictCondition = "ResourceConflict"
+
 // Open5GSSpec defines the desired state of Open5GS
 type Open5GSSpec struct {
 	AMF            Open5GSFunction      `json:"amf,omitempty" default:"{\"enabled\":true,\"serviceAccount\":false,\"metrics\":true,\"serviceMonitor\":false}"`
@@ -29,8 +44,76 @@ type Open5GSSpec struct {
 	Open5GSImage   string               `json:"open5gsImage,omitempty" default:"docker.io/gradiant/open5gs:2.7.5"`
 	MongoDBVersion string               `json:"mongoDBVersion,omitempty" default:"bitnami/mongodb:latest"`
 	Configuration  Open5GSConfiguration `json:"configuration,omitempty" default:"{\"mcc\":\"999\",\"mnc\":\"70\",\"region\":\"2\",\"set\":\"1\",\"tac\":\"0001\",\"slices\":[]}"`
+	// AllowedUserNamespaces lists the namespaces, besides the one of this
+	// instance, whose Open5GSUsers and Open5GSUserPools may reference it.
+	// "*" allows every namespace.
+	AllowedUserNamespaces []string `json:"allowedUserNamespaces,omitempty"`
+	// SubscriberPolicy tells what to do with the subscribers in MongoDB that no
+	// Open5GSUser or Open5GSUserPool manages: Ignore them, Report them in the
+	// status or Prune them
+	//+kubebuilder:validation:Enum=Ignore;Report;Prune
+	SubscriberPolicy string `json:"subscriberPolicy,omitempty" default:"Ignore"`
+	// Upgrade configures how a change of open5gsImage is rolled out to the
+	// network functions
+	Upgrade Open5GSUpgradeStrategy `json:"upgrade,omitempty"`
+	// Paused suspends every change to the resources of the instance, e.g. to
+	// edit a ConfigMap by hand while debugging. The status is still reported
+	// and upgrades wait until the instance is resumed.
+	Paused bool `json:"paused,omitempty"`
+	// AdoptionPolicy tells whether existing resources with the name of a
+	// generated resource, but not owned by the instance, are taken over:
+	// Never, IfLabeled with the open5gs/adopt=true label, or Always.
+	// Resources controlled by another owner are never adopted.
+	//+kubebuilder:validation:Enum=Never;IfLabeled;Always
+	AdoptionPolicy string `json:"adoptionPolicy,omitempty" default:"Never"`
+}
+
+// Open5GSUpgradeStrategy configures the upgrades of the Open5GS image. The
+// network functions are moved to the new image one at a time, NRF and SCP
+// first and UPF last, each once the previous one is available and healthy.
+type Open5GSUpgradeStrategy struct {
+	// HealthChecks run on each function once its Deployment is available:
+	// SBI checks that its SBI Service accepts connections, NRFRegistration
+	// that it is registered in the NRF
+	HealthChecks []Open5GSHealthCheck `json:"healthChecks,omitempty"`
+	// FunctionTimeoutSeconds is how long a function may take to become
+	// available and healthy before the upgrade fails
+	//+kubebuilder:validation:Minimum=1
+	FunctionTimeoutSeconds *int32 `json:"functionTimeoutSeconds,omitempty" default:"300"`
+	// OnFailure tells what to do when a function fails: Pause the upgrade
+	// where it is, or Rollback every function to the previous image
+	//+kubebuilder:validation:Enum=Pause;Rollback
+	OnFailure string `json:"onFailure,omitempty" default:"Pause"`
 }
 
+//+kubebuilder:validation:Enum=SBI;NRFRegistration
+
+// Open5GSHealthCheck is a check that an upgraded function must pass before
+// the upgrade moves on to the next one
+type Open5GSHealthCheck string
+
+const (
+	HealthCheckSBI             Open5GSHealthCheck = "SBI"
+	HealthCheckNRFRegistration Open5GSHealthCheck = "NRFRegistration"
+)
+
+const (
+	UpgradeOnFailurePause    = "Pause"
+	UpgradeOnFailureRollback = "Rollback"
+)
+
+const (
+	AdoptionPolicyNever     = "Never"
+	AdoptionPolicyIfLabeled = "IfLabeled"
+	AdoptionPolicyAlways    = "Always"
+)
+
+const (
+	SubscriberPolicyIgnore = "Ignore"
+	SubscriberPolicyReport = "Report"
+	SubscriberPolicyPrune  = "Prune"
+)
+
 type Open5GSConfiguration struct {
 	MCC    string         `json:"mcc,omitempty" default:"999"`
 	MNC    string         `json:"mnc,omitempty" default:"70"`
@@ -55,6 +138,8 @@ type Open5GSFunction struct {
 	DeploymentAnnotations map[string]string `json:"deploymentAnnotations,omitempty"`
 	// Unprivileged runs the UPF without privileged:true/root (UPF only).
 	Unprivileged *bool `json:"unprivileged,omitempty" default:"false"`
+	// Paused freezes the resources of this function only
+	Paused bool `json:"paused,omitempty"`
 }
 
 type Open5GSService struct {
@@ -66,11 +151,117 @@ type Open5GSService struct {
 type Open5GSStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	// Ready tells whether every enabled network function is available
 	Ready bool `json:"ready"`
+	// Paused tells whether changes to the resources of the instance are
+	// suspended
+	Paused bool `json:"paused,omitempty"`
+	// Functions reports the startup progress of the enabled network functions
+	Functions []Open5GSFunctionStatus `json:"functions,omitempty"`
+	// Subscribers is the result of the last scan for unmanaged subscribers.
+	// It is only set when the subscriber policy is Report or Prune.
+	Subscribers *Open5GSSubscribersStatus `json:"subscribers,omitempty"`
+	// Open5GSImage is the Open5GS image the network functions run outside of
+	// an upgrade
+	Open5GSImage string `json:"open5gsImage,omitempty"`
+	// Upgrade is the state of the last upgrade of the Open5GS image
+	Upgrade *Open5GSUpgradeStatus `json:"upgrade,omitempty"`
+	// ApplyConflicts lists the generated resources with fields that another
+	// field manager had changed and that the last reconciliation took back
+	ApplyConflicts []Open5GSApplyConflict `json:"applyConflicts,omitempty"`
+	// ResourceConflicts lists the existing resources with the name of a
+	// generated resource that the instance does not own and may not adopt
+	ResourceConflicts []Open5GSResourceConflict `json:"resourceConflicts,omitempty"`
+	// Conditions of the instance
+	//+listType=map
+	//+listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Open5GSFunctionStatus is the state of a network function. A function is
+// only created once the functions it depends on are available.
+type Open5GSFunctionStatus struct {
+	Name string `json:"name"`
+	// Phase is Waiting while the functions it depends on are not available,
+	// then Progressing until its Deployment is available, then Available
+	//+kubebuilder:validation:Enum=Waiting;Progressing;Available
+	Phase string `json:"phase"`
+	// WaitingFor lists the functions it is waiting for
+	WaitingFor []string `json:"waitingFor,omitempty"`
+	// Paused tells whether the resources of the function are frozen
+	Paused bool `json:"paused,omitempty"`
+}
+
+const (
+	FunctionPhaseWaiting     = "Waiting"
+	FunctionPhaseProgressing = "Progressing"
+	FunctionPhaseAvailable   = "Available"
+)
+
+// Open5GSUpgradeStatus is the state of an upgrade of the Open5GS image
+type Open5GSUpgradeStatus struct {
+	FromImage string `json:"fromImage"`
+	ToImage   string `json:"toImage"`
+	// Phase is Progressing while the functions are moved to the new image,
+	// then Completed. A failed upgrade is Paused, with the functions already
+	// upgraded left on the new image, or RolledBack to the previous image.
+	//+kubebuilder:validation:Enum=Progressing;Paused;RolledBack;Completed
+	Phase string `json:"phase"`
+	// Function is the function being upgraded
+	Function string `json:"function,omitempty"`
+	// UpgradedFunctions run the new image and passed their health checks
+	UpgradedFunctions []string `json:"upgradedFunctions,omitempty"`
+	// FunctionStartTime is when the upgrade of the function started
+	FunctionStartTime *metav1.Time `json:"functionStartTime,omitempty"`
+	// Message tells why the upgrade is waiting or failed
+	Message string `json:"message,omitempty"`
+}
+
+const (
+	UpgradePhaseProgressing = "Progressing"
+	UpgradePhasePaused      = "Paused"
+	UpgradePhaseRolledBack  = "RolledBack"
+	UpgradePhaseCompleted   = "Completed"
+)
+
+// Open5GSApplyConflict describes a server-side apply conflict on a generated
+// resource
+type Open5GSApplyConflict struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Message names the conflicting fields and their managers
+	Message string `json:"message"`
+}
+
+// Open5GSResourceConflict describes an existing resource that blocks a
+// generated one
+type Open5GSResourceConflict struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Reason tells why the resource was not adopted
+	Reason string `json:"reason"`
+}
+
+// Open5GSSubscribersStatus counts the subscribers stored in MongoDB
+type Open5GSSubscribersStatus struct {
+	// Managed is the number of subscribers with an Open5GSUser or Open5GSUserPool
+	Managed int32 `json:"managed"`
+	// Unmanaged is the number of subscribers left without one after the scan
+	Unmanaged int32 `json:"unmanaged"`
+	// Retained is the number of subscribers without one that were kept by the
+	// Retain or Orphan deletion policy of their Open5GSUser. They are never pruned.
+	Retained int32 `json:"retained,omitempty"`
+	// UnmanagedIMSIs lists the first unmanaged IMSIs
+	UnmanagedIMSIs []string `json:"unmanagedIMSIs,omitempty"`
+	// Pruned is the number of unmanaged subscribers deleted by the last scan
+	Pruned int32 `json:"pruned,omitempty"`
+	// LastScanTime is the time of the last scan that changed this report
+	LastScanTime *metav1.Time `json:"lastScanTime,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Ready",type=boolean,JSONPath=`.status.ready`
 
 // Open5GS is the Schema for the open5gs API
 type Open5GS struct {
@@ -0,0 +1,70 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Open5GSSubscriberProfileSpec defines the desired state of
+// Open5GSSubscriberProfile. Its fields have the meaning of the Open5GSUser
+// fields of the same name.
+type Open5GSSubscriberProfileSpec struct {
+	SD  string `json:"sd,omitempty"`
+	SST string `json:"sst,omitempty"`
+	APN string `json:"apn,omitempty"`
+	// QoS of the default session (5QI and ARP)
+	QoS Open5GSUserQoS `json:"qos,omitempty"`
+	// SessionAMBR is the aggregate maximum bit rate of the default session
+	SessionAMBR Open5GSUserAMBR `json:"sessionAmbr,omitempty"`
+	// UEAMBR is the aggregate maximum bit rate of the subscriber
+	UEAMBR Open5GSUserAMBR `json:"ueAmbr,omitempty"`
+	// PDUSessionType of the default session
+	//+kubebuilder:validation:Enum=IPv4;IPv6;IPv4v6
+	PDUSessionType string `json:"pduSessionType,omitempty"`
+}
+
+// Open5GSSubscriberProfileStatus defines the observed state of
+// Open5GSSubscriberProfile
+type Open5GSSubscriberProfileStatus struct {
+	// ObservedGeneration is the generation of the profile the counts refer to
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Users is the number of Open5GSUsers referencing the profile
+	Users int32 `json:"users"`
+	// UpdatedUsers is the number of those whose subscriber has been written
+	// with the current generation of the profile
+	UpdatedUsers int32 `json:"updatedUsers"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Users",type=integer,JSONPath=`.status.users`
+//+kubebuilder:printcolumn:name="Updated",type=integer,JSONPath=`.status.updatedUsers`
+
+// Open5GSSubscriberProfile is the Schema for the open5gssubscriberprofiles
+// API. It holds slice, session, AMBR and QoS settings shared by the
+// Open5GSUsers that reference it.
+type Open5GSSubscriberProfile struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   Open5GSSubscriberProfileSpec   `json:"spec,omitempty"`
+	Status Open5GSSubscriberProfileStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// Open5GSSubscriberProfileList contains a list of Open5GSSubscriberProfile
+type Open5GSSubscriberProfileList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Open5GSSubscriberProfile `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Open5GSSubscriberProfile{}, &Open5GSSubscriberProfileList{})
+}
@@ -7,12 +7,44 @@
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+// SQNAnnotation sets the authentication sequence number of the subscriber to
+// its value (decimal or 0x-prefixed hexadecimal, "reset" for 0). The operator
+// removes the annotation once the SQN has been written.
+const SQNAnnotation = "open5gs/sqn"
+
+// IMSIConflictCondition is set on an Open5GSUser whose IMSI is already managed
+// by an older Open5GSUser of the same Open5GS instance. Its subscriber is not
+// written while the condition is true.
+const IMSIConflictCondition = "IMSIConflict"
+
+// AddressConflictCondition is set on an Open5GSUser whose static UE address is
+// already assigned to an older Open5GSUser of the same Open5GS instance. Its
+// subscriber is not written while the condition is true.
+const AddressConflictCondition = "AddressConflict"
+
+// PausedCondition is set on an Open5GSUser paused with spec.paused or the
+// paused annotation. Its subscriber is not written while it is paused.
+const PausedCondition = "Paused"
+
+// ReferenceNotAllowedCondition is set on an Open5GSUser, Open5GSUserPool or
+// Open5GSUserImport that references an Open5GS instance of another namespace
+// without being allowed to. Its subscribers are not written while the
+// condition is true, and an import completes without importing any.
+const ReferenceNotAllowedCondition = "ReferenceNotAllowed"
+
+const (
+	DeletionPolicyDelete = "Delete"
+	DeletionPolicyOrphan = "Orphan"
+	DeletionPolicyRetain = "Retain"
+)
+
 // Open5GSReference defines the reference to an Open5GS instance
 type Open5GSReference struct {
 	Name      string `json:"name,omitempty" default:"open5gs"`
@@ -21,19 +53,124 @@ type Open5GSReference struct {
 
 // Open5GSUserSpec defines the desired state of Open5GSUser
 type Open5GSUserSpec struct {
-	IMSI    string           `json:"imsi,omitempty" default:"999700000000001"`
-	Key     string           `json:"key,omitempty" default:"465B5CE8B199B49FAA5F0A2EE238A6BC"`
-	OPC     string           `json:"opc,omitempty" default:"E8ED289DEBA952E4283B54E88E6183CA"`
+	IMSI string `json:"imsi,omitempty" default:"999700000000001"`
+	Key  string `json:"key,omitempty" default:"465B5CE8B199B49FAA5F0A2EE238A6BC"`
+	OPC  string `json:"opc,omitempty" default:"E8ED289DEBA952E4283B54E88E6183CA"`
+	// KeysSecretRef names a Secret holding the "k" and "opc" (or "op") of the
+	// SIM. Its entries take precedence over the key, opc and op fields.
+	KeysSecretRef *corev1.LocalObjectReference `json:"keysSecretRef,omitempty"`
+	// ProfileRef names an Open5GSSubscriberProfile of the user namespace. Its
+	// settings apply to the sd, sst, apn, qos, sessionAmbr, ueAmbr and
+	// pduSessionType fields left empty here.
+	ProfileRef *corev1.LocalObjectReference `json:"profileRef,omitempty"`
+	// OP is the operator variant algorithm configuration field, used instead
+	// of OPC when OPType is OP
+	OP string `json:"op,omitempty"`
+	// OPType selects whether the SIM is provisioned with OP or OPc
+	//+kubebuilder:validation:Enum=OP;OPc
+	OPType string `json:"opType,omitempty" default:"OPc"`
+	// AMF is the authentication management field, as 4 hexadecimal digits
+	//+kubebuilder:validation:Pattern=`^[0-9A-Fa-f]{4}$`
+	AMF     string           `json:"amf,omitempty" default:"8000"`
 	SD      string           `json:"sd,omitempty" default:"0x111111"`
 	SST     string           `json:"sst,omitempty" default:"1"`
 	APN     string           `json:"apn,omitempty" default:"internet"`
 	Open5GS Open5GSReference `json:"open5gs,omitempty" default:"{\"name\":\"open5gs\",\"namespace\":\"default\"}"`
+	// QoS of the default session (5QI and ARP)
+	QoS Open5GSUserQoS `json:"qos,omitempty"`
+	// SessionAMBR is the aggregate maximum bit rate of the default session
+	SessionAMBR Open5GSUserAMBR `json:"sessionAmbr,omitempty" default:"{\"downlink\":\"1 Gbps\",\"uplink\":\"1 Gbps\"}"`
+	// UEAMBR is the aggregate maximum bit rate of the subscriber
+	UEAMBR Open5GSUserAMBR `json:"ueAmbr,omitempty" default:"{\"downlink\":\"1 Gbps\",\"uplink\":\"1 Gbps\"}"`
+	// PDUSessionType of the default session
+	//+kubebuilder:validation:Enum=IPv4;IPv6;IPv4v6
+	PDUSessionType string `json:"pduSessionType,omitempty" default:"IPv4v6"`
+	// MSISDN numbers of the subscriber
+	//+kubebuilder:validation:items:Pattern=`^[0-9]{1,15}$`
+	MSISDN []string `json:"msisdn,omitempty"`
+	// IMEISV of the subscriber's device
+	//+kubebuilder:validation:Pattern=`^[0-9]{16}$`
+	IMEISV string `json:"imeisv,omitempty"`
+	// UE holds the static addresses of the default session. They must belong
+	// to the UE pools of the Open5GS instance and be unique among its users.
+	UE Open5GSUserUE `json:"ue,omitempty"`
+	// SubscriberStatus suspends the subscriber when set to OperatorDeterminedBarring
+	//+kubebuilder:validation:Enum=ServiceGranted;OperatorDeterminedBarring
+	SubscriberStatus string `json:"subscriberStatus,omitempty" default:"ServiceGranted"`
+	// OperatorDeterminedBarring is the barring category applied while the
+	// subscriber status is OperatorDeterminedBarring
+	//+kubebuilder:validation:Minimum=0
+	//+kubebuilder:validation:Maximum=8
+	OperatorDeterminedBarring *int32 `json:"operatorDeterminedBarring,omitempty" default:"0"`
+	// NetworkAccessMode of the subscriber
+	//+kubebuilder:validation:Enum=PacketAndCircuit;OnlyPacket
+	NetworkAccessMode string `json:"networkAccessMode,omitempty" default:"PacketAndCircuit"`
+	// AccessRestrictionData is the access restriction bitmask of the subscriber
+	//+kubebuilder:validation:Minimum=0
+	//+kubebuilder:validation:Maximum=255
+	AccessRestrictionData *int32 `json:"accessRestrictionData,omitempty" default:"32"`
+	// DeletionPolicy decides what happens to the subscriber when the user is
+	// deleted: Delete removes it from MongoDB, Orphan leaves it untouched and
+	// Retain keeps it with all packet services barred
+	//+kubebuilder:validation:Enum=Delete;Orphan;Retain
+	DeletionPolicy string `json:"deletionPolicy,omitempty" default:"Delete"`
+	// Paused suspends the writes of the subscriber to MongoDB, including the
+	// drift repairs. Deleting a paused user still applies its deletion policy.
+	Paused bool `json:"paused,omitempty"`
+}
+
+// Open5GSUserUE defines the static addresses assigned to a subscriber session
+type Open5GSUserUE struct {
+	IPv4 string `json:"ipv4,omitempty"`
+	IPv6 string `json:"ipv6,omitempty"`
+}
+
+// Open5GSUserQoS defines the QoS profile of a subscriber session
+type Open5GSUserQoS struct {
+	// Index is the 5QI of the session
+	//+kubebuilder:validation:Minimum=1
+	//+kubebuilder:validation:Maximum=255
+	Index *int32         `json:"index,omitempty" default:"9"`
+	ARP   Open5GSUserARP `json:"arp,omitempty"`
+}
+
+// Open5GSUserARP defines the Allocation and Retention Priority of a session
+type Open5GSUserARP struct {
+	//+kubebuilder:validation:Minimum=1
+	//+kubebuilder:validation:Maximum=15
+	PriorityLevel *int32 `json:"priorityLevel,omitempty" default:"8"`
+	//+kubebuilder:validation:Enum=Disabled;Enabled
+	PreEmptionCapability string `json:"preEmptionCapability,omitempty" default:"Disabled"`
+	//+kubebuilder:validation:Enum=Disabled;Enabled
+	PreEmptionVulnerability string `json:"preEmptionVulnerability,omitempty" default:"Enabled"`
+}
+
+// Open5GSUserAMBR defines an aggregate maximum bit rate, e.g. "1 Gbps" or "512 Kbps"
+type Open5GSUserAMBR struct {
+	//+kubebuilder:validation:Pattern=`^[0-9]+ ?(bps|Kbps|Mbps|Gbps|Tbps)?$`
+	Downlink string `json:"downlink,omitempty" default:"1 Gbps"`
+	//+kubebuilder:validation:Pattern=`^[0-9]+ ?(bps|Kbps|Mbps|Gbps|Tbps)?$`
+	Uplink string `json:"uplink,omitempty" default:"1 Gbps"`
 }
 
 // Open5GSUserStatus defines the observed state of Open5GSUser
 type Open5GSUserStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// DriftedFields lists the subscriber fields that were found out of sync
+	// with the spec in MongoDB, e.g. after an edit from the WebUI, and repaired
+	// by the last drift check that found any
+	DriftedFields []string `json:"driftedFields,omitempty"`
+	// LastDriftRepair is the time of that repair
+	LastDriftRepair *metav1.Time `json:"lastDriftRepair,omitempty"`
+	// IMSI is the IMSI of the subscriber written to MongoDB for this user. The
+	// subscriber is moved to the new IMSI when spec.imsi changes.
+	IMSI string `json:"imsi,omitempty"`
+	// ProfileGeneration is the generation of the subscriber profile the
+	// subscriber was last written with
+	ProfileGeneration int64 `json:"profileGeneration,omitempty"`
+	// Conditions of the user
+	//+listType=map
+	//+listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
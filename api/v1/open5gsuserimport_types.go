@@ -0,0 +1,70 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Open5GSUserImportSpec defines the desired state of Open5GSUserImport
+type Open5GSUserImportSpec struct {
+	// Open5GS is the instance whose MongoDB subscribers are imported
+	Open5GS Open5GSReference `json:"open5gs"`
+	// NamePrefix is prepended to the "imsi-<imsi>" name of every Open5GSUser
+	// created by the import
+	NamePrefix string `json:"namePrefix,omitempty"`
+}
+
+// Open5GSUserImportStatus defines the observed state of Open5GSUserImport
+type Open5GSUserImportStatus struct {
+	// CompletionTime is set once the import has run. An import runs only once.
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Imported is the number of Open5GSUsers created
+	Imported int32 `json:"imported"`
+	// Skipped is the number of subscribers already managed by an Open5GSUser
+	Skipped int32 `json:"skipped"`
+	// Failed is the number of subscribers that could not be imported
+	Failed int32 `json:"failed"`
+	// Errors describes why subscribers could not be imported
+	Errors []string `json:"errors,omitempty"`
+	// Conditions of the import
+	//+listType=map
+	//+listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Imported",type=integer,JSONPath=`.status.imported`
+//+kubebuilder:printcolumn:name="Skipped",type=integer,JSONPath=`.status.skipped`
+//+kubebuilder:printcolumn:name="Failed",type=integer,JSONPath=`.status.failed`
+//+kubebuilder:printcolumn:name="Completed",type=date,JSONPath=`.status.completionTime`
+
+// Open5GSUserImport is the Schema for the open5gsuserimports API. It creates
+// an Open5GSUser, with its keys in a Secret, for every subscriber found in the
+// MongoDB of an Open5GS instance, so that the operator takes over their
+// management.
+type Open5GSUserImport struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   Open5GSUserImportSpec   `json:"spec,omitempty"`
+	Status Open5GSUserImportStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// Open5GSUserImportList contains a list of Open5GSUserImport
+type Open5GSUserImportList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Open5GSUserImport `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Open5GSUserImport{}, &Open5GSUserImportList{})
+}
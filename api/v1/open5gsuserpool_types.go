@@ -0,0 +1,92 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Open5GSUserPoolSpec defines the desired state of Open5GSUserPool
+type Open5GSUserPoolSpec struct {
+	// IMSIStart is the first IMSI of the pool
+	//+kubebuilder:validation:Pattern=`^[0-9]{6,15}$`
+	IMSIStart string `json:"imsiStart"`
+	// Count is the number of consecutive IMSIs provisioned from IMSIStart
+	//+kubebuilder:validation:Minimum=0
+	//+kubebuilder:validation:Maximum=100000
+	Count int32 `json:"count"`
+	// Keys is the source of the key material of every IMSI
+	Keys Open5GSUserPoolKeys `json:"keys"`
+	// Template holds the subscriber settings shared by every IMSI of the pool.
+	// Its imsi, key, opc, op, keysSecretRef, profileRef, ue, deletionPolicy,
+	// paused and open5gs fields are ignored.
+	Template Open5GSUserSpec `json:"template,omitempty"`
+	// Open5GS is the instance the subscribers are provisioned in
+	Open5GS Open5GSReference `json:"open5gs,omitempty" default:"{\"name\":\"open5gs\",\"namespace\":\"default\"}"`
+}
+
+// Open5GSUserPoolKeys defines where the K and OPc (or OP) of each IMSI are read
+// from. Exactly one of SecretRef and ConfigMapRef must be set.
+type Open5GSUserPoolKeys struct {
+	// SecretRef names a Secret holding the "<imsi>.k" and "<imsi>.opc"
+	// (or "<imsi>.op") keys of every IMSI
+	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty"`
+	// ConfigMapRef selects a CSV file in a ConfigMap with one "imsi,k,opc"
+	// (or "imsi,k,op") row per IMSI
+	ConfigMapRef *corev1.ConfigMapKeySelector `json:"configMapRef,omitempty"`
+}
+
+// Open5GSUserPoolStatus defines the observed state of Open5GSUserPool
+type Open5GSUserPoolStatus struct {
+	// IMSIStart and Count describe the range currently provisioned in MongoDB
+	IMSIStart string `json:"imsiStart,omitempty"`
+	Count     int32  `json:"count,omitempty"`
+	// Provisioned is the number of subscribers of the pool present in MongoDB
+	Provisioned int32 `json:"provisioned"`
+	// Created, Updated and Deleted count the subscribers written by the last
+	// reconciliation
+	Created int32 `json:"created"`
+	Updated int32 `json:"updated"`
+	Deleted int32 `json:"deleted"`
+	// MissingKeys is the number of IMSIs without key material
+	MissingKeys int32 `json:"missingKeys"`
+	// Conflicts is the number of IMSIs skipped because an Open5GSUser manages them
+	Conflicts int32 `json:"conflicts"`
+	// Conditions of the pool
+	//+listType=map
+	//+listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Start",type=string,JSONPath=`.spec.imsiStart`
+//+kubebuilder:printcolumn:name="Count",type=integer,JSONPath=`.spec.count`
+//+kubebuilder:printcolumn:name="Provisioned",type=integer,JSONPath=`.status.provisioned`
+
+// Open5GSUserPool is the Schema for the open5gsuserpools API
+type Open5GSUserPool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   Open5GSUserPoolSpec   `json:"spec,omitempty"`
+	Status Open5GSUserPoolStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// Open5GSUserPoolList contains a list of Open5GSUserPool
+type Open5GSUserPoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Open5GSUserPool `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Open5GSUserPool{}, &Open5GSUserPoolList{})
+}
@@ -11,6 +11,8 @@
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -20,7 +22,7 @@ func (in *Open5GS) DeepCopyInto(out *Open5GS) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GS.
@@ -41,6 +43,21 @@ func (in *Open5GS) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Open5GSApplyConflict) DeepCopyInto(out *Open5GSApplyConflict) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSApplyConflict.
+func (in *Open5GSApplyConflict) DeepCopy() *Open5GSApplyConflict {
+	if in == nil {
+		return nil
+	}
+	out := new(Open5GSApplyConflict)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Open5GSConfiguration) DeepCopyInto(out *Open5GSConfiguration) {
 	*out = *in
@@ -113,6 +130,26 @@ func (in *Open5GSFunction) DeepCopy() *Open5GSFunction {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Open5GSFunctionStatus) DeepCopyInto(out *Open5GSFunctionStatus) {
+	*out = *in
+	if in.WaitingFor != nil {
+		in, out := &in.WaitingFor, &out.WaitingFor
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSFunctionStatus.
+func (in *Open5GSFunctionStatus) DeepCopy() *Open5GSFunctionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(Open5GSFunctionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Open5GSList) DeepCopyInto(out *Open5GSList) {
 	*out = *in
@@ -160,6 +197,21 @@ func (in *Open5GSReference) DeepCopy() *Open5GSReference {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Open5GSResourceConflict) DeepCopyInto(out *Open5GSResourceConflict) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSResourceConflict.
+func (in *Open5GSResourceConflict) DeepCopy() *Open5GSResourceConflict {
+	if in == nil {
+		return nil
+	}
+	out := new(Open5GSResourceConflict)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Open5GSService) DeepCopyInto(out *Open5GSService) {
 	*out = *in
@@ -207,6 +259,12 @@ func (in *Open5GSSpec) DeepCopyInto(out *Open5GSSpec) {
 	in.UPF.DeepCopyInto(&out.UPF)
 	in.WebUI.DeepCopyInto(&out.WebUI)
 	in.Configuration.DeepCopyInto(&out.Configuration)
+	if in.AllowedUserNamespaces != nil {
+		in, out := &in.AllowedUserNamespaces, &out.AllowedUserNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.Upgrade.DeepCopyInto(&out.Upgrade)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSSpec.
@@ -222,6 +280,40 @@ func (in *Open5GSSpec) DeepCopy() *Open5GSSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Open5GSStatus) DeepCopyInto(out *Open5GSStatus) {
 	*out = *in
+	if in.Functions != nil {
+		in, out := &in.Functions, &out.Functions
+		*out = make([]Open5GSFunctionStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Subscribers != nil {
+		in, out := &in.Subscribers, &out.Subscribers
+		*out = new(Open5GSSubscribersStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Upgrade != nil {
+		in, out := &in.Upgrade, &out.Upgrade
+		*out = new(Open5GSUpgradeStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ApplyConflicts != nil {
+		in, out := &in.ApplyConflicts, &out.ApplyConflicts
+		*out = make([]Open5GSApplyConflict, len(*in))
+		copy(*out, *in)
+	}
+	if in.ResourceConflicts != nil {
+		in, out := &in.ResourceConflicts, &out.ResourceConflicts
+		*out = make([]Open5GSResourceConflict, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSStatus.
@@ -235,14 +327,179 @@ func (in *Open5GSStatus) DeepCopy() *Open5GSStatus {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *Open5GSUser) DeepCopyInto(out *Open5GSUser) {
+func (in *Open5GSSubscriberProfile) DeepCopyInto(out *Open5GSSubscriberProfile) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	out.Status = in.Status
 }
 
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSSubscriberProfile.
+func (in *Open5GSSubscriberProfile) DeepCopy() *Open5GSSubscriberProfile {
+	if in == nil {
+		return nil
+	}
+	out := new(Open5GSSubscriberProfile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Open5GSSubscriberProfile) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Open5GSSubscriberProfileList) DeepCopyInto(out *Open5GSSubscriberProfileList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]Open5GSSubscriberProfile, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSSubscriberProfileList.
+func (in *Open5GSSubscriberProfileList) DeepCopy() *Open5GSSubscriberProfileList {
+	if in == nil {
+		return nil
+	}
+	out := new(Open5GSSubscriberProfileList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Open5GSSubscriberProfileList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Open5GSSubscriberProfileSpec) DeepCopyInto(out *Open5GSSubscriberProfileSpec) {
+	*out = *in
+	in.QoS.DeepCopyInto(&out.QoS)
+	out.SessionAMBR = in.SessionAMBR
+	out.UEAMBR = in.UEAMBR
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSSubscriberProfileSpec.
+func (in *Open5GSSubscriberProfileSpec) DeepCopy() *Open5GSSubscriberProfileSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(Open5GSSubscriberProfileSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Open5GSSubscriberProfileStatus) DeepCopyInto(out *Open5GSSubscriberProfileStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSSubscriberProfileStatus.
+func (in *Open5GSSubscriberProfileStatus) DeepCopy() *Open5GSSubscriberProfileStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(Open5GSSubscriberProfileStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Open5GSSubscribersStatus) DeepCopyInto(out *Open5GSSubscribersStatus) {
+	*out = *in
+	if in.UnmanagedIMSIs != nil {
+		in, out := &in.UnmanagedIMSIs, &out.UnmanagedIMSIs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastScanTime != nil {
+		in, out := &in.LastScanTime, &out.LastScanTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSSubscribersStatus.
+func (in *Open5GSSubscribersStatus) DeepCopy() *Open5GSSubscribersStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(Open5GSSubscribersStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Open5GSUpgradeStatus) DeepCopyInto(out *Open5GSUpgradeStatus) {
+	*out = *in
+	if in.UpgradedFunctions != nil {
+		in, out := &in.UpgradedFunctions, &out.UpgradedFunctions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.FunctionStartTime != nil {
+		in, out := &in.FunctionStartTime, &out.FunctionStartTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSUpgradeStatus.
+func (in *Open5GSUpgradeStatus) DeepCopy() *Open5GSUpgradeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(Open5GSUpgradeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Open5GSUpgradeStrategy) DeepCopyInto(out *Open5GSUpgradeStrategy) {
+	*out = *in
+	if in.HealthChecks != nil {
+		in, out := &in.HealthChecks, &out.HealthChecks
+		*out = make([]Open5GSHealthCheck, len(*in))
+		copy(*out, *in)
+	}
+	if in.FunctionTimeoutSeconds != nil {
+		in, out := &in.FunctionTimeoutSeconds, &out.FunctionTimeoutSeconds
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSUpgradeStrategy.
+func (in *Open5GSUpgradeStrategy) DeepCopy() *Open5GSUpgradeStrategy {
+	if in == nil {
+		return nil
+	}
+	out := new(Open5GSUpgradeStrategy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Open5GSUser) DeepCopyInto(out *Open5GSUser) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSUser.
 func (in *Open5GSUser) DeepCopy() *Open5GSUser {
 	if in == nil {
@@ -261,6 +518,147 @@ func (in *Open5GSUser) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Open5GSUserAMBR) DeepCopyInto(out *Open5GSUserAMBR) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSUserAMBR.
+func (in *Open5GSUserAMBR) DeepCopy() *Open5GSUserAMBR {
+	if in == nil {
+		return nil
+	}
+	out := new(Open5GSUserAMBR)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Open5GSUserARP) DeepCopyInto(out *Open5GSUserARP) {
+	*out = *in
+	if in.PriorityLevel != nil {
+		in, out := &in.PriorityLevel, &out.PriorityLevel
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSUserARP.
+func (in *Open5GSUserARP) DeepCopy() *Open5GSUserARP {
+	if in == nil {
+		return nil
+	}
+	out := new(Open5GSUserARP)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Open5GSUserImport) DeepCopyInto(out *Open5GSUserImport) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSUserImport.
+func (in *Open5GSUserImport) DeepCopy() *Open5GSUserImport {
+	if in == nil {
+		return nil
+	}
+	out := new(Open5GSUserImport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Open5GSUserImport) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Open5GSUserImportList) DeepCopyInto(out *Open5GSUserImportList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]Open5GSUserImport, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSUserImportList.
+func (in *Open5GSUserImportList) DeepCopy() *Open5GSUserImportList {
+	if in == nil {
+		return nil
+	}
+	out := new(Open5GSUserImportList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Open5GSUserImportList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Open5GSUserImportSpec) DeepCopyInto(out *Open5GSUserImportSpec) {
+	*out = *in
+	out.Open5GS = in.Open5GS
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSUserImportSpec.
+func (in *Open5GSUserImportSpec) DeepCopy() *Open5GSUserImportSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(Open5GSUserImportSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Open5GSUserImportStatus) DeepCopyInto(out *Open5GSUserImportStatus) {
+	*out = *in
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Errors != nil {
+		in, out := &in.Errors, &out.Errors
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSUserImportStatus.
+func (in *Open5GSUserImportStatus) DeepCopy() *Open5GSUserImportStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(Open5GSUserImportStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Open5GSUserList) DeepCopyInto(out *Open5GSUserList) {
 	*out = *in
@@ -293,10 +691,184 @@ func (in *Open5GSUserList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Open5GSUserPool) DeepCopyInto(out *Open5GSUserPool) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSUserPool.
+func (in *Open5GSUserPool) DeepCopy() *Open5GSUserPool {
+	if in == nil {
+		return nil
+	}
+	out := new(Open5GSUserPool)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Open5GSUserPool) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Open5GSUserPoolKeys) DeepCopyInto(out *Open5GSUserPoolKeys) {
+	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+	if in.ConfigMapRef != nil {
+		in, out := &in.ConfigMapRef, &out.ConfigMapRef
+		*out = new(corev1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSUserPoolKeys.
+func (in *Open5GSUserPoolKeys) DeepCopy() *Open5GSUserPoolKeys {
+	if in == nil {
+		return nil
+	}
+	out := new(Open5GSUserPoolKeys)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Open5GSUserPoolList) DeepCopyInto(out *Open5GSUserPoolList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]Open5GSUserPool, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSUserPoolList.
+func (in *Open5GSUserPoolList) DeepCopy() *Open5GSUserPoolList {
+	if in == nil {
+		return nil
+	}
+	out := new(Open5GSUserPoolList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Open5GSUserPoolList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Open5GSUserPoolSpec) DeepCopyInto(out *Open5GSUserPoolSpec) {
+	*out = *in
+	in.Keys.DeepCopyInto(&out.Keys)
+	in.Template.DeepCopyInto(&out.Template)
+	out.Open5GS = in.Open5GS
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSUserPoolSpec.
+func (in *Open5GSUserPoolSpec) DeepCopy() *Open5GSUserPoolSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(Open5GSUserPoolSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Open5GSUserPoolStatus) DeepCopyInto(out *Open5GSUserPoolStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSUserPoolStatus.
+func (in *Open5GSUserPoolStatus) DeepCopy() *Open5GSUserPoolStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(Open5GSUserPoolStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Open5GSUserQoS) DeepCopyInto(out *Open5GSUserQoS) {
+	*out = *in
+	if in.Index != nil {
+		in, out := &in.Index, &out.Index
+		*out = new(int32)
+		**out = **in
+	}
+	in.ARP.DeepCopyInto(&out.ARP)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSUserQoS.
+func (in *Open5GSUserQoS) DeepCopy() *Open5GSUserQoS {
+	if in == nil {
+		return nil
+	}
+	out := new(Open5GSUserQoS)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Open5GSUserSpec) DeepCopyInto(out *Open5GSUserSpec) {
 	*out = *in
+	if in.KeysSecretRef != nil {
+		in, out := &in.KeysSecretRef, &out.KeysSecretRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+	if in.ProfileRef != nil {
+		in, out := &in.ProfileRef, &out.ProfileRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
 	out.Open5GS = in.Open5GS
+	in.QoS.DeepCopyInto(&out.QoS)
+	out.SessionAMBR = in.SessionAMBR
+	out.UEAMBR = in.UEAMBR
+	if in.MSISDN != nil {
+		in, out := &in.MSISDN, &out.MSISDN
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	out.UE = in.UE
+	if in.OperatorDeterminedBarring != nil {
+		in, out := &in.OperatorDeterminedBarring, &out.OperatorDeterminedBarring
+		*out = new(int32)
+		**out = **in
+	}
+	if in.AccessRestrictionData != nil {
+		in, out := &in.AccessRestrictionData, &out.AccessRestrictionData
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSUserSpec.
@@ -312,6 +884,22 @@ func (in *Open5GSUserSpec) DeepCopy() *Open5GSUserSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Open5GSUserStatus) DeepCopyInto(out *Open5GSUserStatus) {
 	*out = *in
+	if in.DriftedFields != nil {
+		in, out := &in.DriftedFields, &out.DriftedFields
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastDriftRepair != nil {
+		in, out := &in.LastDriftRepair, &out.LastDriftRepair
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSUserStatus.
@@ -323,3 +911,18 @@ func (in *Open5GSUserStatus) DeepCopy() *Open5GSUserStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Open5GSUserUE) DeepCopyInto(out *Open5GSUserUE) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Open5GSUserUE.
+func (in *Open5GSUserUE) DeepCopy() *Open5GSUserUE {
+	if in == nil {
+		return nil
+	}
+	out := new(Open5GSUserUE)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -7,9 +7,11 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -24,6 +26,7 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	//+kubebuilder:scaffold:imports
@@ -47,6 +50,9 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var open5gsResyncPeriod time.Duration
+	var subscriberResyncPeriod time.Duration
+	var userDeletionTimeout time.Duration
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
@@ -54,6 +60,15 @@ func main() {
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.BoolVar(&secureMetrics, "metrics-secure", false,
 		"If set the metrics endpoint is served securely")
+	flag.DurationVar(&open5gsResyncPeriod, "open5gs-resync-period", 10*time.Minute,
+		"Interval of the periodic reconciliation of Open5GS instances, on top of the one triggered by "+
+			"changes to the resources they own. The interval is jittered; 0 disables the periodic reconciliation.")
+	flag.DurationVar(&subscriberResyncPeriod, "subscriber-resync-period", 5*time.Minute,
+		"Interval of the periodic drift check of Open5GSUser and Open5GSUserPool subscribers. "+
+			"The interval is jittered; 0 disables the periodic check.")
+	flag.DurationVar(&userDeletionTimeout, "user-deletion-timeout", 10*time.Minute,
+		"Time a deleted Open5GSUser or Open5GSUserPool waits for its subscribers to be cleaned up in an "+
+			"unreachable MongoDB before its finalizer is removed anyway. 0 waits forever.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
 	opts := zap.Options{
@@ -112,22 +127,71 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err := monitoringv1.AddToScheme(mgr.GetScheme()); err != nil {
+		setupLog.Error(err, "unable to add monitoringv1 to scheme")
+		os.Exit(1)
+	}
 	if err = (&controller.Open5GSReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		ResyncPeriod: open5gsResyncPeriod,
+		HealthChecks: controller.NetworkHealthChecks{},
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Open5GS")
 		os.Exit(1)
 	}
+	mongoClients := controller.NewMongoClients()
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		mongoClients.Close()
+		return nil
+	})); err != nil {
+		setupLog.Error(err, "unable to register MongoDB client cleanup")
+		os.Exit(1)
+	}
+	subscriberStores := &controller.MongoSubscriberStores{Client: mgr.GetClient(), Clients: mongoClients}
 	if err = (&controller.Open5GSUserReconciler{
+		Client:          mgr.GetClient(),
+		Scheme:          mgr.GetScheme(),
+		Subscribers:     subscriberStores,
+		ResyncPeriod:    subscriberResyncPeriod,
+		DeletionTimeout: userDeletionTimeout,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Open5GSUser")
+		os.Exit(1)
+	}
+	if err = (&controller.Open5GSUserPoolReconciler{
+		Client:          mgr.GetClient(),
+		Scheme:          mgr.GetScheme(),
+		Subscribers:     subscriberStores,
+		ResyncPeriod:    subscriberResyncPeriod,
+		DeletionTimeout: userDeletionTimeout,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Open5GSUserPool")
+		os.Exit(1)
+	}
+	if err = (&controller.Open5GSUserImportReconciler{
+		Client:      mgr.GetClient(),
+		Scheme:      mgr.GetScheme(),
+		Subscribers: subscriberStores,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Open5GSUserImport")
+		os.Exit(1)
+	}
+	if err = (&controller.Open5GSSubscriberProfileReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Open5GSUser")
+		setupLog.Error(err, "unable to create controller", "controller", "Open5GSSubscriberProfile")
 		os.Exit(1)
 	}
-	if err := monitoringv1.AddToScheme(mgr.GetScheme()); err != nil {
-		setupLog.Error(err, "unable to add monitoringv1 to scheme")
+	if err = (&controller.Open5GSSubscribersReconciler{
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		Subscribers:  subscriberStores,
+		ResyncPeriod: subscriberResyncPeriod,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Open5GSSubscribers")
 		os.Exit(1)
 	}
 	//+kubebuilder:scaffold:builder
@@ -7,18 +7,27 @@
 package controller
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
-	"reflect"
+	"fmt"
+	"strings"
 
+	"github.com/go-logr/logr"
 	netv1 "github.com/gradiant/open5gs-operator/api/v1"
-	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
-	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/csaupgrade"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 )
 
 func generateConfigMapHash(cm *corev1.ConfigMap) (string, error) {
@@ -43,57 +52,167 @@ func hasOwnerReference(obj client.Object, owner *netv1.Open5GS) bool {
 	return false
 }
 
-func configMapEqual(cm1, cm2 *corev1.ConfigMap) bool {
-	return reflect.DeepEqual(cm1.Data, cm2.Data) &&
-		reflect.DeepEqual(cm1.Labels, cm2.Labels) &&
-		reflect.DeepEqual(cm1.Annotations, cm2.Annotations)
-}
-
-func deploymentEqual(d1, d2 *appsv1.Deployment) bool {
-	if d1 == nil || d2 == nil {
-		return false
+// fieldManager is the field manager of the resources applied by the operator
+const fieldManager = "open5gs-operator"
+
+// legacyFieldManager is the field manager of the resources written with
+// updates by the versions of the operator before server-side apply, named
+// after its binary
+const legacyFieldManager = "manager"
+
+// applyResource creates or updates a generated resource of the instance with
+// server-side apply, so that fields set by other controllers are preserved.
+// Resources of the same name not owned by the instance are adopted if its
+// adoption policy allows it, and left alone and recorded in its status
+// otherwise.
+//
+// When another field manager changed fields of the resource, the conflict is
+// recorded in the status of the instance and the fields are taken back.
+//
+// The resource is read from the cache, and returned as it was before the
+// apply, or nil if it did not exist, so that callers need not read it again.
+func applyResource(ctx context.Context, r *Open5GSReconciler, open5gs *netv1.Open5GS, obj client.Object, componentName string, logger logr.Logger) (client.Object, error) {
+	gvk, err := apiutil.GVKForObject(obj, r.Scheme)
+	if err != nil {
+		return nil, err
 	}
-
-	if !reflect.DeepEqual(d1.Labels, d2.Labels) {
-		return false
+	if err := setOwnerReference(open5gs, obj, r.Scheme); err != nil {
+		return nil, err
 	}
 
-	if d1.Spec.Template.Spec.ServiceAccountName != d2.Spec.Template.Spec.ServiceAccountName {
-		return false
+	object, err := r.Scheme.New(gvk)
+	if err != nil {
+		return nil, err
 	}
-
-	if len(d1.Spec.Template.Spec.Containers) != len(d2.Spec.Template.Spec.Containers) {
-		return false
+	existing := object.(client.Object)
+	err = r.Client.Get(ctx, client.ObjectKeyFromObject(obj), existing)
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Error obtaining the "+gvk.Kind, "component", componentName)
+		return nil, err
 	}
-
-	for i := range d1.Spec.Template.Spec.Containers {
-		if d1.Spec.Template.Spec.Containers[i].Image != d2.Spec.Template.Spec.Containers[i].Image {
-			return false
+	found := err == nil
+	if !found {
+		existing = nil
+	}
+	adopted := false
+	if found && !hasOwnerReference(existing, open5gs) {
+		if reason := adoptionBlocked(open5gs, existing); reason != "" {
+			open5gs.Status.ResourceConflicts = append(open5gs.Status.ResourceConflicts, netv1.Open5GSResourceConflict{
+				Kind:   gvk.Kind,
+				Name:   obj.GetName(),
+				Reason: reason,
+			})
+			logger.Info(gvk.Kind+" not owned by the instance. Leaving it alone.", "component", componentName, "name", obj.GetName(), "reason", reason)
+			r.Recorder.Eventf(open5gs, existing, corev1.EventTypeWarning, "ResourceConflict", "Adopt",
+				"%s %s of the %s was not adopted: %s", gvk.Kind, obj.GetName(), componentName, reason)
+			return existing, nil
+		}
+		adopted = true
+	}
+	if found {
+		// Fields set by older versions of the operator are handed over to the
+		// apply field manager, so that those no longer generated get removed
+		patch, err := csaupgrade.UpgradeManagedFieldsPatch(existing, sets.New(legacyFieldManager), fieldManager)
+		if err != nil {
+			return nil, err
+		}
+		if patch != nil {
+			if err := r.Client.Patch(ctx, existing, client.RawPatch(types.JSONPatchType, patch)); err != nil {
+				logger.Error(err, "Failed to take over the fields of the "+gvk.Kind, "component", componentName)
+				return nil, err
+			}
 		}
 	}
 
-	return true
-}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	delete(content, "status")
+	if metadata, ok := content["metadata"].(map[string]interface{}); ok {
+		delete(metadata, "creationTimestamp")
+		delete(metadata, "resourceVersion")
+		delete(metadata, "managedFields")
+	}
+	desired := &unstructured.Unstructured{Object: content}
+	desired.SetGroupVersionKind(gvk)
+
+	err = r.Client.Apply(ctx, client.ApplyConfigurationFromUnstructured(desired), client.FieldOwner(fieldManager))
+	if errors.IsConflict(err) {
+		open5gs.Status.ApplyConflicts = append(open5gs.Status.ApplyConflicts, netv1.Open5GSApplyConflict{
+			Kind:    gvk.Kind,
+			Name:    obj.GetName(),
+			Message: err.Error(),
+		})
+		logger.Info(gvk.Kind+" fields changed by another manager. Taking them back.", "component", componentName, "name", obj.GetName(), "conflict", err.Error())
+		r.Recorder.Eventf(open5gs, obj, corev1.EventTypeWarning, "ApplyConflict", "Update",
+			"Took back the fields of %s %s of the %s changed by another manager: %v", gvk.Kind, obj.GetName(), componentName, err)
+		err = r.Client.Apply(ctx, client.ApplyConfigurationFromUnstructured(desired), client.FieldOwner(fieldManager), client.ForceOwnership)
+	}
+	if err != nil {
+		logger.Error(err, "Failed to apply the "+gvk.Kind, "component", componentName)
+		return nil, err
+	}
 
-func pvcEqual(pvc1, pvc2 *corev1.PersistentVolumeClaim) bool {
-	return pvc1.Spec.Resources.Requests[corev1.ResourceStorage] == pvc2.Spec.Resources.Requests[corev1.ResourceStorage] &&
-		pvc1.Spec.AccessModes[0] == pvc2.Spec.AccessModes[0]
+	if !found {
+		logger.Info(gvk.Kind+" created", "component", componentName, "name", obj.GetName())
+		r.Recorder.Eventf(open5gs, obj, corev1.EventTypeNormal, "Created", "Create", "Created %s %s of the %s", gvk.Kind, obj.GetName(), componentName)
+	} else if adopted {
+		logger.Info(gvk.Kind+" adopted", "component", componentName, "name", obj.GetName())
+		r.Recorder.Eventf(open5gs, obj, corev1.EventTypeNormal, "Adopted", "Adopt", "Adopted %s %s of the %s", gvk.Kind, obj.GetName(), componentName)
+	} else if desired.GetResourceVersion() != existing.GetResourceVersion() {
+		logger.Info(gvk.Kind+" updated", "component", componentName, "name", obj.GetName())
+		r.Recorder.Eventf(open5gs, obj, corev1.EventTypeNormal, "Updated", "Update", "Updated %s %s of the %s", gvk.Kind, obj.GetName(), componentName)
+	}
+	return existing, nil
 }
 
-func serviceEqual(s1, s2 *corev1.Service) bool {
-	return reflect.DeepEqual(s1.Spec.Selector, s2.Spec.Selector) &&
-		reflect.DeepEqual(s1.Labels, s2.Labels) &&
-		reflect.DeepEqual(s1.Annotations, s2.Annotations) &&
-		s1.Spec.Type == s2.Spec.Type
+// kindOf returns the kind of a typed object, which its TypeMeta usually lacks
+func kindOf(scheme *runtime.Scheme, obj client.Object) string {
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		return "resource"
+	}
+	return gvk.Kind
 }
 
-func serviceMonitorEqual(sm1, sm2 *monitoringv1.ServiceMonitor) bool {
-	return reflect.DeepEqual(sm1.Spec.Selector, sm2.Spec.Selector) &&
-		reflect.DeepEqual(sm1.Labels, sm2.Labels) &&
-		reflect.DeepEqual(sm1.Annotations, sm2.Annotations)
+// adoptionBlocked returns why an existing resource not owned by the instance
+// may not be adopted by it, or "" if it may
+func adoptionBlocked(open5gs *netv1.Open5GS, existing client.Object) string {
+	if owner := metav1.GetControllerOf(existing); owner != nil {
+		return fmt.Sprintf("controlled by %s %s", owner.Kind, owner.Name)
+	}
+	switch open5gs.Spec.AdoptionPolicy {
+	case netv1.AdoptionPolicyAlways:
+		return ""
+	case netv1.AdoptionPolicyIfLabeled:
+		if existing.GetLabels()[netv1.AdoptLabel] == "true" {
+			return ""
+		}
+		return "missing the " + netv1.AdoptLabel + "=true label"
+	default:
+		return "adoptionPolicy is Never"
+	}
 }
 
-func serviceAccountEqual(sa1, sa2 *corev1.ServiceAccount) bool {
-	return reflect.DeepEqual(sa1.Labels, sa2.Labels) &&
-		reflect.DeepEqual(sa1.Annotations, sa2.Annotations)
+// setResourceConflictCondition sets the ResourceConflict condition of the
+// instance from the resources recorded as blocking by the reconciliation
+func setResourceConflictCondition(open5gs *netv1.Open5GS) {
+	condition := metav1.Condition{
+		Type:               netv1.ResourceConflictCondition,
+		Status:             metav1.ConditionFalse,
+		Reason:             "ResourcesOwned",
+		Message:            "Every generated resource is owned by the instance",
+		ObservedGeneration: open5gs.Generation,
+	}
+	if conflicts := open5gs.Status.ResourceConflicts; len(conflicts) > 0 {
+		blocking := make([]string, 0, len(conflicts))
+		for _, conflict := range conflicts {
+			blocking = append(blocking, fmt.Sprintf("%s %s (%s)", conflict.Kind, conflict.Name, conflict.Reason))
+		}
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "ResourcesNotOwned"
+		condition.Message = "Existing resources not adopted: " + strings.Join(blocking, ", ")
+	}
+	meta.SetStatusCondition(&open5gs.Status.Conditions, condition)
 }
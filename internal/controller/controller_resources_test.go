@@ -0,0 +1,113 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestApplyResource(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := netv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default", UID: "uid"}}
+	recorder := events.NewFakeRecorder(10)
+	r := &Open5GSReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme).WithObjects(open5gs).Build(),
+		Scheme:   scheme,
+		Recorder: recorder,
+	}
+	desired := func() *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "open5gs-amf", Namespace: "default"},
+			Data:       map[string]string{"amf.yaml": "amf"},
+		}
+	}
+
+	if _, err := applyResource(ctx, r, open5gs, desired(), "AMF", logr.Discard()); err != nil {
+		t.Fatalf("applyResource returned error: %v", err)
+	}
+	configMap := &corev1.ConfigMap{}
+	if err := r.Get(ctx, client.ObjectKey{Name: "open5gs-amf", Namespace: "default"}, configMap); err != nil {
+		t.Fatal(err)
+	}
+	if !hasOwnerReference(configMap, open5gs) || configMap.Data["amf.yaml"] != "amf" {
+		t.Fatalf("unexpected ConfigMap %+v", configMap)
+	}
+	if event := <-recorder.Events; event != "Normal Created Created ConfigMap open5gs-amf of the AMF" {
+		t.Errorf("unexpected event %q", event)
+	}
+
+	// Fields added by another manager are kept, fields of the operator it
+	// changed are taken back and reported
+	other := &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Name: "open5gs-amf", Namespace: "default"},
+		Data:       map[string]string{"amf.yaml": "changed", "extra": "value"},
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Apply(ctx, client.ApplyConfigurationFromUnstructured(&unstructured.Unstructured{Object: content}), client.FieldOwner("kubectl"), client.ForceOwnership); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := applyResource(ctx, r, open5gs, desired(), "AMF", logr.Discard()); err != nil {
+		t.Fatalf("applyResource returned error: %v", err)
+	}
+	if err := r.Get(ctx, client.ObjectKey{Name: "open5gs-amf", Namespace: "default"}, configMap); err != nil {
+		t.Fatal(err)
+	}
+	if configMap.Data["amf.yaml"] != "amf" || configMap.Data["extra"] != "value" {
+		t.Errorf("unexpected ConfigMap data %v", configMap.Data)
+	}
+	if conflicts := open5gs.Status.ApplyConflicts; len(conflicts) != 1 || conflicts[0].Kind != "ConfigMap" || conflicts[0].Name != "open5gs-amf" {
+		t.Errorf("expected the conflict to be reported, got %+v", conflicts)
+	}
+	if event := <-recorder.Events; !strings.HasPrefix(event, "Warning ApplyConflict ") {
+		t.Errorf("expected an ApplyConflict event, got %q", event)
+	}
+
+	// Resources not owned by the instance are left alone
+	foreign := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "foreign", Namespace: "default"},
+		Data:       map[string]string{"key": "value"},
+	}
+	if err := r.Create(ctx, foreign); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := applyResource(ctx, r, open5gs, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "foreign", Namespace: "default"},
+		Data:       map[string]string{"key": "other"},
+	}, "AMF", logr.Discard()); err != nil {
+		t.Fatalf("applyResource returned error: %v", err)
+	}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(foreign), configMap); err != nil {
+		t.Fatal(err)
+	}
+	if configMap.Data["key"] != "value" || hasOwnerReference(configMap, open5gs) {
+		t.Errorf("expected the foreign ConfigMap to be untouched, got %+v", configMap)
+	}
+}
@@ -0,0 +1,158 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// The metrics of the operator, served with the controller-runtime ones on
+// --metrics-bind-address
+var (
+	reconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "open5gs_operator_reconcile_duration_seconds",
+		Help: "Duration of the reconciliation of each network function of the Open5GS instances, and of the Open5GSUsers and Open5GSUserPools",
+	}, []string{"component"})
+	reconcileErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "open5gs_operator_reconcile_errors_total",
+		Help: "Failed reconciliations of each network function of the Open5GS instances, and of the Open5GSUsers and Open5GSUserPools",
+	}, []string{"component"})
+	subscriberProvisioningFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "open5gs_operator_subscriber_provisioning_failures_total",
+		Help: "Failures to write the subscribers of the Open5GSUsers and Open5GSUserPools to the MongoDB of an Open5GS instance",
+	}, []string{"namespace", "open5gs"})
+	subscriberDriftCorrections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "open5gs_operator_subscriber_drift_corrections_total",
+		Help: "Subscribers repaired in the MongoDB of an Open5GS instance after drifting from their Open5GSUser or Open5GSUserPool",
+	}, []string{"namespace", "open5gs"})
+	mongoOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "open5gs_operator_mongodb_operation_duration_seconds",
+		Help: "Duration of the MongoDB operations on subscribers",
+	}, []string{"operation"})
+	mongoOperationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "open5gs_operator_mongodb_operation_failures_total",
+		Help: "Failed MongoDB operations on subscribers",
+	}, []string{"operation"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		reconcileDuration,
+		reconcileErrors,
+		subscriberProvisioningFailures,
+		subscriberDriftCorrections,
+		mongoOperationDuration,
+		mongoOperationFailures,
+	)
+}
+
+// observeReconcile records the duration and the outcome of the
+// reconciliation of a component started at start
+func observeReconcile(component string, start time.Time, err error) {
+	reconcileDuration.WithLabelValues(component).Observe(time.Since(start).Seconds())
+	if err != nil {
+		reconcileErrors.WithLabelValues(component).Inc()
+	}
+}
+
+// mongoOperation starts timing a MongoDB operation. The returned function
+// records its duration and, given the error of the operation, its outcome. A
+// missing subscriber is not a failure.
+func mongoOperation(operation string) func(err *error) {
+	start := time.Now()
+	return func(err *error) {
+		mongoOperationDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+		if *err != nil && !errors.Is(*err, ErrSubscriberNotFound) {
+			mongoOperationFailures.WithLabelValues(operation).Inc()
+		}
+	}
+}
+
+// registerCollector registers a collector once, so that setting up the
+// controllers again, as the tests do, is harmless
+func registerCollector(collector prometheus.Collector) error {
+	if err := metrics.Registry.Register(collector); err != nil && !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+		return err
+	}
+	return nil
+}
+
+var (
+	networkFunctionsDesc = prometheus.NewDesc("open5gs_operator_network_functions",
+		"Enabled network functions of an Open5GS instance", []string{"namespace", "open5gs"}, nil)
+	networkFunctionsReadyDesc = prometheus.NewDesc("open5gs_operator_network_functions_ready",
+		"Available network functions of an Open5GS instance", []string{"namespace", "open5gs"}, nil)
+	subscribersDesc = prometheus.NewDesc("open5gs_operator_subscribers",
+		"Subscribers provisioned in the MongoDB of an Open5GS instance by its Open5GSUsers and Open5GSUserPools", []string{"namespace", "open5gs"}, nil)
+)
+
+// instanceCollector reports the network functions and the subscribers of the
+// Open5GS instances from their status and the ones of their users and pools,
+// read from the cache of the manager on every scrape
+type instanceCollector struct {
+	client client.Reader
+}
+
+func (c *instanceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- networkFunctionsDesc
+	ch <- networkFunctionsReadyDesc
+	ch <- subscribersDesc
+}
+
+func (c *instanceCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var instances netv1.Open5GSList
+	if err := c.client.List(ctx, &instances); err != nil {
+		return
+	}
+	subscribers := map[client.ObjectKey]int{}
+	for _, open5gs := range instances.Items {
+		key := client.ObjectKeyFromObject(&open5gs)
+		subscribers[key] = 0
+		ready := 0
+		for _, function := range open5gs.Status.Functions {
+			if function.Phase == netv1.FunctionPhaseAvailable {
+				ready++
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(networkFunctionsDesc, prometheus.GaugeValue, float64(len(open5gs.Status.Functions)), key.Namespace, key.Name)
+		ch <- prometheus.MustNewConstMetric(networkFunctionsReadyDesc, prometheus.GaugeValue, float64(ready), key.Namespace, key.Name)
+	}
+
+	var users netv1.Open5GSUserList
+	if err := c.client.List(ctx, &users); err != nil {
+		return
+	}
+	for i := range users.Items {
+		key := open5gsKey(&users.Items[i])
+		if _, ok := subscribers[key]; ok && users.Items[i].Status.IMSI != "" {
+			subscribers[key]++
+		}
+	}
+	var pools netv1.Open5GSUserPoolList
+	if err := c.client.List(ctx, &pools); err != nil {
+		return
+	}
+	for i := range pools.Items {
+		key := poolOpen5GSKey(&pools.Items[i])
+		if _, ok := subscribers[key]; ok {
+			subscribers[key] += int(pools.Items[i].Status.Provisioned)
+		}
+	}
+	for key, count := range subscribers {
+		ch <- prometheus.MustNewConstMetric(subscribersDesc, prometheus.GaugeValue, float64(count), key.Namespace, key.Name)
+	}
+}
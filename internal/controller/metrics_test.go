@@ -0,0 +1,66 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInstanceCollector(t *testing.T) {
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default"}}
+	open5gs.Status.Functions = []netv1.Open5GSFunctionStatus{
+		{Name: "MongoDB", Phase: netv1.FunctionPhaseAvailable},
+		{Name: "NRF", Phase: netv1.FunctionPhaseAvailable},
+		{Name: "SCP", Phase: netv1.FunctionPhaseProgressing},
+	}
+	provisioned := &netv1.Open5GSUser{
+		ObjectMeta: metav1.ObjectMeta{Name: "provisioned", Namespace: "default"},
+		Spec:       netv1.Open5GSUserSpec{Open5GS: netv1.Open5GSReference{Name: "open5gs"}},
+		Status:     netv1.Open5GSUserStatus{IMSI: "999700000000001"},
+	}
+	pending := &netv1.Open5GSUser{
+		ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: "default"},
+		Spec:       netv1.Open5GSUserSpec{Open5GS: netv1.Open5GSReference{Name: "open5gs"}},
+	}
+	pool := &netv1.Open5GSUserPool{
+		ObjectMeta: metav1.ObjectMeta{Name: "pool", Namespace: "default"},
+		Spec:       netv1.Open5GSUserPoolSpec{Open5GS: netv1.Open5GSReference{Name: "open5gs"}},
+		Status:     netv1.Open5GSUserPoolStatus{Provisioned: 5},
+	}
+	r := newTestOpen5GSReconciler(t, open5gs, provisioned, pending, pool)
+
+	expected := `
+# HELP open5gs_operator_network_functions Enabled network functions of an Open5GS instance
+# TYPE open5gs_operator_network_functions gauge
+open5gs_operator_network_functions{namespace="default",open5gs="open5gs"} 3
+# HELP open5gs_operator_network_functions_ready Available network functions of an Open5GS instance
+# TYPE open5gs_operator_network_functions_ready gauge
+open5gs_operator_network_functions_ready{namespace="default",open5gs="open5gs"} 2
+# HELP open5gs_operator_subscribers Subscribers provisioned in the MongoDB of an Open5GS instance by its Open5GSUsers and Open5GSUserPools
+# TYPE open5gs_operator_subscribers gauge
+open5gs_operator_subscribers{namespace="default",open5gs="open5gs"} 6
+`
+	if err := testutil.CollectAndCompare(&instanceCollector{client: r.Client}, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMongoOperationMetrics(t *testing.T) {
+	failures := testutil.ToFloat64(mongoOperationFailures.WithLabelValues("get"))
+	for _, err := range []error{nil, ErrSubscriberNotFound, errors.New("connection refused")} {
+		mongoOperation("get")(&err)
+	}
+	if got := testutil.ToFloat64(mongoOperationFailures.WithLabelValues("get")) - failures; got != 1 {
+		t.Errorf("expected a single failure, got %v", got)
+	}
+}
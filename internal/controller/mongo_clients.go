@@ -0,0 +1,90 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	mongoDisconnectTimeout = 5 * time.Second
+)
+
+// MongoClients keeps one pooled MongoDB client per Open5GS instance. A client
+// is replaced when the connection string of its instance changes and dropped
+// when the instance's MongoDB Service goes away.
+type MongoClients struct {
+	mu      sync.Mutex
+	clients map[client.ObjectKey]*cachedMongoClient
+}
+
+type cachedMongoClient struct {
+	uri    string
+	client *mongo.Client
+}
+
+func NewMongoClients() *MongoClients {
+	return &MongoClients{clients: make(map[client.ObjectKey]*cachedMongoClient)}
+}
+
+// Get returns the client of the given Open5GS instance, connecting to uri if
+// there is no client yet or if the cached one was created for another uri.
+func (m *MongoClients) Get(ctx context.Context, key client.ObjectKey, uri string) (*mongo.Client, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if cached, ok := m.clients[key]; ok {
+		if cached.uri == uri {
+			return cached.client, nil
+		}
+		delete(m.clients, key)
+		go disconnectMongo(cached.client)
+	}
+
+	conn, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %v", err)
+	}
+	m.clients[key] = &cachedMongoClient{uri: uri, client: conn}
+	return conn, nil
+}
+
+// Forget disconnects and drops the client of the given Open5GS instance
+func (m *MongoClients) Forget(key client.ObjectKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if cached, ok := m.clients[key]; ok {
+		delete(m.clients, key)
+		go disconnectMongo(cached.client)
+	}
+}
+
+// Close disconnects every client. It is meant to be called on shutdown.
+func (m *MongoClients) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, cached := range m.clients {
+		delete(m.clients, key)
+		disconnectMongo(cached.client)
+	}
+}
+
+func disconnectMongo(c *mongo.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoDisconnectTimeout)
+	defer cancel()
+	_ = c.Disconnect(ctx)
+}
@@ -0,0 +1,51 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestMongoClientsReuse(t *testing.T) {
+	clients := NewMongoClients()
+	defer clients.Close()
+
+	ctx := context.Background()
+	key := client.ObjectKey{Name: "open5gs", Namespace: "default"}
+
+	first, err := clients.Get(ctx, key, "mongodb://10.0.0.1:27017")
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	second, err := clients.Get(ctx, key, "mongodb://10.0.0.1:27017")
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if first != second {
+		t.Error("expected the client to be reused for the same connection string")
+	}
+
+	third, err := clients.Get(ctx, key, "mongodb://10.0.0.2:27017")
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if third == first {
+		t.Error("expected a new client when the connection string changes")
+	}
+
+	clients.Forget(key)
+	fourth, err := clients.Get(ctx, key, "mongodb://10.0.0.2:27017")
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if fourth == third {
+		t.Error("expected a new client after Forget")
+	}
+}
@@ -13,16 +13,23 @@ import (
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/events"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"github.com/go-logr/logr"
 	netv1 "github.com/gradiant/open5gs-operator/api/v1"
@@ -33,150 +40,141 @@ type Open5GSReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
 	Log    logr.Logger
+	// ResyncPeriod is the interval of the periodic reconciliation of each
+	// instance, on top of the one triggered by changes to the resources it
+	// owns. It is jittered; zero disables it.
+	ResyncPeriod time.Duration
+	// HealthChecks runs the health checks of the network functions during
+	// upgrades of the Open5GS image; nil skips them
+	HealthChecks FunctionHealthChecks
+	Recorder     events.EventRecorder
 }
 
 //+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gses,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gses/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gses/finalizers,verbs=update
 //+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch
 //+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=persistentvolumes,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
 
-func (r *Open5GSReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *Open5GSReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
 	logger := log.FromContext(ctx)
 
 	open5gs := &netv1.Open5GS{}
-	err := r.Get(ctx, req.NamespacedName, open5gs)
-	if err != nil {
+	if err := r.Get(ctx, req.NamespacedName, open5gs); err != nil {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
+	defer func() {
+		if err != nil {
+			r.Recorder.Eventf(open5gs, nil, corev1.EventTypeWarning, "ReconcileFailed", "Reconcile", "Reconciliation failed: %v", err)
+		}
+	}()
 
+	original := open5gs.DeepCopy()
 	setDefaultValues(open5gs)
 
-	if *open5gs.Spec.AMF.Enabled {
-		if err := r.reconcileAMF(ctx, req, open5gs, logger); err != nil {
-			return ctrl.Result{}, err
-		}
-	} else {
-		if err := r.deleteComponentResources(ctx, req, "AMF", open5gs, logger); err != nil {
-			return ctrl.Result{}, err
-		}
-	}
-	if *open5gs.Spec.AUSF.Enabled {
-		if err := r.reconcileAUSF(ctx, req, open5gs, logger); err != nil {
-			return ctrl.Result{}, err
-		}
-	} else {
-		if err := r.deleteComponentResources(ctx, req, "AUSF", open5gs, logger); err != nil {
-			return ctrl.Result{}, err
-		}
-	}
-	if *open5gs.Spec.BSF.Enabled {
-		if err := r.reconcileBSF(ctx, req, open5gs, logger); err != nil {
-			return ctrl.Result{}, err
-		}
-	} else {
-		if err := r.deleteComponentResources(ctx, req, "BSF", open5gs, logger); err != nil {
-			return ctrl.Result{}, err
-		}
-	}
-	if *open5gs.Spec.NRF.Enabled {
-		if err := r.reconcileNRF(ctx, req, open5gs, logger); err != nil {
-			return ctrl.Result{}, err
-		}
-	} else {
-		if err := r.deleteComponentResources(ctx, req, "NRF", open5gs, logger); err != nil {
-			return ctrl.Result{}, err
-		}
-	}
-	if *open5gs.Spec.NSSF.Enabled {
-		if err := r.reconcileNSSF(ctx, req, open5gs, logger); err != nil {
-			return ctrl.Result{}, err
-		}
-	} else {
-		if err := r.deleteComponentResources(ctx, req, "NSSF", open5gs, logger); err != nil {
-			return ctrl.Result{}, err
-		}
-	}
-	if *open5gs.Spec.SMF.Enabled {
-		if err := r.reconcileSMF(ctx, req, open5gs, logger); err != nil {
-			return ctrl.Result{}, err
-		}
-	} else {
-		if err := r.deleteComponentResources(ctx, req, "SMF", open5gs, logger); err != nil {
-			return ctrl.Result{}, err
-		}
-	}
-	if *open5gs.Spec.PCF.Enabled {
-		if err := r.reconcilePCF(ctx, req, open5gs, logger); err != nil {
-			return ctrl.Result{}, err
-		}
-	} else {
-		if err := r.deleteComponentResources(ctx, req, "PCF", open5gs, logger); err != nil {
-			return ctrl.Result{}, err
-		}
-	}
-	if *open5gs.Spec.SCP.Enabled {
-		if err := r.reconcileSCP(ctx, req, open5gs, logger); err != nil {
-			return ctrl.Result{}, err
+	// A paused instance only reports its status. The timeout of the function
+	// being upgraded starts over once it is resumed.
+	paused := instancePaused(open5gs)
+	open5gs.Status.Paused = paused
+	var upgradeRequeue time.Duration
+	if paused {
+		logger.Info("Open5GS instance paused. Skipping changes to its resources.")
+		if open5gs.Status.Upgrade != nil {
+			open5gs.Status.Upgrade.FunctionStartTime = nil
 		}
 	} else {
-		if err := r.deleteComponentResources(ctx, req, "SCP", open5gs, logger); err != nil {
+		// The conflicts of a paused instance are the ones of its last
+		// reconciliation
+		open5gs.Status.ApplyConflicts = nil
+		open5gs.Status.ResourceConflicts = nil
+		upgradeRequeue, err = r.advanceUpgrade(ctx, open5gs, logger)
+		if err != nil {
+			logger.Error(err, "Failed to check the Open5GS upgrade")
 			return ctrl.Result{}, err
 		}
 	}
-	if *open5gs.Spec.UDM.Enabled {
-		if err := r.reconcileUDM(ctx, req, open5gs, logger); err != nil {
-			return ctrl.Result{}, err
-		}
-	} else {
-		if err := r.deleteComponentResources(ctx, req, "UDM", open5gs, logger); err != nil {
-			return ctrl.Result{}, err
+
+	// Functions are created in dependency order: a function whose Deployment
+	// does not exist yet waits until the functions it depends on are
+	// available. The availability changes of the Deployments trigger the
+	// next reconciliation.
+	var functions []netv1.Open5GSFunctionStatus
+	available := map[string]bool{}
+	for _, nf := range networkFunctions {
+		frozen := paused || functionPaused(open5gs, nf)
+		if !*nf.Spec(&open5gs.Spec).Enabled {
+			if frozen {
+				continue
+			}
+			start := time.Now()
+			err := r.deleteComponentResources(ctx, nf, open5gs, logger)
+			observeReconcile(nf.Name, start, err)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			continue
 		}
-	}
-	if *open5gs.Spec.UDR.Enabled {
-		if err := r.reconcileUDR(ctx, req, open5gs, logger); err != nil {
+
+		deployment := &appsv1.Deployment{}
+		err := r.Get(ctx, client.ObjectKey{Name: nf.resourceName(open5gs), Namespace: open5gs.Namespace}, deployment)
+		if err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Error obtaining the Deployment", "component", nf.Name)
 			return ctrl.Result{}, err
 		}
-	} else {
-		if err := r.deleteComponentResources(ctx, req, "UDR", open5gs, logger); err != nil {
-			return ctrl.Result{}, err
+		exists := err == nil && hasOwnerReference(deployment, open5gs)
+		if !exists {
+			if waiting := nf.waitingFor(open5gs, available); len(waiting) > 0 {
+				logger.Info("Waiting for the functions it depends on", "component", nf.Name, "waitingFor", waiting)
+				functions = append(functions, netv1.Open5GSFunctionStatus{Name: nf.Name, Phase: netv1.FunctionPhaseWaiting, WaitingFor: waiting, Paused: frozen})
+				continue
+			}
 		}
-	}
-	if *open5gs.Spec.UPF.Enabled {
-		if err := r.reconcileUPF(ctx, req, open5gs, logger); err != nil {
-			return ctrl.Result{}, err
+
+		if !frozen {
+			start := time.Now()
+			err := r.reconcileFunction(ctx, open5gs, nf, functionImage(open5gs, nf), logger)
+			observeReconcile(nf.Name, start, err)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
 		}
-	} else {
-		if err := r.deleteComponentResources(ctx, req, "UPF", open5gs, logger); err != nil {
-			return ctrl.Result{}, err
+		phase := netv1.FunctionPhaseProgressing
+		if exists && deploymentAvailable(deployment) {
+			available[nf.Name] = true
+			phase = netv1.FunctionPhaseAvailable
 		}
+		functions = append(functions, netv1.Open5GSFunctionStatus{Name: nf.Name, Phase: phase, Paused: frozen})
 	}
-	if *open5gs.Spec.WebUI.Enabled {
-		if err := r.reconcileWebUI(ctx, req, open5gs, logger); err != nil {
-			return ctrl.Result{}, err
-		}
-	} else {
-		if err := r.deleteComponentResources(ctx, req, "WebUI", open5gs, logger); err != nil {
-			return ctrl.Result{}, err
+	open5gs.Status.Functions = functions
+	open5gs.Status.Ready = true
+	for _, function := range functions {
+		if function.Phase != netv1.FunctionPhaseAvailable {
+			open5gs.Status.Ready = false
 		}
 	}
 
-	if *open5gs.Spec.MongoDB.Enabled {
-		if err := r.reconcileMongoDB(ctx, req, open5gs, logger); err != nil {
-			return ctrl.Result{}, err
-		}
-	} else {
-		if err := r.deleteComponentResources(ctx, req, "MongoDB", open5gs, logger); err != nil {
+	setResourceConflictCondition(open5gs)
+
+	if !equality.Semantic.DeepEqual(open5gs.Status, original.Status) {
+		patched := original.DeepCopy()
+		patched.Status = open5gs.Status
+		if err := r.Status().Patch(ctx, patched, client.MergeFrom(original)); err != nil {
+			logger.Error(err, "Failed to update Open5GS status")
 			return ctrl.Result{}, err
 		}
 	}
 
-	return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	if upgradeRequeue > 0 {
+		return ctrl.Result{RequeueAfter: upgradeRequeue}, nil
+	}
+	return resyncResult(r.ResyncPeriod), nil
 }
 
 func (r *Open5GSReconciler) reconcileComponent(ctx context.Context, open5gs *netv1.Open5GS, componentName string, logger logr.Logger, args ...interface{}) error {
@@ -184,7 +182,6 @@ func (r *Open5GSReconciler) reconcileComponent(ctx context.Context, open5gs *net
 	var deployment *appsv1.Deployment
 	var services []*corev1.Service
 	var serviceMonitor *monitoringv1.ServiceMonitor
-	var pvc *corev1.PersistentVolumeClaim
 	var serviceAccount *corev1.ServiceAccount
 	for _, arg := range args {
 		switch v := arg.(type) {
@@ -198,8 +195,6 @@ func (r *Open5GSReconciler) reconcileComponent(ctx context.Context, open5gs *net
 			if available, err := isServiceMonitorCRDAvailable(r); err == nil && available {
 				serviceMonitor = v
 			}
-		case *corev1.PersistentVolumeClaim:
-			pvc = v
 		case *corev1.ServiceAccount:
 			serviceAccount = v
 		default:
@@ -241,7 +236,7 @@ func (r *Open5GSReconciler) reconcileComponent(ctx context.Context, open5gs *net
 	desiredServiceNames := make(map[string]bool)
 	for _, service := range services {
 		desiredServiceNames[service.Name] = true
-		if err := reconcileService(ctx, r, open5gs, service, componentName, logger); err != nil {
+		if _, err := applyResource(ctx, r, open5gs, service, componentName, logger); err != nil {
 			return err
 		}
 	}
@@ -253,21 +248,14 @@ func (r *Open5GSReconciler) reconcileComponent(ctx context.Context, open5gs *net
 				return err
 			}
 			logger.Info("Service deleted", "component", componentName, "service", existingService.Name)
-		}
-	}
-	for _, service := range services {
-		if err := ctrl.SetControllerReference(open5gs, service, r.Scheme); err != nil {
-			return err
-		}
-		if err := reconcileService(ctx, r, open5gs, service, componentName, logger); err != nil {
-			return err
+			r.recordDeleted(open5gs, &existingService, componentName)
 		}
 	}
 	if serviceMonitor != nil {
 		if err := ctrl.SetControllerReference(open5gs, serviceMonitor, r.Scheme); err != nil {
 			return err
 		}
-		if err := reconcileServiceMonitor(ctx, r, open5gs, serviceMonitor, componentName, logger); err != nil {
+		if _, err := applyResource(ctx, r, open5gs, serviceMonitor, componentName, logger); err != nil {
 			return err
 		}
 	} else {
@@ -289,24 +277,16 @@ func (r *Open5GSReconciler) reconcileComponent(ctx context.Context, open5gs *net
 					return err
 				}
 				logger.Info("ServiceMonitor deleted", "component", componentName, "serviceMonitor", existingServiceMonitor.Name)
+				r.recordDeleted(open5gs, existingServiceMonitor, componentName)
 			}
 		}
 	}
 
-	if pvc != nil {
-		if err := ctrl.SetControllerReference(open5gs, pvc, r.Scheme); err != nil {
-			return err
-		}
-		if err := reconcilePVC(ctx, r, open5gs, pvc, componentName, logger); err != nil {
-			return err
-		}
-	}
-
 	if serviceAccount != nil {
 		if err := ctrl.SetControllerReference(open5gs, serviceAccount, r.Scheme); err != nil {
 			return err
 		}
-		if err := reconcileServiceAccount(ctx, r, open5gs, serviceAccount, componentName, logger); err != nil {
+		if _, err := applyResource(ctx, r, open5gs, serviceAccount, componentName, logger); err != nil {
 			return err
 		}
 	} else {
@@ -327,507 +307,31 @@ func (r *Open5GSReconciler) reconcileComponent(ctx context.Context, open5gs *net
 				return err
 			}
 			logger.Info("ServiceAccount deleted", "component", componentName, "serviceAccount", existingServiceAccount.Name)
+			r.recordDeleted(open5gs, &existingServiceAccount, componentName)
 		}
 	}
 
 	return nil
 }
 
-func (r *Open5GSReconciler) reconcileAMF(ctx context.Context, req ctrl.Request, open5gs *netv1.Open5GS, logger logr.Logger) error {
-	componentName := "AMF"
-	configMap := CreateAMFConfigMap(req.Namespace, open5gs.Name, open5gs.Spec.Configuration, *open5gs.Spec.AMF.Metrics)
-
-	ports := []corev1.ContainerPort{
-		{
-			ContainerPort: 7777,
-			Name:          "sbi",
-			Protocol:      corev1.ProtocolTCP,
-		},
-		{
-			ContainerPort: 38412,
-			Name:          "ngap",
-			Protocol:      corev1.ProtocolSCTP,
-		},
-	}
-	if *open5gs.Spec.AMF.Metrics {
-		ports = append(ports, corev1.ContainerPort{
-			ContainerPort: 9090,
-			Name:          "metrics",
-			Protocol:      corev1.ProtocolTCP,
-		})
-	}
-	envVars := []corev1.EnvVar{}
-	ngapService := netv1.Open5GSService{Name: "ngap"}
-	if len(open5gs.Spec.AMF.Service) > 0 {
-		for _, service := range open5gs.Spec.AMF.Service {
-			if service.Name == "ngap" {
-				ngapService = service
-				break
-			}
-		}
-	}
-	services := []*corev1.Service{
-		CreateService(req.Namespace, open5gs.Name, componentName, "sbi", 7777, "TCP"),
-		CreateService(req.Namespace, open5gs.Name, componentName, "ngap", 38412, "SCTP", ngapService),
-	}
-	if *open5gs.Spec.AMF.Metrics {
-		services = append(services, CreateService(req.Namespace, open5gs.Name, componentName, "metrics", 9090, "TCP"))
-	}
-
-	var serviceMonitor *monitoringv1.ServiceMonitor
-	if *open5gs.Spec.AMF.ServiceMonitor {
-		serviceMonitor = CreateServiceMonitor(req.Namespace, open5gs.Name, strings.ToLower(componentName))
-	}
-	var serviceAccount *corev1.ServiceAccount
-	serviceAccountName := ""
-	if *open5gs.Spec.AMF.ServiceAccount {
-		serviceAccount = CreateServiceAccount(req.Namespace, open5gs.Name, componentName)
-		serviceAccountName = serviceAccount.Name
-	}
-	deployment := CreateDeployment(req.Namespace, open5gs.Name, componentName, open5gs.Spec.Open5GSImage, open5gs.Name+"-amf", "open5gs-amfd", ports, envVars, serviceAccountName)
-
-	return r.reconcileComponent(ctx, open5gs, componentName, logger, configMap, deployment, services, serviceMonitor, serviceAccount)
-}
-
-func (r *Open5GSReconciler) reconcileAUSF(ctx context.Context, req ctrl.Request, open5gs *netv1.Open5GS, logger logr.Logger) error {
-	componentName := "AUSF"
-	configMap := CreateAUSFConfigMap(req.Namespace, open5gs.Name, open5gs.Spec.Configuration)
-
-	ports := []corev1.ContainerPort{
-		{
-			ContainerPort: 7777,
-			Name:          "sbi",
-			Protocol:      corev1.ProtocolTCP,
-		},
-	}
-
-	envVars := []corev1.EnvVar{}
-
-	services := []*corev1.Service{
-		CreateService(req.Namespace, open5gs.Name, componentName, "sbi", 7777, "TCP"),
-	}
-	var serviceAccount *corev1.ServiceAccount
-	serviceAccountName := ""
-	if *open5gs.Spec.AUSF.ServiceAccount {
-		serviceAccount = CreateServiceAccount(req.Namespace, open5gs.Name, componentName)
-		serviceAccountName = serviceAccount.Name
-	}
-	deployment := CreateDeployment(req.Namespace, open5gs.Name, componentName, open5gs.Spec.Open5GSImage, open5gs.Name+"-ausf", "open5gs-ausfd", ports, envVars, serviceAccountName)
-
-	return r.reconcileComponent(ctx, open5gs, componentName, logger, configMap, deployment, services, serviceAccount)
-}
-
-func (r *Open5GSReconciler) reconcileBSF(ctx context.Context, req ctrl.Request, open5gs *netv1.Open5GS, logger logr.Logger) error {
-	componentName := "BSF"
-	configMap := CreateBSFConfigMap(req.Namespace, open5gs.Name, open5gs.Spec.Configuration)
-
-	ports := []corev1.ContainerPort{
-		{
-			ContainerPort: 7777,
-			Name:          "sbi",
-			Protocol:      corev1.ProtocolTCP,
-		},
-	}
-
-	envVars := []corev1.EnvVar{}
-
-	services := []*corev1.Service{
-		CreateService(req.Namespace, open5gs.Name, componentName, "sbi", 7777, "TCP"),
-	}
-	var serviceAccount *corev1.ServiceAccount
-	serviceAccountName := ""
-	if *open5gs.Spec.BSF.ServiceAccount {
-		serviceAccount = CreateServiceAccount(req.Namespace, open5gs.Name, componentName)
-
-		serviceAccountName = serviceAccount.Name
-
-	}
-	deployment := CreateDeployment(req.Namespace, open5gs.Name, componentName, open5gs.Spec.Open5GSImage, open5gs.Name+"-bsf", "open5gs-bsfd", ports, envVars, serviceAccountName)
-
-	return r.reconcileComponent(ctx, open5gs, componentName, logger, configMap, deployment, services, serviceAccount)
-}
-
-func (r *Open5GSReconciler) reconcileMongoDB(ctx context.Context, req ctrl.Request, open5gs *netv1.Open5GS, logger logr.Logger) error {
-	componentName := "MongoDB"
-	configMap := CreateMongoDBConfigMap(req.Namespace, open5gs.Name)
-	pvc := CreateMongoDBPVC(req.Namespace, open5gs.Name)
-	envVars := []corev1.EnvVar{
-		{Name: "BITNAMI_DEBUG", Value: "false"},
-		{Name: "ALLOW_EMPTY_PASSWORD", Value: "yes"},
-		{Name: "MONGODB_SYSTEM_LOG_VERBOSITY", Value: "0"},
-		{Name: "MONGODB_DISABLE_SYSTEM_LOG", Value: "no"},
-		{Name: "MONGODB_DISABLE_JAVASCRIPT", Value: "no"},
-		{Name: "MONGODB_ENABLE_JOURNAL", Value: "yes"},
-		{Name: "MONGODB_PORT_NUMBER", Value: "27017"},
-		{Name: "MONGODB_ENABLE_IPV6", Value: "no"},
-		{Name: "MONGODB_ENABLE_DIRECTORY_PER_DB", Value: "no"},
-	}
-	services := []*corev1.Service{
-		CreateMongoDBService(req.Namespace, open5gs.Name),
-	}
-
-	var serviceAccount *corev1.ServiceAccount
-	serviceAccountName := ""
-	if *open5gs.Spec.MongoDB.ServiceAccount {
-		serviceAccount = CreateServiceAccount(req.Namespace, open5gs.Name, componentName)
-		serviceAccountName = serviceAccount.Name
-
-	}
-	deployment := CreateMongoDBDeployment(req.Namespace, open5gs.Name, open5gs.Spec.MongoDBVersion, envVars, serviceAccountName)
-	deployment.Spec.Strategy = appsv1.DeploymentStrategy{
-		Type: appsv1.RecreateDeploymentStrategyType,
-	}
-	return r.reconcileComponent(ctx, open5gs, componentName, logger, configMap, deployment, services, pvc, serviceAccount)
-}
-
-func (r *Open5GSReconciler) reconcileNRF(ctx context.Context, req ctrl.Request, open5gs *netv1.Open5GS, logger logr.Logger) error {
-	componentName := "NRF"
-	configMap := CreateNRFConfigMap(req.Namespace, open5gs.Name, open5gs.Spec.Configuration)
-
-	ports := []corev1.ContainerPort{
-		{
-			ContainerPort: 7777,
-			Name:          "sbi",
-			Protocol:      corev1.ProtocolTCP,
-		},
-	}
-
-	envVars := []corev1.EnvVar{}
-
-	services := []*corev1.Service{
-		CreateService(req.Namespace, open5gs.Name, componentName, "sbi", 7777, "TCP"),
-	}
-
-	var serviceAccount *corev1.ServiceAccount
-	serviceAccountName := ""
-	if *open5gs.Spec.NRF.ServiceAccount {
-		serviceAccount = CreateServiceAccount(req.Namespace, open5gs.Name, componentName)
-		serviceAccountName = serviceAccount.Name
-	}
-	deployment := CreateDeployment(req.Namespace, open5gs.Name, componentName, open5gs.Spec.Open5GSImage, open5gs.Name+"-nrf", "open5gs-nrfd", ports, envVars, serviceAccountName)
-
-	return r.reconcileComponent(ctx, open5gs, componentName, logger, configMap, deployment, services, serviceAccount)
-}
-func (r *Open5GSReconciler) reconcileNSSF(ctx context.Context, req ctrl.Request, open5gs *netv1.Open5GS, logger logr.Logger) error {
-	componentName := "NSSF"
-	configMap := CreateNSSFConfigMap(req.Namespace, open5gs.Name, open5gs.Spec.Configuration)
-
-	ports := []corev1.ContainerPort{
-		{
-			ContainerPort: 7777,
-			Name:          "sbi",
-			Protocol:      corev1.ProtocolTCP,
-		},
-	}
-
-	envVars := []corev1.EnvVar{}
-
-	services := []*corev1.Service{
-		CreateService(req.Namespace, open5gs.Name, componentName, "sbi", 7777, "TCP"),
-	}
-
-	var serviceAccount *corev1.ServiceAccount
-	serviceAccountName := ""
-	if open5gs.Spec.NSSF.ServiceAccount != nil && *open5gs.Spec.NSSF.ServiceAccount {
-		serviceAccount = CreateServiceAccount(req.Namespace, open5gs.Name, componentName)
-		serviceAccountName = serviceAccount.Name
-	}
-	deployment := CreateDeployment(req.Namespace, open5gs.Name, componentName, open5gs.Spec.Open5GSImage, open5gs.Name+"-nssf", "open5gs-nssfd", ports, envVars, serviceAccountName)
-
-	return r.reconcileComponent(ctx, open5gs, componentName, logger, configMap, deployment, services, serviceAccount)
-}
-
-func (r *Open5GSReconciler) reconcilePCF(ctx context.Context, req ctrl.Request, open5gs *netv1.Open5GS, logger logr.Logger) error {
-	componentName := "PCF"
-	configMap := CreatePCFConfigMap(req.Namespace, open5gs.Name, open5gs.Spec.Configuration, *open5gs.Spec.PCF.Metrics)
-
-	ports := []corev1.ContainerPort{
-		{
-			ContainerPort: 7777,
-			Name:          "sbi",
-			Protocol:      corev1.ProtocolTCP,
-		},
-	}
-	if *open5gs.Spec.PCF.Metrics {
-		ports = append(ports, corev1.ContainerPort{
-			ContainerPort: 9090,
-			Name:          "metrics",
-			Protocol:      corev1.ProtocolTCP,
-		})
-	}
-
-	envVars := []corev1.EnvVar{
-		{
-			Name:  "DB_URI",
-			Value: "mongodb://" + open5gs.Name + "-mongodb/open5gs",
-		},
-	}
-
-	services := []*corev1.Service{
-		CreateService(req.Namespace, open5gs.Name, componentName, "sbi", 7777, "TCP"),
-	}
-	if *open5gs.Spec.PCF.Metrics {
-		services = append(services, CreateService(req.Namespace, open5gs.Name, componentName, "metrics", 9090, "TCP"))
-	}
-
-	var serviceMonitor *monitoringv1.ServiceMonitor
-	if open5gs.Spec.PCF.ServiceMonitor != nil && *open5gs.Spec.PCF.ServiceMonitor {
-		serviceMonitor = CreateServiceMonitor(req.Namespace, open5gs.Name, strings.ToLower(componentName))
-	}
-
-	var serviceAccount *corev1.ServiceAccount
-	serviceAccountName := ""
-	if open5gs.Spec.PCF.ServiceAccount != nil && *open5gs.Spec.PCF.ServiceAccount {
-		serviceAccount = CreateServiceAccount(req.Namespace, open5gs.Name, componentName)
-		serviceAccountName = serviceAccount.Name
-	}
-	deployment := CreateDeployment(req.Namespace, open5gs.Name, componentName, open5gs.Spec.Open5GSImage, open5gs.Name+"-pcf", "open5gs-pcfd", ports, envVars, serviceAccountName)
-
-	return r.reconcileComponent(ctx, open5gs, componentName, logger, configMap, deployment, services, serviceMonitor, serviceAccount)
-}
-
-func (r *Open5GSReconciler) reconcileSCP(ctx context.Context, req ctrl.Request, open5gs *netv1.Open5GS, logger logr.Logger) error {
-	componentName := "SCP"
-	configMap := CreateSCPConfigMap(req.Namespace, open5gs.Name, open5gs.Spec.Configuration)
-
-	ports := []corev1.ContainerPort{
-		{
-			ContainerPort: 7777,
-			Name:          "sbi",
-			Protocol:      corev1.ProtocolTCP,
-		},
-	}
-
-	envVars := []corev1.EnvVar{
-		{
-			Name:  "DB_URI",
-			Value: "mongodb://" + open5gs.Name + "-mongodb/open5gs",
-		},
-	}
-
-	services := []*corev1.Service{
-		CreateService(req.Namespace, open5gs.Name, componentName, "sbi", 7777, "TCP"),
-	}
-
-	var serviceAccount *corev1.ServiceAccount
-	serviceAccountName := ""
-	if open5gs.Spec.SCP.ServiceAccount != nil && *open5gs.Spec.SCP.ServiceAccount {
-		serviceAccount = CreateServiceAccount(req.Namespace, open5gs.Name, componentName)
-		serviceAccountName = serviceAccount.Name
-	}
-	deployment := CreateDeployment(req.Namespace, open5gs.Name, componentName, open5gs.Spec.Open5GSImage, open5gs.Name+"-scp", "open5gs-scpd", ports, envVars, serviceAccountName)
-
-	return r.reconcileComponent(ctx, open5gs, componentName, logger, configMap, deployment, services, serviceAccount)
-}
-
-func (r *Open5GSReconciler) reconcileSMF(ctx context.Context, req ctrl.Request, open5gs *netv1.Open5GS, logger logr.Logger) error {
-	componentName := "SMF"
-	configMap := CreateSMFConfigMap(req.Namespace, open5gs.Name, open5gs.Spec.Configuration, *open5gs.Spec.SMF.Metrics)
-
-	ports := []corev1.ContainerPort{
-		{
-			ContainerPort: 7777,
-			Name:          "sbi",
-			Protocol:      corev1.ProtocolTCP,
-		},
-		{
-			ContainerPort: 2123,
-			Name:          "gtpc",
-			Protocol:      corev1.ProtocolUDP,
-		},
-		{
-			ContainerPort: 2152,
-			Name:          "gtpu",
-			Protocol:      corev1.ProtocolUDP,
-		},
-		{
-			ContainerPort: 8805,
-			Name:          "pfcp",
-			Protocol:      corev1.ProtocolUDP,
-		},
-	}
-	if *open5gs.Spec.SMF.Metrics {
-		ports = append(ports, corev1.ContainerPort{
-			ContainerPort: 9090,
-			Name:          "metrics",
-			Protocol:      corev1.ProtocolTCP,
-		})
-	}
-
-	envVars := []corev1.EnvVar{}
-	pfcpService := netv1.Open5GSService{Name: "pfcp"}
-	if len(open5gs.Spec.SMF.Service) > 0 {
-		for _, service := range open5gs.Spec.SMF.Service {
-			if service.Name == "pfcp" {
-				pfcpService = service
-				break
-			}
-		}
-	}
-	services := []*corev1.Service{
-		CreateService(req.Namespace, open5gs.Name, componentName, "sbi", 7777, "TCP"),
-		CreateService(req.Namespace, open5gs.Name, componentName, "gtpc", 2123, "UDP"),
-		CreateService(req.Namespace, open5gs.Name, componentName, "gtpu", 2152, "UDP"),
-		CreateService(req.Namespace, open5gs.Name, componentName, "pfcp", 8805, "UDP", pfcpService),
-	}
-	if *open5gs.Spec.SMF.Metrics {
-		services = append(services, CreateService(req.Namespace, open5gs.Name, componentName, "metrics", 9090, "TCP"))
-	}
-
-	var serviceMonitor *monitoringv1.ServiceMonitor
-	if open5gs.Spec.SMF.ServiceMonitor != nil && *open5gs.Spec.SMF.ServiceMonitor {
-		serviceMonitor = CreateServiceMonitor(req.Namespace, open5gs.Name, strings.ToLower(componentName))
-	}
-
-	var serviceAccount *corev1.ServiceAccount
-	serviceAccountName := ""
-	if open5gs.Spec.SMF.ServiceAccount != nil && *open5gs.Spec.SMF.ServiceAccount {
-		serviceAccount = CreateServiceAccount(req.Namespace, open5gs.Name, componentName)
-		serviceAccountName = serviceAccount.Name
-	}
-	deployment := CreateDeployment(req.Namespace, open5gs.Name, componentName, open5gs.Spec.Open5GSImage, open5gs.Name+"-smf", "open5gs-smfd", ports, envVars, serviceAccountName)
-
-	return r.reconcileComponent(ctx, open5gs, componentName, logger, configMap, deployment, services, serviceMonitor, serviceAccount)
-}
-
-func (r *Open5GSReconciler) reconcileUDM(ctx context.Context, req ctrl.Request, open5gs *netv1.Open5GS, logger logr.Logger) error {
-	componentName := "UDM"
-	configMap := CreateUDMConfigMap(req.Namespace, open5gs.Name, open5gs.Spec.Configuration)
-
-	ports := []corev1.ContainerPort{
-		{
-			ContainerPort: 7777,
-			Name:          "sbi",
-			Protocol:      corev1.ProtocolTCP,
-		},
-	}
-
-	envVars := []corev1.EnvVar{}
-
-	services := []*corev1.Service{
-		CreateService(req.Namespace, open5gs.Name, componentName, "sbi", 7777, "TCP"),
-	}
-
-	var serviceAccount *corev1.ServiceAccount
-	serviceAccountName := ""
-	if open5gs.Spec.UDM.ServiceAccount != nil && *open5gs.Spec.UDM.ServiceAccount {
-		serviceAccount = CreateServiceAccount(req.Namespace, open5gs.Name, componentName)
-		serviceAccountName = serviceAccount.Name
-	}
-	deployment := CreateDeployment(req.Namespace, open5gs.Name, componentName, open5gs.Spec.Open5GSImage, open5gs.Name+"-udm", "open5gs-udmd", ports, envVars, serviceAccountName)
-
-	return r.reconcileComponent(ctx, open5gs, componentName, logger, configMap, deployment, services, serviceAccount)
-}
-
-func (r *Open5GSReconciler) reconcileUDR(ctx context.Context, req ctrl.Request, open5gs *netv1.Open5GS, logger logr.Logger) error {
-	componentName := "UDR"
-	configMap := CreateUDRConfigMap(req.Namespace, open5gs.Name, open5gs.Spec.Configuration)
-
-	ports := []corev1.ContainerPort{
-		{
-			ContainerPort: 7777,
-			Name:          "sbi",
-			Protocol:      corev1.ProtocolTCP,
-		},
-	}
-
-	envVars := []corev1.EnvVar{
-		{
-			Name:  "DB_URI",
-			Value: "mongodb://" + open5gs.Name + "-mongodb/open5gs",
-		},
-	}
-
-	services := []*corev1.Service{
-		CreateService(req.Namespace, open5gs.Name, componentName, "sbi", 7777, "TCP"),
-	}
-
-	var serviceAccount *corev1.ServiceAccount
-	serviceAccountName := ""
-	if open5gs.Spec.UDR.ServiceAccount != nil && *open5gs.Spec.UDR.ServiceAccount {
-		serviceAccount = CreateServiceAccount(req.Namespace, open5gs.Name, componentName)
-		serviceAccountName = serviceAccount.Name
-	}
-	deployment := CreateDeployment(req.Namespace, open5gs.Name, componentName, open5gs.Spec.Open5GSImage, open5gs.Name+"-udr", "open5gs-udrd", ports, envVars, serviceAccountName)
-	return r.reconcileComponent(ctx, open5gs, componentName, logger, configMap, deployment, services, serviceAccount)
-}
-
-func (r *Open5GSReconciler) reconcileUPF(ctx context.Context, req ctrl.Request, open5gs *netv1.Open5GS, logger logr.Logger) error {
-	componentName := "UPF"
-	gtpuDev := open5gs.Spec.UPF.GTPUDev
-	unprivileged := open5gs.Spec.UPF.Unprivileged != nil && *open5gs.Spec.UPF.Unprivileged
-	configMap := CreateUPFConfigMap(req.Namespace, open5gs.Name, open5gs.Spec.Configuration, *open5gs.Spec.UPF.Metrics, gtpuDev)
-	entrypointConfigMap := CreateUPFEntrypointConfigMap(req.Namespace, open5gs.Name, unprivileged)
-
-	envVars := []corev1.EnvVar{}
-	pfcpService := netv1.Open5GSService{Name: "pfcp"}
-	gtpuService := netv1.Open5GSService{Name: "gtpu"}
-	if len(open5gs.Spec.UPF.Service) > 0 {
-		for _, service := range open5gs.Spec.UPF.Service {
-			if service.Name == "pfcp" {
-				pfcpService = service
-			}
-			if service.Name == "gtpu" {
-				gtpuService = service
+// reconcileFunction applies the resources of an enabled network function,
+// running the given Open5GS image
+func (r *Open5GSReconciler) reconcileFunction(ctx context.Context, open5gs *netv1.Open5GS, nf networkFunction, image string, logger logr.Logger) error {
+	if nf.Resources != nil {
+		for _, obj := range nf.Resources(open5gs) {
+			if _, err := applyResource(ctx, r, open5gs, obj, nf.Name, logger); err != nil {
+				return err
 			}
 		}
 	}
-	services := []*corev1.Service{
-		CreateService(req.Namespace, open5gs.Name, componentName, "pfcp", 8805, "UDP", pfcpService),
-		CreateService(req.Namespace, open5gs.Name, componentName, "gtpu", 2152, "UDP", gtpuService),
-	}
-	if *open5gs.Spec.UPF.Metrics {
-		services = append(services, CreateService(req.Namespace, open5gs.Name, componentName, "metrics", 9090, "TCP"))
-	}
-
-	if err := ctrl.SetControllerReference(open5gs, entrypointConfigMap, r.Scheme); err != nil {
-		return err
-	}
-	reconcileConfigMap(ctx, r, open5gs, entrypointConfigMap, componentName, logger)
-
-	var serviceMonitor *monitoringv1.ServiceMonitor
-	if *open5gs.Spec.UPF.ServiceMonitor {
-		serviceMonitor = CreateServiceMonitor(req.Namespace, open5gs.Name, strings.ToLower(componentName))
-	}
-
-	var serviceAccount *corev1.ServiceAccount
-	serviceAccountName := ""
-	if open5gs.Spec.UPF.ServiceAccount != nil && *open5gs.Spec.UPF.ServiceAccount {
-		serviceAccount = CreateServiceAccount(req.Namespace, open5gs.Name, componentName)
-		serviceAccountName = serviceAccount.Name
-	}
-	deployment := CreateUPFDeployment(req.Namespace, open5gs.Name, open5gs.Spec.Open5GSImage, envVars, *open5gs.Spec.UPF.Metrics, serviceAccountName, open5gs.Spec.UPF.DeploymentAnnotations, unprivileged)
-	return r.reconcileComponent(ctx, open5gs, componentName, logger, configMap, deployment, services, serviceMonitor, serviceAccount)
-}
-
-func (r *Open5GSReconciler) reconcileWebUI(ctx context.Context, req ctrl.Request, open5gs *netv1.Open5GS, logger logr.Logger) error {
-	componentName := "WebUI"
-	configMap := CreateWebUIConfigMap(req.Namespace, open5gs.Name)
-
-	envVars := []corev1.EnvVar{
-		{
-			Name:  "DB_URI",
-			Value: "mongodb://" + open5gs.Name + "-mongodb/open5gs",
-		},
-	}
-
-	service := CreateService(req.Namespace, open5gs.Name, componentName, "http", 9999, "TCP")
-	services := []*corev1.Service{service}
-
-	var serviceAccount *corev1.ServiceAccount
-	serviceAccountName := ""
-	if open5gs.Spec.WebUI.ServiceAccount != nil && *open5gs.Spec.WebUI.ServiceAccount {
-		serviceAccount = CreateServiceAccount(req.Namespace, open5gs.Name, componentName)
-		serviceAccountName = serviceAccount.Name
-	}
-	deployment := CreateWebUIDeployment(req.Namespace, open5gs.Name, open5gs.Spec.WebUIImage, envVars, serviceAccountName, open5gs.Spec.MongoDBVersion)
-	return r.reconcileComponent(ctx, open5gs, componentName, logger, configMap, deployment, services, serviceAccount)
+	return r.reconcileComponent(ctx, open5gs, nf.Name, logger, nf.build(open5gs, image)...)
 }
 
 // This function deletes all the resources related to a component (with the OwnerReference set to the Open5GS CR)
-func (r *Open5GSReconciler) deleteComponentResources(ctx context.Context, req ctrl.Request, componentName string, open5gs *netv1.Open5GS, logger logr.Logger) error {
+func (r *Open5GSReconciler) deleteComponentResources(ctx context.Context, nf networkFunction, open5gs *netv1.Open5GS, logger logr.Logger) error {
+	componentName := nf.Name
 	configMap := &corev1.ConfigMap{}
-	err := r.Client.Get(ctx, client.ObjectKey{Name: open5gs.Name + "-" + strings.ToLower(componentName), Namespace: req.Namespace}, configMap)
+	err := r.Client.Get(ctx, client.ObjectKey{Name: open5gs.Name + "-" + strings.ToLower(componentName), Namespace: open5gs.Namespace}, configMap)
 	if err == nil {
 		if hasOwnerReference(configMap, open5gs) {
 			if err := r.Client.Delete(ctx, configMap); err != nil {
@@ -835,6 +339,7 @@ func (r *Open5GSReconciler) deleteComponentResources(ctx context.Context, req ct
 				return err
 			}
 			logger.Info("ConfigMap deleted", "component", componentName)
+			r.recordDeleted(open5gs, configMap, componentName)
 		}
 	} else if !errors.IsNotFound(err) {
 		logger.Error(err, "Error obtaining the ConfigMap", "component", componentName)
@@ -842,7 +347,7 @@ func (r *Open5GSReconciler) deleteComponentResources(ctx context.Context, req ct
 	}
 
 	deployment := &appsv1.Deployment{}
-	err = r.Client.Get(ctx, client.ObjectKey{Name: open5gs.Name + "-" + strings.ToLower(componentName), Namespace: req.Namespace}, deployment)
+	err = r.Client.Get(ctx, client.ObjectKey{Name: open5gs.Name + "-" + strings.ToLower(componentName), Namespace: open5gs.Namespace}, deployment)
 	if err == nil {
 		if hasOwnerReference(deployment, open5gs) {
 			if err := r.Client.Delete(ctx, deployment); err != nil {
@@ -850,6 +355,7 @@ func (r *Open5GSReconciler) deleteComponentResources(ctx context.Context, req ct
 				return err
 			}
 			logger.Info("Deployment deleted", "component", componentName)
+			r.recordDeleted(open5gs, deployment, componentName)
 		}
 	} else if !errors.IsNotFound(err) {
 		logger.Error(err, "Error obtaining the Deployment", "component", componentName)
@@ -858,10 +364,10 @@ func (r *Open5GSReconciler) deleteComponentResources(ctx context.Context, req ct
 
 	serviceList := &corev1.ServiceList{}
 	listOpts := []client.ListOption{
-		client.InNamespace(req.Namespace),
+		client.InNamespace(open5gs.Namespace),
 	}
 	if err := r.Client.List(ctx, serviceList, listOpts...); err != nil {
-		logger.Error(err, "Error al listar los Services", "component", componentName)
+		logger.Error(err, "Error listing the Services", "component", componentName)
 		return err
 	}
 	for _, service := range serviceList.Items {
@@ -871,12 +377,13 @@ func (r *Open5GSReconciler) deleteComponentResources(ctx context.Context, req ct
 				return err
 			}
 			logger.Info("Service deleted", "component", componentName, "service", service.Name)
+			r.recordDeleted(open5gs, &service, componentName)
 		}
 	}
 	if available, err := isServiceMonitorCRDAvailable(r); err == nil && available {
 
 		serviceMonitor := &monitoringv1.ServiceMonitor{}
-		err = r.Client.Get(ctx, client.ObjectKey{Name: open5gs.Name + "-" + strings.ToLower(componentName), Namespace: req.Namespace}, serviceMonitor)
+		err = r.Client.Get(ctx, client.ObjectKey{Name: open5gs.Name + "-" + strings.ToLower(componentName), Namespace: open5gs.Namespace}, serviceMonitor)
 		if err == nil {
 			if hasOwnerReference(serviceMonitor, open5gs) {
 				if err := r.Client.Delete(ctx, serviceMonitor); err != nil {
@@ -884,6 +391,7 @@ func (r *Open5GSReconciler) deleteComponentResources(ctx context.Context, req ct
 					return err
 				}
 				logger.Info("ServiceMonitor deleted", "component", componentName)
+				r.recordDeleted(open5gs, serviceMonitor, componentName)
 			}
 		} else if !errors.IsNotFound(err) {
 			logger.Error(err, "Error obtaining the ServiceMonitor", "component", componentName)
@@ -891,23 +399,27 @@ func (r *Open5GSReconciler) deleteComponentResources(ctx context.Context, req ct
 		}
 	}
 
-	pvc := &corev1.PersistentVolumeClaim{}
-	err = r.Client.Get(ctx, client.ObjectKey{Name: open5gs.Name + "-" + strings.ToLower(componentName), Namespace: req.Namespace}, pvc)
-	if err == nil {
-		if hasOwnerReference(pvc, open5gs) {
-			if err := r.Client.Delete(ctx, pvc); err != nil {
-				logger.Error(err, "Error deleting the PVC", "component", componentName)
+	if nf.Resources != nil {
+		for _, obj := range nf.Resources(open5gs) {
+			err = r.Client.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+			if err == nil {
+				if hasOwnerReference(obj, open5gs) {
+					if err := r.Client.Delete(ctx, obj); err != nil {
+						logger.Error(err, "Error deleting the resource", "component", componentName, "name", obj.GetName())
+						return err
+					}
+					logger.Info("Resource deleted", "component", componentName, "name", obj.GetName())
+					r.recordDeleted(open5gs, obj, componentName)
+				}
+			} else if !errors.IsNotFound(err) {
+				logger.Error(err, "Error obtaining the resource", "component", componentName, "name", obj.GetName())
 				return err
 			}
-			logger.Info("PVC deleted", "component", componentName)
 		}
-	} else if !errors.IsNotFound(err) {
-		logger.Error(err, "Error obtaining the PVC", "component", componentName)
-		return err
 	}
 
 	serviceAccount := &corev1.ServiceAccount{}
-	err = r.Client.Get(ctx, client.ObjectKey{Name: open5gs.Name + "-" + strings.ToLower(componentName), Namespace: req.Namespace}, serviceAccount)
+	err = r.Client.Get(ctx, client.ObjectKey{Name: open5gs.Name + "-" + strings.ToLower(componentName), Namespace: open5gs.Namespace}, serviceAccount)
 	if err == nil {
 		if hasOwnerReference(serviceAccount, open5gs) {
 			if err := r.Client.Delete(ctx, serviceAccount); err != nil {
@@ -915,6 +427,7 @@ func (r *Open5GSReconciler) deleteComponentResources(ctx context.Context, req ct
 				return err
 			}
 			logger.Info("ServiceAccount deleted", "component", componentName)
+			r.recordDeleted(open5gs, serviceAccount, componentName)
 		}
 	} else if !errors.IsNotFound(err) {
 		logger.Error(err, "Error obtaining the ServiceAccount", "component", componentName)
@@ -924,365 +437,111 @@ func (r *Open5GSReconciler) deleteComponentResources(ctx context.Context, req ct
 }
 
 func reconcileConfigMap(ctx context.Context, r *Open5GSReconciler, open5gs *netv1.Open5GS, configMap *corev1.ConfigMap, componentName string, logger logr.Logger) (string, error) {
-	if err := setOwnerReference(open5gs, configMap, r.Scheme); err != nil {
-		return "", err
-	}
-
 	configMapHash, err := generateConfigMapHash(configMap)
 	if err != nil {
-		logger.Error(err, "Error al generar el hash del ConfigMap", "component", componentName)
+		logger.Error(err, "Error generating the hash of the ConfigMap", "component", componentName)
 		return "", err
 	}
-
-	foundConfigMap := &corev1.ConfigMap{}
-	err = r.Client.Get(ctx, client.ObjectKey{Name: configMap.Name, Namespace: configMap.Namespace}, foundConfigMap)
-	if err != nil {
-		if errors.IsNotFound(err) {
-			if err := r.Client.Create(ctx, configMap); err != nil {
-				logger.Error(err, "Failed to create ConfigMap", "component", componentName)
-				return "", err
-			}
-			logger.Info("ConfigMap created", "component", componentName)
-		} else {
-			logger.Error(err, "Error obtaining the ConfigMap", "component", componentName)
-			return "", err
-		}
-	} else {
-		if !hasOwnerReference(foundConfigMap, open5gs) {
-			return configMapHash, nil
-		}
-
-		if !configMapEqual(configMap, foundConfigMap) {
-			foundConfigMap.Data = configMap.Data
-			if err := r.Client.Update(ctx, foundConfigMap); err != nil {
-				logger.Error(err, "Failed to update the ConfigMap", "component", componentName)
-				return "", err
-			}
-			logger.Info("ConfigMap updated", "component", componentName)
-		}
+	if _, err := applyResource(ctx, r, open5gs, configMap, componentName, logger); err != nil {
+		return "", err
 	}
 	return configMapHash, nil
 }
 
+// reconcileDeployment applies the whole Deployment, including the pod
+// template annotations of the UPF, with the hash of its ConfigMap so that
+// configuration changes roll the pods
 func reconcileDeployment(ctx context.Context, r *Open5GSReconciler, open5gs *netv1.Open5GS, deployment *appsv1.Deployment, configMapHash string, componentName string, logger logr.Logger) error {
-	if err := setOwnerReference(open5gs, deployment, r.Scheme); err != nil {
-		return err
-	}
-
 	if deployment.Spec.Template.Annotations == nil {
 		deployment.Spec.Template.Annotations = make(map[string]string)
 	}
-	deployment.Spec.Template.Annotations["open5gs/configmap-hash"] = configMapHash
-
-	foundDeployment := &appsv1.Deployment{}
-	err := r.Client.Get(ctx, client.ObjectKey{Name: deployment.Name, Namespace: deployment.Namespace}, foundDeployment)
+	deployment.Spec.Template.Annotations[configMapHashAnnotation] = configMapHash
+	autoscaled, err := deploymentAutoscaled(ctx, r.Client, deployment)
 	if err != nil {
-		if errors.IsNotFound(err) {
-			if err := r.Client.Create(ctx, deployment); err != nil {
-				logger.Error(err, "Failed to create Deployment", "component", componentName)
-				return err
-			}
-			logger.Info("Deployment created", "component", componentName)
-		} else {
-			logger.Error(err, "Error obtaining the Deployment", "component", componentName)
-			return err
-		}
-	} else {
-		if !hasOwnerReference(foundDeployment, open5gs) {
-			return nil
-		}
-
-		upfDeploymentName := open5gs.Name + "-upf"
-		if foundDeployment.Name == upfDeploymentName {
-			allowedAnnotations := map[string]struct{}{"open5gs/configmap-hash": {}}
-			if open5gs.Spec.UPF.DeploymentAnnotations != nil {
-				for k := range open5gs.Spec.UPF.DeploymentAnnotations {
-					allowedAnnotations[k] = struct{}{}
-				}
-			}
-
-			newAnnotations := make(map[string]string)
-			newAnnotations["open5gs/configmap-hash"] = configMapHash
-			if open5gs.Spec.UPF.DeploymentAnnotations != nil {
-				for k, v := range open5gs.Spec.UPF.DeploymentAnnotations {
-					newAnnotations[k] = v
-				}
-			}
-
-			current := foundDeployment.Spec.Template.Annotations
-			needUpdate := false
-			if len(current) != len(newAnnotations) {
-				needUpdate = true
-			} else {
-				for k, v := range newAnnotations {
-					if current[k] != v {
-						needUpdate = true
-						break
-					}
-				}
-				for k := range current {
-					if _, ok := newAnnotations[k]; !ok {
-						needUpdate = true
-						break
-					}
-				}
-			}
-			if needUpdate {
-				foundDeployment.Spec.Template.Annotations = newAnnotations
-				if err := r.Client.Update(ctx, foundDeployment); err != nil {
-					logger.Error(err, "Failed to update UPF Deployment annotations", "component", componentName)
-					return err
-				}
-				logger.Info("UPF Deployment annotations reconciled", "component", componentName)
-			}
-			return nil
-		}
-
-		if !deploymentEqual(deployment, foundDeployment) || foundDeployment.Spec.Template.Annotations["open5gs/configmap-hash"] != configMapHash {
-			foundDeployment.Spec = deployment.Spec
-			foundDeployment.Spec.Template.Annotations["open5gs/configmap-hash"] = configMapHash
-			if err := r.Client.Update(ctx, foundDeployment); err != nil {
-				logger.Error(err, "Failed to update the Deployment", "component", componentName)
-				return err
-			}
-			logger.Info("Deployment updated", "component", componentName)
-		}
-	}
-	return nil
-}
-
-func reconcilePVC(ctx context.Context, r *Open5GSReconciler, open5gs *netv1.Open5GS, pvc *corev1.PersistentVolumeClaim, componentName string, logger logr.Logger) error {
-	foundPVC := &corev1.PersistentVolumeClaim{}
-	err := r.Client.Get(ctx, client.ObjectKey{Name: pvc.Name, Namespace: pvc.Namespace}, foundPVC)
-	if err != nil {
-		if errors.IsNotFound(err) {
-			if err := r.Client.Create(ctx, pvc); err != nil {
-				logger.Error(err, "Failed to create PVC", "component", componentName)
-				return err
-			}
-			logger.Info("PVC created", "component", componentName)
-		} else {
-			logger.Error(err, "Error obtaining the PVC", "component", componentName)
-			return err
-		}
-	} else {
-		if !hasOwnerReference(foundPVC, open5gs) {
-			return nil
-		}
-
-		if !pvcEqual(pvc, foundPVC) {
-			foundPVC.Spec = pvc.Spec
-			if err := r.Client.Update(ctx, foundPVC); err != nil {
-				logger.Error(err, "Failed to update the PVC", "component", componentName)
-				return err
-			}
-			logger.Info("PVC updated", "component", componentName)
-		}
-	}
-	return nil
-}
-
-func reconcileService(ctx context.Context, r *Open5GSReconciler, open5gs *netv1.Open5GS, service *corev1.Service, componentName string, logger logr.Logger) error {
-	if err := setOwnerReference(open5gs, service, r.Scheme); err != nil {
+		logger.Error(err, "Error listing the HorizontalPodAutoscalers", "component", componentName)
 		return err
 	}
-
-	foundService := &corev1.Service{}
-	err := r.Client.Get(ctx, client.ObjectKey{Name: service.Name, Namespace: service.Namespace}, foundService)
-	if err != nil {
-		if errors.IsNotFound(err) {
-			if err := r.Client.Create(ctx, service); err != nil {
-				logger.Error(err, "Failed to create Service", "component", componentName)
-				return err
-			}
-			logger.Info("Service created", "component", componentName)
-		} else {
-			logger.Error(err, "Error obtaining the Service", "component", componentName)
-			return err
-		}
-	} else {
-		if !hasOwnerReference(foundService, open5gs) {
-			return nil
-		}
-
-		if !serviceEqual(service, foundService) {
-			foundService.Spec = service.Spec
-			if err := r.Client.Update(ctx, foundService); err != nil {
-				logger.Error(err, "Failed to update the Service", "component", componentName)
-				return err
-			}
-			logger.Info("Service updated", "component", componentName)
-		}
+	if autoscaled {
+		// The replicas are left to the HPA, so that it is not fought
+		deployment.Spec.Replicas = nil
 	}
-	return nil
-}
 
-func reconcileServiceMonitor(ctx context.Context, r *Open5GSReconciler, open5gs *netv1.Open5GS, serviceMonitor *monitoringv1.ServiceMonitor, componentName string, logger logr.Logger) error {
-	available, err := isServiceMonitorCRDAvailable(r)
+	existing, err := applyResource(ctx, r, open5gs, deployment, componentName, logger)
 	if err != nil {
 		return err
 	}
-	if !available {
+	if existing == nil || !hasOwnerReference(existing, open5gs) {
 		return nil
 	}
-	if err := setOwnerReference(open5gs, serviceMonitor, r.Scheme); err != nil {
-		return err
+	previousHash := existing.(*appsv1.Deployment).Spec.Template.Annotations[configMapHashAnnotation]
+	if previousHash != "" && previousHash != configMapHash {
+		logger.Info("ConfigMap changed. Restarting the pods.", "component", componentName)
+		r.Recorder.Eventf(open5gs, deployment, corev1.EventTypeNormal, "ConfigurationChanged", "Restart",
+			"Restarting the %s to apply its new configuration", componentName)
 	}
-	foundServiceMonitor := &monitoringv1.ServiceMonitor{}
-	err = r.Client.Get(ctx, client.ObjectKey{Name: serviceMonitor.Name, Namespace: serviceMonitor.Namespace}, foundServiceMonitor)
-	if err != nil {
-		if errors.IsNotFound(err) {
-			if err := r.Client.Create(ctx, serviceMonitor); err != nil {
-				logger.Error(err, "Failed to create ServiceMonitor", "component", componentName)
-				return err
-			}
-			logger.Info("ServiceMonitor created", "component", componentName)
-		} else {
-			logger.Error(err, "Error obtaining the ServiceMonitor", "component", componentName)
-			return err
-		}
-	} else {
-		if !hasOwnerReference(foundServiceMonitor, open5gs) {
-			return nil
-		}
+	return nil
+}
 
-		if !serviceMonitorEqual(serviceMonitor, foundServiceMonitor) {
-			foundServiceMonitor.Spec = serviceMonitor.Spec
-			if err := r.Client.Update(ctx, foundServiceMonitor); err != nil {
-				logger.Error(err, "Failed to update the ServiceMonitor", "component", componentName)
-				return err
-			}
-			logger.Info("ServiceMonitor updated", "component", componentName)
+// deploymentAutoscaled tells whether a HorizontalPodAutoscaler scales the
+// Deployment
+func deploymentAutoscaled(ctx context.Context, c client.Reader, deployment *appsv1.Deployment) (bool, error) {
+	autoscalers := &autoscalingv2.HorizontalPodAutoscalerList{}
+	if err := c.List(ctx, autoscalers, client.InNamespace(deployment.Namespace)); err != nil {
+		return false, err
+	}
+	for i := range autoscalers.Items {
+		if scalesDeployment(&autoscalers.Items[i]) == deployment.Name {
+			return true, nil
 		}
 	}
-	return nil
-
+	return false, nil
 }
 
-func reconcileServiceAccount(ctx context.Context, r *Open5GSReconciler, open5gs *netv1.Open5GS, serviceAccount *corev1.ServiceAccount, componentName string, logger logr.Logger) error {
-	if err := setOwnerReference(open5gs, serviceAccount, r.Scheme); err != nil {
-		return err
+// scalesDeployment returns the name of the Deployment scaled by the
+// HorizontalPodAutoscaler, or "" if it scales something else
+func scalesDeployment(autoscaler *autoscalingv2.HorizontalPodAutoscaler) string {
+	target := autoscaler.Spec.ScaleTargetRef
+	gv, err := schema.ParseGroupVersion(target.APIVersion)
+	if err != nil || gv.Group != appsv1.GroupName || target.Kind != "Deployment" {
+		return ""
 	}
+	return target.Name
+}
 
-	foundServiceAccount := &corev1.ServiceAccount{}
-	err := r.Client.Get(ctx, client.ObjectKey{Name: serviceAccount.Name, Namespace: serviceAccount.Namespace}, foundServiceAccount)
-	if err != nil {
-		if errors.IsNotFound(err) {
-			if err := r.Client.Create(ctx, serviceAccount); err != nil {
-				logger.Error(err, "Failed to create ServiceAccount", "component", componentName)
-				return err
-			}
-			logger.Info("ServiceAccount created", "component", componentName)
-		} else {
-			logger.Error(err, "Error obtaining the ServiceAccount", "component", componentName)
-			return err
+// autoscalerRequests maps a HorizontalPodAutoscaler to the instance owning the
+// Deployment it scales, so that its replicas are released or enforced again
+// right away
+func autoscalerRequests(c client.Reader) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		name := scalesDeployment(obj.(*autoscalingv2.HorizontalPodAutoscaler))
+		if name == "" {
+			return nil
 		}
-	} else {
-		if !hasOwnerReference(foundServiceAccount, open5gs) {
+		deployment := &appsv1.Deployment{}
+		if err := c.Get(ctx, client.ObjectKey{Name: name, Namespace: obj.GetNamespace()}, deployment); err != nil {
 			return nil
 		}
-
-		if !serviceAccountEqual(serviceAccount, foundServiceAccount) {
-			foundServiceAccount.Annotations = serviceAccount.Annotations
-			foundServiceAccount.Labels = serviceAccount.Labels
-			if err := r.Client.Update(ctx, foundServiceAccount); err != nil {
-				logger.Error(err, "Failed to update the ServiceAccount", "component", componentName)
-				return err
-			}
-			logger.Info("ServiceAccount updated", "component", componentName)
+		owner := metav1.GetControllerOf(deployment)
+		if owner == nil || owner.Kind != "Open5GS" {
+			return nil
 		}
+		return []reconcile.Request{{NamespacedName: client.ObjectKey{Name: owner.Name, Namespace: obj.GetNamespace()}}}
 	}
-	return nil
+}
+
+// configMapHashAnnotation holds the hash of the ConfigMap of a function in
+// its pod template
+const configMapHashAnnotation = "open5gs/configmap-hash"
+
+// recordDeleted reports the deletion of a resource of the component
+func (r *Open5GSReconciler) recordDeleted(open5gs *netv1.Open5GS, obj client.Object, componentName string) {
+	r.Recorder.Eventf(open5gs, nil, corev1.EventTypeNormal, "Deleted", "Delete",
+		"Deleted %s %s of the %s", kindOf(r.Scheme, obj), obj.GetName(), componentName)
 }
 
 func setDefaultValues(open5gs *netv1.Open5GS) {
-	if open5gs.Spec.AMF.Enabled == nil {
-		defaultAMFEnabled := true
-		open5gs.Spec.AMF.Enabled = &defaultAMFEnabled
-	}
-	if open5gs.Spec.AMF.Metrics == nil {
-		defaultAMFMetrics := true
-		open5gs.Spec.AMF.Metrics = &defaultAMFMetrics
-	}
-	if open5gs.Spec.AMF.ServiceMonitor == nil {
-		defaultAMFServiceMonitor := true
-		open5gs.Spec.AMF.ServiceMonitor = &defaultAMFServiceMonitor
-	}
-	if open5gs.Spec.AUSF.Enabled == nil {
-		defaultAUSFEnabled := true
-		open5gs.Spec.AUSF.Enabled = &defaultAUSFEnabled
-	}
-	if open5gs.Spec.BSF.Enabled == nil {
-		defaultBSFEnabled := true
-		open5gs.Spec.BSF.Enabled = &defaultBSFEnabled
-	}
-	if open5gs.Spec.NRF.Enabled == nil {
-		defaultNRFEnabled := true
-		open5gs.Spec.NRF.Enabled = &defaultNRFEnabled
-	}
-	if open5gs.Spec.NSSF.Enabled == nil {
-		defaultNSSFEnabled := true
-		open5gs.Spec.NSSF.Enabled = &defaultNSSFEnabled
-	}
-	if open5gs.Spec.SMF.Enabled == nil {
-		defaultSMFEnabled := true
-		open5gs.Spec.SMF.Enabled = &defaultSMFEnabled
-	}
-	if open5gs.Spec.SMF.Metrics == nil {
-		defaultSMFMetrics := true
-		open5gs.Spec.SMF.Metrics = &defaultSMFMetrics
-	}
-	if open5gs.Spec.SMF.ServiceMonitor == nil {
-		defaultSMFServiceMonitor := true
-		open5gs.Spec.SMF.ServiceMonitor = &defaultSMFServiceMonitor
-	}
-	if open5gs.Spec.PCF.Enabled == nil {
-		defaultPCFEnabled := true
-		open5gs.Spec.PCF.Enabled = &defaultPCFEnabled
-	}
-	if open5gs.Spec.PCF.Metrics == nil {
-		defaultPCFMetrics := true
-		open5gs.Spec.PCF.Metrics = &defaultPCFMetrics
-	}
-	if open5gs.Spec.PCF.ServiceMonitor == nil {
-		defaultPCFServiceMonitor := true
-		open5gs.Spec.PCF.ServiceMonitor = &defaultPCFServiceMonitor
-	}
-	if open5gs.Spec.SCP.Enabled == nil {
-		defaultSCPEnabled := true
-		open5gs.Spec.SCP.Enabled = &defaultSCPEnabled
-	}
-	if open5gs.Spec.UDM.Enabled == nil {
-		defaultUDMEnabled := true
-		open5gs.Spec.UDM.Enabled = &defaultUDMEnabled
-	}
-	if open5gs.Spec.UDR.Enabled == nil {
-		defaultUDREnabled := true
-		open5gs.Spec.UDR.Enabled = &defaultUDREnabled
-	}
-	if open5gs.Spec.UPF.Enabled == nil {
-		defaultUPFEnabled := true
-		open5gs.Spec.UPF.Enabled = &defaultUPFEnabled
-	}
-	if open5gs.Spec.UPF.Metrics == nil {
-		defaultUPFMetrics := true
-		open5gs.Spec.UPF.Metrics = &defaultUPFMetrics
-	}
-	if open5gs.Spec.UPF.ServiceMonitor == nil {
-		defaultUPFServiceMonitor := true
-		open5gs.Spec.UPF.ServiceMonitor = &defaultUPFServiceMonitor
-	}
-	if open5gs.Spec.UPF.Unprivileged == nil {
-		defaultUPFUnprivileged := false
-		open5gs.Spec.UPF.Unprivileged = &defaultUPFUnprivileged
-	}
-	if open5gs.Spec.WebUI.Enabled == nil {
-		defaultWebUIEnabled := false
-		open5gs.Spec.WebUI.Enabled = &defaultWebUIEnabled
-	}
-	if open5gs.Spec.MongoDB.Enabled == nil {
-		defaultMongoDBEnabled := true
-		open5gs.Spec.MongoDB.Enabled = &defaultMongoDBEnabled
+	for _, nf := range networkFunctions {
+		nf.setDefaults(&open5gs.Spec)
 	}
 	if open5gs.Spec.Configuration.MCC == "" {
 		open5gs.Spec.Configuration.MCC = "999"
@@ -1316,74 +575,61 @@ func setDefaultValues(open5gs *netv1.Open5GS) {
 	if open5gs.Spec.MongoDBVersion == "" {
 		open5gs.Spec.MongoDBVersion = "bitnami/mongodb:latest"
 	}
-	if open5gs.Spec.AMF.ServiceAccount == nil {
-		defaultAMFServiceAccount := false
-		open5gs.Spec.AMF.ServiceAccount = &defaultAMFServiceAccount
-	}
-	if open5gs.Spec.AUSF.ServiceAccount == nil {
-		defaultAUSFServiceAccount := false
-		open5gs.Spec.AUSF.ServiceAccount = &defaultAUSFServiceAccount
-	}
-	if open5gs.Spec.BSF.ServiceAccount == nil {
-		defaultBSFServiceAccount := false
-		open5gs.Spec.BSF.ServiceAccount = &defaultBSFServiceAccount
-	}
-	if open5gs.Spec.MongoDB.ServiceAccount == nil {
-		defaultMongoDBServiceAccount := false
-		open5gs.Spec.MongoDB.ServiceAccount = &defaultMongoDBServiceAccount
-	}
-	if open5gs.Spec.NRF.ServiceAccount == nil {
-		defaultNRFServiceAccount := false
-		open5gs.Spec.NRF.ServiceAccount = &defaultNRFServiceAccount
-	}
-	if open5gs.Spec.NSSF.ServiceAccount == nil {
-		defaultNSSFServiceAccount := false
-		open5gs.Spec.NSSF.ServiceAccount = &defaultNSSFServiceAccount
-	}
-	if open5gs.Spec.PCF.ServiceAccount == nil {
-		defaultPCFServiceAccount := false
-		open5gs.Spec.PCF.ServiceAccount = &defaultPCFServiceAccount
-	}
-	if open5gs.Spec.SCP.ServiceAccount == nil {
-		defaultSCPServiceAccount := false
-		open5gs.Spec.SCP.ServiceAccount = &defaultSCPServiceAccount
-	}
-	if open5gs.Spec.SMF.ServiceAccount == nil {
-		defaultSMFServiceAccount := false
-		open5gs.Spec.SMF.ServiceAccount = &defaultSMFServiceAccount
-	}
-	if open5gs.Spec.UDM.ServiceAccount == nil {
-		defaultUDMServiceAccount := false
-		open5gs.Spec.UDM.ServiceAccount = &defaultUDMServiceAccount
-	}
-	if open5gs.Spec.UDR.ServiceAccount == nil {
-		defaultUDRServiceAccount := false
-		open5gs.Spec.UDR.ServiceAccount = &defaultUDRServiceAccount
-	}
-	if open5gs.Spec.UPF.ServiceAccount == nil {
-		defaultUPFServiceAccount := false
-		open5gs.Spec.UPF.ServiceAccount = &defaultUPFServiceAccount
-	}
-	if open5gs.Spec.WebUI.ServiceAccount == nil {
-		defaultWebUIServiceAccount := false
-		open5gs.Spec.WebUI.ServiceAccount = &defaultWebUIServiceAccount
+}
+
+// instancePaused tells whether the instance is paused by spec.paused or by
+// the paused annotation
+func instancePaused(open5gs *netv1.Open5GS) bool {
+	return open5gs.Spec.Paused || open5gs.Annotations[netv1.PausedAnnotation] == "true"
+}
+
+// functionPaused tells whether the function is frozen by its spec or listed
+// in the paused annotation of the instance
+func functionPaused(open5gs *netv1.Open5GS, nf networkFunction) bool {
+	if nf.Spec(&open5gs.Spec).Paused {
+		return true
 	}
-	if open5gs.Spec.UPF.GTPUDev == "" {
-		open5gs.Spec.UPF.GTPUDev = "eth0"
+	for _, name := range strings.Split(open5gs.Annotations[netv1.PausedAnnotation], ",") {
+		if strings.EqualFold(strings.TrimSpace(name), nf.Name) {
+			return true
+		}
 	}
-
+	return false
 }
 
 func (r *Open5GSReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&netv1.Open5GS{}).
-		WithEventFilter(predicate.Funcs{
+	if r.Recorder == nil {
+		r.Recorder = mgr.GetEventRecorder("open5gs-controller")
+	}
+	if err := registerCollector(&instanceCollector{client: mgr.GetClient()}); err != nil {
+		return err
+	}
+	// Changes to the owned resources, including their deletion, trigger a
+	// reconciliation of the instance; updates of their status do not, except
+	// for the availability of the Deployments.
+	owned := builder.WithPredicates(ignoreStatusUpdates)
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&netv1.Open5GS{}, builder.WithPredicates(predicate.Funcs{
 			DeleteFunc: func(e event.DeleteEvent) bool {
 				log.FromContext(context.Background()).Info("Open5GS '"+e.Object.GetName()+"' has been completely deleted", "name", e.Object.GetName(), "namespace", e.Object.GetNamespace())
 				return false
 			},
-		}).
-		Complete(r)
+		})).
+		Owns(&appsv1.Deployment{}, builder.WithPredicates(predicate.Or(ignoreStatusUpdates, deploymentAvailabilityChanges))).
+		Owns(&corev1.ConfigMap{}, owned).
+		Owns(&corev1.Service{}, owned).
+		Owns(&corev1.PersistentVolumeClaim{}, owned).
+		Owns(&corev1.ServiceAccount{}, owned).
+		Watches(&autoscalingv2.HorizontalPodAutoscaler{}, handler.EnqueueRequestsFromMapFunc(autoscalerRequests(mgr.GetClient())))
+
+	available, err := serviceMonitorsAvailable(mgr.GetRESTMapper())
+	if err != nil {
+		return err
+	}
+	if available {
+		b = b.Owns(&monitoringv1.ServiceMonitor{}, owned)
+	}
+	return b.Complete(r)
 }
 
 func isServiceMonitorCRDAvailable(r *Open5GSReconciler) (bool, error) {
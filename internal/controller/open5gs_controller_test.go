@@ -0,0 +1,377 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestOpen5GSDeploymentDrift(t *testing.T) {
+	ctx := context.Background()
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default", UID: "uid"}}
+	r := newTestOpen5GSReconciler(t, open5gs)
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(open5gs)}
+	reconcileUntilReady(t, r, request)
+	getDeployment := func(name string) *appsv1.Deployment {
+		t.Helper()
+		deployment := &appsv1.Deployment{}
+		if err := r.Get(ctx, client.ObjectKey{Name: name, Namespace: "default"}, deployment); err != nil {
+			t.Fatal(err)
+		}
+		return deployment
+	}
+
+	// Edits of any generated field of the pod template are reverted
+	for _, name := range []string{"open5gs-pcf", "open5gs-upf"} {
+		deployment := getDeployment(name)
+		container := &deployment.Spec.Template.Spec.Containers[0]
+		container.Env = append(container.Env, corev1.EnvVar{Name: "EXTRA", Value: "1"})
+		container.Ports = nil
+		container.SecurityContext = nil
+		container.Image = "docker.io/gradiant/open5gs:edited"
+		if err := r.Update(ctx, deployment); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	pcf := getDeployment("open5gs-pcf").Spec.Template.Spec.Containers[0]
+	if pcf.Image != "docker.io/gradiant/open5gs:2.7.5" || len(pcf.Ports) == 0 {
+		t.Errorf("expected the PCF container to be restored, got %+v", pcf)
+	}
+	upf := getDeployment("open5gs-upf").Spec.Template.Spec.Containers[0]
+	if upf.Image != "docker.io/gradiant/open5gs:2.7.5" || len(upf.Ports) == 0 || upf.SecurityContext == nil {
+		t.Errorf("expected the UPF container to be restored, got %+v", upf)
+	}
+
+	// Spec changes roll out to the UPF too
+	if err := r.Get(ctx, request.NamespacedName, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	open5gs.Spec.UPF.Unprivileged = boolPtr(true)
+	if err := r.Update(ctx, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	upf = getDeployment("open5gs-upf").Spec.Template.Spec.Containers[0]
+	if upf.SecurityContext.Privileged == nil || *upf.SecurityContext.Privileged {
+		t.Error("expected the UPF to run unprivileged")
+	}
+}
+
+func TestOpen5GSLegacyFields(t *testing.T) {
+	ctx := context.Background()
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default", UID: "uid"}}
+	r := newTestOpen5GSReconciler(t, open5gs)
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(open5gs)}
+	setDefaultValues(open5gs)
+
+	// A Service written by an older version of the operator, with a port it
+	// no longer generates
+	mongodb, _ := functionByName("MongoDB")
+	service := mongodb.Services(open5gs)[0]
+	service.Spec.Ports = append(service.Spec.Ports, corev1.ServicePort{Name: "legacy", Port: 28017, Protocol: corev1.ProtocolTCP})
+	if err := setOwnerReference(open5gs, service, r.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Create(ctx, service, client.FieldOwner(legacyFieldManager)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(service), service); err != nil {
+		t.Fatal(err)
+	}
+	if len(service.Spec.Ports) != 1 || service.Spec.Ports[0].Name != "mongodb" {
+		t.Errorf("expected the legacy port to be removed, got %+v", service.Spec.Ports)
+	}
+	for _, entry := range service.ManagedFields {
+		if entry.Manager == legacyFieldManager {
+			t.Errorf("expected the fields of the legacy manager to be taken over, got %+v", service.ManagedFields)
+		}
+	}
+}
+
+func TestOpen5GSPaused(t *testing.T) {
+	ctx := context.Background()
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default", UID: "uid"}}
+	r := newTestOpen5GSReconciler(t, open5gs)
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(open5gs)}
+	reconcileUntilReady(t, r, request)
+	scale := func(name string, replicas int32) {
+		t.Helper()
+		deployment := &appsv1.Deployment{}
+		if err := r.Get(ctx, client.ObjectKey{Name: name, Namespace: "default"}, deployment); err != nil {
+			t.Fatal(err)
+		}
+		deployment.Spec.Replicas = &replicas
+		if err := r.Update(ctx, deployment, client.FieldOwner("kubectl")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	replicas := func(name string) int32 {
+		t.Helper()
+		deployment := &appsv1.Deployment{}
+		if err := r.Get(ctx, client.ObjectKey{Name: name, Namespace: "default"}, deployment); err != nil {
+			t.Fatal(err)
+		}
+		return *deployment.Spec.Replicas
+	}
+
+	// Freezing the UPF keeps the manual changes to it only
+	if err := r.Get(ctx, request.NamespacedName, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	open5gs.Annotations = map[string]string{netv1.PausedAnnotation: "upf"}
+	if err := r.Update(ctx, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	scale("open5gs-upf", 0)
+	scale("open5gs-amf", 0)
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if replicas("open5gs-upf") != 0 || replicas("open5gs-amf") != 1 {
+		t.Errorf("expected only the UPF to be frozen, got %d UPF and %d AMF replicas", replicas("open5gs-upf"), replicas("open5gs-amf"))
+	}
+	if err := r.Get(ctx, request.NamespacedName, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	for _, function := range open5gs.Status.Functions {
+		if function.Paused != (function.Name == "UPF") {
+			t.Errorf("unexpected paused status of the %s", function.Name)
+		}
+	}
+
+	// Pausing the instance keeps every change and still reports the status
+	open5gs.Annotations = nil
+	open5gs.Spec.Paused = true
+	open5gs.Spec.AMF.Enabled = boolPtr(false)
+	if err := r.Update(ctx, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	scale("open5gs-smf", 0)
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if replicas("open5gs-smf") != 0 || replicas("open5gs-upf") != 0 || replicas("open5gs-amf") != 1 {
+		t.Error("expected the Deployments to be left untouched while paused")
+	}
+	if err := r.Get(ctx, request.NamespacedName, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	if !open5gs.Status.Paused || len(open5gs.Status.Functions) == 0 {
+		t.Errorf("expected the paused instance to report its status, got %+v", open5gs.Status)
+	}
+
+	// Resuming it reverts the changes
+	open5gs.Spec.Paused = false
+	if err := r.Update(ctx, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if replicas("open5gs-smf") != 1 || replicas("open5gs-upf") != 1 {
+		t.Error("expected the Deployments to be restored once resumed")
+	}
+	if err := r.Get(ctx, client.ObjectKey{Name: "open5gs-amf", Namespace: "default"}, &appsv1.Deployment{}); !errors.IsNotFound(err) {
+		t.Errorf("expected the disabled AMF to be deleted once resumed, got %v", err)
+	}
+}
+
+func TestOpen5GSAutoscaled(t *testing.T) {
+	ctx := context.Background()
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default", UID: "uid"}}
+	r := newTestOpen5GSReconciler(t, open5gs)
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(open5gs)}
+	reconcileUntilReady(t, r, request)
+	autoscaler := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "amf", Namespace: "default"},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "open5gs-amf"},
+			MaxReplicas:    3,
+		},
+	}
+	if err := r.Create(ctx, autoscaler); err != nil {
+		t.Fatal(err)
+	}
+	if requests := autoscalerRequests(r.Client)(ctx, autoscaler); len(requests) != 1 || requests[0] != request {
+		t.Errorf("expected the HPA to enqueue the instance, got %v", requests)
+	}
+
+	// The HPA scales the AMF, and someone scales the SMF by hand
+	for name, replicas := range map[string]int32{"open5gs-amf": 3, "open5gs-smf": 0} {
+		deployment := &appsv1.Deployment{}
+		if err := r.Get(ctx, client.ObjectKey{Name: name, Namespace: "default"}, deployment); err != nil {
+			t.Fatal(err)
+		}
+		deployment.Spec.Replicas = &replicas
+		if err := r.Update(ctx, deployment, client.FieldOwner("kube-controller-manager")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	amf := &appsv1.Deployment{}
+	if err := r.Get(ctx, client.ObjectKey{Name: "open5gs-amf", Namespace: "default"}, amf); err != nil {
+		t.Fatal(err)
+	}
+	if *amf.Spec.Replicas != 3 {
+		t.Errorf("expected the replicas set by the HPA to be kept, got %d", *amf.Spec.Replicas)
+	}
+	smf := &appsv1.Deployment{}
+	if err := r.Get(ctx, client.ObjectKey{Name: "open5gs-smf", Namespace: "default"}, smf); err != nil {
+		t.Fatal(err)
+	}
+	if *smf.Spec.Replicas != 1 {
+		t.Errorf("expected the replicas of the SMF to be taken back, got %d", *smf.Spec.Replicas)
+	}
+	if err := r.Get(ctx, request.NamespacedName, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	for _, conflict := range open5gs.Status.ApplyConflicts {
+		if conflict.Name == "open5gs-amf" {
+			t.Errorf("did not expect the scaling by the HPA to be reported as a conflict, got %+v", conflict)
+		}
+	}
+}
+
+func TestOpen5GSAdoption(t *testing.T) {
+	ctx := context.Background()
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default", UID: "uid"}}
+	// A ConfigMap created by hand, and a Service controlled by another owner
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "open5gs-mongodb-common-scripts", Namespace: "default"},
+		Data:       map[string]string{"ping-mongodb.sh": "edited"},
+	}
+	controller := true
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "open5gs-mongodb", Namespace: "default", OwnerReferences: []metav1.OwnerReference{{
+			APIVersion: "v1", Kind: "ConfigMap", Name: "other", UID: "other", Controller: &controller,
+		}}},
+		Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "other", Port: 1}}},
+	}
+	r := newTestOpen5GSReconciler(t, open5gs, configMap, service)
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(open5gs)}
+	reconcile := func() *netv1.Open5GS {
+		t.Helper()
+		if _, err := r.Reconcile(ctx, request); err != nil {
+			t.Fatalf("Reconcile returned error: %v", err)
+		}
+		if err := r.Get(ctx, request.NamespacedName, open5gs); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(configMap), configMap); err != nil {
+			t.Fatal(err)
+		}
+		return open5gs
+	}
+
+	// By default the existing resources are left alone
+	reconcile()
+	if hasOwnerReference(configMap, open5gs) || configMap.Data["ping-mongodb.sh"] != "edited" {
+		t.Errorf("expected the ConfigMap to be left alone, got %+v", configMap)
+	}
+	condition := meta.FindStatusCondition(open5gs.Status.Conditions, netv1.ResourceConflictCondition)
+	if condition == nil || condition.Status != metav1.ConditionTrue ||
+		!strings.Contains(condition.Message, "ConfigMap open5gs-mongodb-common-scripts") || !strings.Contains(condition.Message, "Service open5gs-mongodb") {
+		t.Errorf("expected a ResourceConflict condition naming both resources, got %+v", condition)
+	}
+
+	// IfLabeled adopts the labeled ConfigMap only
+	open5gs.Spec.AdoptionPolicy = netv1.AdoptionPolicyIfLabeled
+	if err := r.Update(ctx, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	reconcile()
+	if hasOwnerReference(configMap, open5gs) {
+		t.Error("expected the unlabeled ConfigMap not to be adopted")
+	}
+	configMap.Labels = map[string]string{netv1.AdoptLabel: "true"}
+	if err := r.Update(ctx, configMap); err != nil {
+		t.Fatal(err)
+	}
+	reconcile()
+	if !hasOwnerReference(configMap, open5gs) || configMap.Data["ping-mongodb.sh"] == "edited" {
+		t.Errorf("expected the labeled ConfigMap to be adopted, got %+v", configMap)
+	}
+
+	// Resources controlled by another owner are never adopted
+	open5gs.Spec.AdoptionPolicy = netv1.AdoptionPolicyAlways
+	if err := r.Update(ctx, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	reconcile()
+	if len(open5gs.Status.ResourceConflicts) != 1 || open5gs.Status.ResourceConflicts[0].Kind != "Service" {
+		t.Errorf("expected only the Service to conflict, got %+v", open5gs.Status.ResourceConflicts)
+	}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(service), service); err != nil {
+		t.Fatal(err)
+	}
+	if hasOwnerReference(service, open5gs) || service.Spec.Ports[0].Name != "other" {
+		t.Errorf("expected the Service to be left alone, got %+v", service)
+	}
+}
+
+func TestOpen5GSConfigurationEvents(t *testing.T) {
+	ctx := context.Background()
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default", UID: "uid"}}
+	r := newTestOpen5GSReconciler(t, open5gs)
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(open5gs)}
+	reconcileUntilReady(t, r, request)
+	recorder := r.Recorder.(*events.FakeRecorder)
+	recorded := func() []string {
+		var recorded []string
+		for {
+			select {
+			case event := <-recorder.Events:
+				recorded = append(recorded, event)
+			default:
+				return recorded
+			}
+		}
+	}
+	if !slices.Contains(recorded(), "Normal Created Created Deployment open5gs-amf of the AMF") {
+		t.Error("expected an event for the creation of the AMF Deployment")
+	}
+
+	// A configuration change restarts the functions using it
+	if err := r.Get(ctx, request.NamespacedName, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	open5gs.Spec.Configuration.MCC = "001"
+	if err := r.Update(ctx, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if !slices.Contains(recorded(), "Normal ConfigurationChanged Restarting the AMF to apply its new configuration") {
+		t.Error("expected an event for the restart of the AMF")
+	}
+}
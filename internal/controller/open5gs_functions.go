@@ -0,0 +1,418 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"strings"
+
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// networkFunction describes a component of an Open5GS instance. The
+// Open5GS reconciler creates, updates, deletes and defaults every function
+// from its descriptor, so adding a function only takes a new entry in
+// networkFunctions and its ConfigMap builder.
+type networkFunction struct {
+	// Name of the component, lowercased in the names of its resources
+	Name string
+	// Binary is the command run in the standard Open5GS container
+	Binary string
+	// Ports of the container, each exposed by its own Service
+	Ports []functionPort
+	// Metrics tells whether the function exports Prometheus metrics. Its
+	// metrics and serviceMonitor fields then default to true.
+	Metrics bool
+	// Database tells whether the function connects to the MongoDB of the
+	// instance
+	Database bool
+	// DisabledByDefault functions are only deployed when enabled explicitly
+	DisabledByDefault bool
+	// DependsOn lists the functions that must be available before the
+	// function is created. Functions that connect to MongoDB depend on it
+	// implicitly.
+	DependsOn []string
+	// Spec returns the settings of the function in the Open5GS spec
+	Spec func(spec *netv1.Open5GSSpec) *netv1.Open5GSFunction
+	// ConfigMap builds the configuration of the function
+	ConfigMap func(open5gs *netv1.Open5GS) *corev1.ConfigMap
+
+	// OwnImage functions run an image other than the Open5GS one and are left
+	// out of its upgrades
+	OwnImage bool
+	// UpgradeLast functions are moved to a new Open5GS image after the others
+	UpgradeLast bool
+
+	// Deployment replaces the standard Open5GS Deployment for functions that
+	// run another image or need a special pod. The image is the Open5GS image
+	// the function must run.
+	Deployment func(open5gs *netv1.Open5GS, image string, envVars []corev1.EnvVar, serviceAccountName string) *appsv1.Deployment
+	// Services replaces the Services built from Ports
+	Services func(open5gs *netv1.Open5GS) []*corev1.Service
+	// Resources returns additional resources of the function
+	Resources func(open5gs *netv1.Open5GS) []client.Object
+	// Defaults sets the defaults of the fields specific to the function
+	Defaults func(function *netv1.Open5GSFunction)
+}
+
+// functionPort is a port of a network function
+type functionPort struct {
+	Name     string
+	Port     int32
+	Protocol corev1.Protocol
+	// Configurable ports take the Service type of the entry of the same name
+	// in the service list of the function
+	Configurable bool
+}
+
+var sbiPort = functionPort{Name: "sbi", Port: 7777, Protocol: corev1.ProtocolTCP}
+
+// networkFunctions lists the functions of an Open5GS instance in the order
+// they are reconciled, each after the functions it depends on
+var networkFunctions = []networkFunction{
+	{
+		Name: "MongoDB",
+		Spec: func(spec *netv1.Open5GSSpec) *netv1.Open5GSFunction { return &spec.MongoDB },
+		ConfigMap: func(open5gs *netv1.Open5GS) *corev1.ConfigMap {
+			return CreateMongoDBConfigMap(open5gs.Namespace, open5gs.Name)
+		},
+		OwnImage: true,
+		Deployment: func(open5gs *netv1.Open5GS, _ string, _ []corev1.EnvVar, serviceAccountName string) *appsv1.Deployment {
+			envVars := []corev1.EnvVar{
+				{Name: "BITNAMI_DEBUG", Value: "false"},
+				{Name: "ALLOW_EMPTY_PASSWORD", Value: "yes"},
+				{Name: "MONGODB_SYSTEM_LOG_VERBOSITY", Value: "0"},
+				{Name: "MONGODB_DISABLE_SYSTEM_LOG", Value: "no"},
+				{Name: "MONGODB_DISABLE_JAVASCRIPT", Value: "no"},
+				{Name: "MONGODB_ENABLE_JOURNAL", Value: "yes"},
+				{Name: "MONGODB_PORT_NUMBER", Value: "27017"},
+				{Name: "MONGODB_ENABLE_IPV6", Value: "no"},
+				{Name: "MONGODB_ENABLE_DIRECTORY_PER_DB", Value: "no"},
+			}
+			deployment := CreateMongoDBDeployment(open5gs.Namespace, open5gs.Name, open5gs.Spec.MongoDBVersion, envVars, serviceAccountName)
+			deployment.Spec.Strategy = appsv1.DeploymentStrategy{
+				Type: appsv1.RecreateDeploymentStrategyType,
+			}
+			return deployment
+		},
+		Services: func(open5gs *netv1.Open5GS) []*corev1.Service {
+			return []*corev1.Service{CreateMongoDBService(open5gs.Namespace, open5gs.Name)}
+		},
+		Resources: func(open5gs *netv1.Open5GS) []client.Object {
+			return []client.Object{CreateMongoDBPVC(open5gs.Namespace, open5gs.Name)}
+		},
+	},
+	{
+		Name:      "NRF",
+		Binary:    "open5gs-nrfd",
+		Ports:     []functionPort{sbiPort},
+		Spec:      func(spec *netv1.Open5GSSpec) *netv1.Open5GSFunction { return &spec.NRF },
+		DependsOn: []string{"MongoDB"},
+		ConfigMap: func(open5gs *netv1.Open5GS) *corev1.ConfigMap {
+			return CreateNRFConfigMap(open5gs.Namespace, open5gs.Name, open5gs.Spec.Configuration)
+		},
+	},
+	{
+		Name:      "SCP",
+		Binary:    "open5gs-scpd",
+		Ports:     []functionPort{sbiPort},
+		Database:  true,
+		Spec:      func(spec *netv1.Open5GSSpec) *netv1.Open5GSFunction { return &spec.SCP },
+		DependsOn: []string{"NRF"},
+		ConfigMap: func(open5gs *netv1.Open5GS) *corev1.ConfigMap {
+			return CreateSCPConfigMap(open5gs.Namespace, open5gs.Name, open5gs.Spec.Configuration)
+		},
+	},
+	{
+		Name:      "AMF",
+		Binary:    "open5gs-amfd",
+		Ports:     []functionPort{sbiPort, {Name: "ngap", Port: 38412, Protocol: corev1.ProtocolSCTP, Configurable: true}},
+		Metrics:   true,
+		Spec:      func(spec *netv1.Open5GSSpec) *netv1.Open5GSFunction { return &spec.AMF },
+		DependsOn: []string{"SCP"},
+		ConfigMap: func(open5gs *netv1.Open5GS) *corev1.ConfigMap {
+			return CreateAMFConfigMap(open5gs.Namespace, open5gs.Name, open5gs.Spec.Configuration, *open5gs.Spec.AMF.Metrics)
+		},
+	},
+	{
+		Name:      "AUSF",
+		Binary:    "open5gs-ausfd",
+		Ports:     []functionPort{sbiPort},
+		Spec:      func(spec *netv1.Open5GSSpec) *netv1.Open5GSFunction { return &spec.AUSF },
+		DependsOn: []string{"SCP"},
+		ConfigMap: func(open5gs *netv1.Open5GS) *corev1.ConfigMap {
+			return CreateAUSFConfigMap(open5gs.Namespace, open5gs.Name, open5gs.Spec.Configuration)
+		},
+	},
+	{
+		Name:      "BSF",
+		Binary:    "open5gs-bsfd",
+		Ports:     []functionPort{sbiPort},
+		Spec:      func(spec *netv1.Open5GSSpec) *netv1.Open5GSFunction { return &spec.BSF },
+		DependsOn: []string{"SCP"},
+		ConfigMap: func(open5gs *netv1.Open5GS) *corev1.ConfigMap {
+			return CreateBSFConfigMap(open5gs.Namespace, open5gs.Name, open5gs.Spec.Configuration)
+		},
+	},
+	{
+		Name:      "NSSF",
+		Binary:    "open5gs-nssfd",
+		Ports:     []functionPort{sbiPort},
+		Spec:      func(spec *netv1.Open5GSSpec) *netv1.Open5GSFunction { return &spec.NSSF },
+		DependsOn: []string{"SCP"},
+		ConfigMap: func(open5gs *netv1.Open5GS) *corev1.ConfigMap {
+			return CreateNSSFConfigMap(open5gs.Namespace, open5gs.Name, open5gs.Spec.Configuration)
+		},
+	},
+	{
+		Name:      "PCF",
+		Binary:    "open5gs-pcfd",
+		Ports:     []functionPort{sbiPort},
+		Metrics:   true,
+		Database:  true,
+		Spec:      func(spec *netv1.Open5GSSpec) *netv1.Open5GSFunction { return &spec.PCF },
+		DependsOn: []string{"SCP"},
+		ConfigMap: func(open5gs *netv1.Open5GS) *corev1.ConfigMap {
+			return CreatePCFConfigMap(open5gs.Namespace, open5gs.Name, open5gs.Spec.Configuration, *open5gs.Spec.PCF.Metrics)
+		},
+	},
+	{
+		Name:      "UDM",
+		Binary:    "open5gs-udmd",
+		Ports:     []functionPort{sbiPort},
+		Spec:      func(spec *netv1.Open5GSSpec) *netv1.Open5GSFunction { return &spec.UDM },
+		DependsOn: []string{"SCP"},
+		ConfigMap: func(open5gs *netv1.Open5GS) *corev1.ConfigMap {
+			return CreateUDMConfigMap(open5gs.Namespace, open5gs.Name, open5gs.Spec.Configuration)
+		},
+	},
+	{
+		Name:      "UDR",
+		Binary:    "open5gs-udrd",
+		Ports:     []functionPort{sbiPort},
+		Database:  true,
+		Spec:      func(spec *netv1.Open5GSSpec) *netv1.Open5GSFunction { return &spec.UDR },
+		DependsOn: []string{"SCP"},
+		ConfigMap: func(open5gs *netv1.Open5GS) *corev1.ConfigMap {
+			return CreateUDRConfigMap(open5gs.Namespace, open5gs.Name, open5gs.Spec.Configuration)
+		},
+	},
+	{
+		Name: "UPF",
+		Ports: []functionPort{
+			{Name: "pfcp", Port: 8805, Protocol: corev1.ProtocolUDP, Configurable: true},
+			{Name: "gtpu", Port: 2152, Protocol: corev1.ProtocolUDP, Configurable: true},
+		},
+		Metrics:   true,
+		Spec:      func(spec *netv1.Open5GSSpec) *netv1.Open5GSFunction { return &spec.UPF },
+		DependsOn: []string{"SCP"},
+		ConfigMap: func(open5gs *netv1.Open5GS) *corev1.ConfigMap {
+			return CreateUPFConfigMap(open5gs.Namespace, open5gs.Name, open5gs.Spec.Configuration, *open5gs.Spec.UPF.Metrics, open5gs.Spec.UPF.GTPUDev)
+		},
+		UpgradeLast: true,
+		Deployment: func(open5gs *netv1.Open5GS, image string, envVars []corev1.EnvVar, serviceAccountName string) *appsv1.Deployment {
+			upf := open5gs.Spec.UPF
+			return CreateUPFDeployment(open5gs.Namespace, open5gs.Name, image, envVars, *upf.Metrics, serviceAccountName, upf.DeploymentAnnotations, *upf.Unprivileged)
+		},
+		Resources: func(open5gs *netv1.Open5GS) []client.Object {
+			return []client.Object{CreateUPFEntrypointConfigMap(open5gs.Namespace, open5gs.Name, *open5gs.Spec.UPF.Unprivileged)}
+		},
+		Defaults: func(function *netv1.Open5GSFunction) {
+			if function.Unprivileged == nil {
+				function.Unprivileged = boolPtr(false)
+			}
+			if function.GTPUDev == "" {
+				function.GTPUDev = "eth0"
+			}
+		},
+	},
+	{
+		Name:   "SMF",
+		Binary: "open5gs-smfd",
+		Ports: []functionPort{
+			sbiPort,
+			{Name: "gtpc", Port: 2123, Protocol: corev1.ProtocolUDP},
+			{Name: "gtpu", Port: 2152, Protocol: corev1.ProtocolUDP},
+			{Name: "pfcp", Port: 8805, Protocol: corev1.ProtocolUDP, Configurable: true},
+		},
+		Metrics:   true,
+		Spec:      func(spec *netv1.Open5GSSpec) *netv1.Open5GSFunction { return &spec.SMF },
+		DependsOn: []string{"SCP", "UPF"},
+		ConfigMap: func(open5gs *netv1.Open5GS) *corev1.ConfigMap {
+			return CreateSMFConfigMap(open5gs.Namespace, open5gs.Name, open5gs.Spec.Configuration, *open5gs.Spec.SMF.Metrics)
+		},
+	},
+	{
+		Name:              "WebUI",
+		Ports:             []functionPort{{Name: "http", Port: 9999, Protocol: corev1.ProtocolTCP}},
+		Database:          true,
+		DisabledByDefault: true,
+		Spec:              func(spec *netv1.Open5GSSpec) *netv1.Open5GSFunction { return &spec.WebUI },
+		ConfigMap: func(open5gs *netv1.Open5GS) *corev1.ConfigMap {
+			return CreateWebUIConfigMap(open5gs.Namespace, open5gs.Name)
+		},
+		OwnImage: true,
+		Deployment: func(open5gs *netv1.Open5GS, _ string, envVars []corev1.EnvVar, serviceAccountName string) *appsv1.Deployment {
+			return CreateWebUIDeployment(open5gs.Namespace, open5gs.Name, open5gs.Spec.WebUIImage, envVars, serviceAccountName, open5gs.Spec.MongoDBVersion)
+		},
+	},
+}
+
+// resourceName returns the name of the main resources of the function
+func (nf networkFunction) resourceName(open5gs *netv1.Open5GS) string {
+	return open5gs.Name + "-" + strings.ToLower(nf.Name)
+}
+
+// build returns the resources of the function for the instance, in the form
+// taken by reconcileComponent, running the given Open5GS image
+func (nf networkFunction) build(open5gs *netv1.Open5GS, image string) []interface{} {
+	function := nf.Spec(&open5gs.Spec)
+	metrics := nf.Metrics && function.Metrics != nil && *function.Metrics
+
+	var services []*corev1.Service
+	var ports []corev1.ContainerPort
+	if nf.Services != nil {
+		services = nf.Services(open5gs)
+	} else {
+		for _, port := range nf.Ports {
+			ports = append(ports, corev1.ContainerPort{ContainerPort: port.Port, Name: port.Name, Protocol: port.Protocol})
+			service := netv1.Open5GSService{Name: port.Name}
+			if port.Configurable {
+				for _, s := range function.Service {
+					if s.Name == port.Name {
+						service = s
+						break
+					}
+				}
+			}
+			services = append(services, CreateService(open5gs.Namespace, open5gs.Name, nf.Name, port.Name, port.Port, port.Protocol, service))
+		}
+	}
+	if metrics {
+		ports = append(ports, corev1.ContainerPort{ContainerPort: 9090, Name: "metrics", Protocol: corev1.ProtocolTCP})
+		services = append(services, CreateService(open5gs.Namespace, open5gs.Name, nf.Name, "metrics", 9090, "TCP"))
+	}
+
+	envVars := []corev1.EnvVar{}
+	if nf.Database {
+		envVars = append(envVars, corev1.EnvVar{Name: "DB_URI", Value: "mongodb://" + open5gs.Name + "-mongodb/open5gs"})
+	}
+
+	resources := []interface{}{nf.ConfigMap(open5gs), services}
+	serviceAccountName := ""
+	if function.ServiceAccount != nil && *function.ServiceAccount {
+		serviceAccount := CreateServiceAccount(open5gs.Namespace, open5gs.Name, nf.Name)
+		serviceAccountName = serviceAccount.Name
+		resources = append(resources, serviceAccount)
+	}
+	if metrics && function.ServiceMonitor != nil && *function.ServiceMonitor {
+		resources = append(resources, CreateServiceMonitor(open5gs.Namespace, open5gs.Name, strings.ToLower(nf.Name)))
+	}
+
+	var deployment *appsv1.Deployment
+	if nf.Deployment != nil {
+		deployment = nf.Deployment(open5gs, image, envVars, serviceAccountName)
+	} else {
+		deployment = CreateDeployment(open5gs.Namespace, open5gs.Name, nf.Name, image, nf.resourceName(open5gs), nf.Binary, ports, envVars, serviceAccountName)
+	}
+	return append(resources, deployment)
+}
+
+// setDefaults fills the unset fields of the function in the spec
+func (nf networkFunction) setDefaults(spec *netv1.Open5GSSpec) {
+	function := nf.Spec(spec)
+	if function.Enabled == nil {
+		function.Enabled = boolPtr(!nf.DisabledByDefault)
+	}
+	if function.ServiceAccount == nil {
+		function.ServiceAccount = boolPtr(false)
+	}
+	if nf.Metrics {
+		if function.Metrics == nil {
+			function.Metrics = boolPtr(true)
+		}
+		if function.ServiceMonitor == nil {
+			function.ServiceMonitor = boolPtr(true)
+		}
+	}
+	if nf.Defaults != nil {
+		nf.Defaults(function)
+	}
+}
+
+// functionByName returns the network function of the given name
+func functionByName(name string) (networkFunction, bool) {
+	for _, nf := range networkFunctions {
+		if nf.Name == name {
+			return nf, true
+		}
+	}
+	return networkFunction{}, false
+}
+
+// dependencies returns the functions the function depends on, MongoDB
+// included for the functions that connect to it
+func (nf networkFunction) dependencies() []string {
+	var dependencies []string
+	if nf.Database {
+		dependencies = append(dependencies, "MongoDB")
+	}
+	return append(dependencies, nf.DependsOn...)
+}
+
+// waitingFor returns the functions the function depends on that are not
+// available yet. A dependency on a disabled function is replaced by the
+// dependencies of that function.
+func (nf networkFunction) waitingFor(open5gs *netv1.Open5GS, available map[string]bool) []string {
+	var waiting []string
+	seen := map[string]bool{}
+	var visit func(names []string)
+	visit = func(names []string) {
+		for _, name := range names {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			dependency, ok := functionByName(name)
+			if !ok {
+				continue
+			}
+			if !*dependency.Spec(&open5gs.Spec).Enabled {
+				visit(dependency.dependencies())
+				continue
+			}
+			if !available[name] {
+				waiting = append(waiting, name)
+			}
+		}
+	}
+	visit(nf.dependencies())
+	return waiting
+}
+
+// deploymentAvailable tells whether the Deployment has the minimum number of
+// replicas available
+func deploymentAvailable(deployment *appsv1.Deployment) bool {
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentAvailable {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// hasSBI tells whether the function exposes a service-based interface
+func (nf networkFunction) hasSBI() bool {
+	for _, port := range nf.Ports {
+		if port.Name == sbiPort.Name {
+			return true
+		}
+	}
+	return false
+}
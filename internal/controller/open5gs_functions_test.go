@@ -0,0 +1,255 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTestOpen5GSReconciler(t *testing.T, objects ...client.Object) *Open5GSReconciler {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := netv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := monitoringv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return &Open5GSReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).WithStatusSubresource(&netv1.Open5GS{}).WithReturnManagedFields().Build(),
+		Scheme: scheme,
+		// Large enough for the events of every test
+		Recorder: events.NewFakeRecorder(1000),
+	}
+}
+
+// markAvailable marks the Deployments of the instance as rolled out and
+// available, as the Deployment controller would once their pods are ready
+func markAvailable(t *testing.T, r *Open5GSReconciler, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		deployment := &appsv1.Deployment{}
+		if err := r.Get(context.Background(), client.ObjectKey{Name: name, Namespace: "default"}, deployment); err != nil {
+			t.Fatal(err)
+		}
+		deployment.Status.Conditions = []appsv1.DeploymentCondition{{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue}}
+		deployment.Status.ObservedGeneration = deployment.Generation
+		deployment.Status.Replicas = 1
+		deployment.Status.UpdatedReplicas = 1
+		if err := r.Status().Update(context.Background(), deployment); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// reconcileUntilReady reconciles the instance, making its Deployments
+// available after each pass, until it is ready
+func reconcileUntilReady(t *testing.T, r *Open5GSReconciler, request ctrl.Request) {
+	t.Helper()
+	ctx := context.Background()
+	for range networkFunctions {
+		if _, err := r.Reconcile(ctx, request); err != nil {
+			t.Fatalf("Reconcile returned error: %v", err)
+		}
+		open5gs := &netv1.Open5GS{}
+		if err := r.Get(ctx, request.NamespacedName, open5gs); err != nil {
+			t.Fatal(err)
+		}
+		if open5gs.Status.Ready {
+			return
+		}
+		var deployments appsv1.DeploymentList
+		if err := r.List(ctx, &deployments); err != nil {
+			t.Fatal(err)
+		}
+		for _, deployment := range deployments.Items {
+			if !deploymentAvailable(&deployment) {
+				markAvailable(t, r, deployment.Name)
+			}
+		}
+	}
+	t.Fatal("the instance did not become ready")
+}
+
+func TestNetworkFunctionDefaults(t *testing.T) {
+	open5gs := &netv1.Open5GS{}
+	setDefaultValues(open5gs)
+	for _, nf := range networkFunctions {
+		function := nf.Spec(&open5gs.Spec)
+		if function.Enabled == nil || *function.Enabled == nf.DisabledByDefault {
+			t.Errorf("%s: unexpected enabled default %v", nf.Name, function.Enabled)
+		}
+		if function.ServiceAccount == nil || *function.ServiceAccount {
+			t.Errorf("%s: expected the ServiceAccount to be disabled by default", nf.Name)
+		}
+		if nf.Metrics && (function.Metrics == nil || !*function.Metrics) {
+			t.Errorf("%s: expected metrics to be enabled by default", nf.Name)
+		}
+	}
+	if open5gs.Spec.UPF.GTPUDev != "eth0" || open5gs.Spec.UPF.Unprivileged == nil {
+		t.Errorf("expected the UPF defaults, got %+v", open5gs.Spec.UPF)
+	}
+}
+
+func TestNetworkFunctionBuild(t *testing.T) {
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default"}}
+	open5gs.Spec.AMF.Service = []netv1.Open5GSService{{Name: "ngap", ServiceType: "NodePort"}, {Name: "sbi", ServiceType: "NodePort"}}
+	open5gs.Spec.AMF.Metrics = boolPtr(false)
+	setDefaultValues(open5gs)
+
+	amf, _ := functionByName("AMF")
+	var deployment *appsv1.Deployment
+	var services []*corev1.Service
+	for _, resource := range amf.build(open5gs, open5gs.Spec.Open5GSImage) {
+		switch v := resource.(type) {
+		case *appsv1.Deployment:
+			deployment = v
+		case []*corev1.Service:
+			services = v
+		}
+	}
+	if len(services) != 2 {
+		t.Fatalf("expected the sbi and ngap Services without metrics, got %d", len(services))
+	}
+	for _, service := range services {
+		configurable := service.Name == "open5gs-amf-ngap"
+		if (service.Spec.Type == corev1.ServiceTypeNodePort) != configurable {
+			t.Errorf("unexpected type %s of Service %s", service.Spec.Type, service.Name)
+		}
+	}
+	container := deployment.Spec.Template.Spec.Containers[0]
+	if len(container.Ports) != 2 || container.Ports[1].Protocol != corev1.ProtocolSCTP {
+		t.Errorf("unexpected container ports %+v", container.Ports)
+	}
+}
+
+func TestOpen5GSReconcileFunctions(t *testing.T) {
+	ctx := context.Background()
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default", UID: "uid"}}
+	r := newTestOpen5GSReconciler(t, open5gs)
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(open5gs)}
+
+	reconcileUntilReady(t, r, request)
+	for _, nf := range networkFunctions {
+		err := r.Get(ctx, client.ObjectKey{Name: nf.resourceName(open5gs), Namespace: "default"}, &appsv1.Deployment{})
+		if nf.DisabledByDefault != errors.IsNotFound(err) {
+			t.Errorf("%s: unexpected Deployment lookup result %v", nf.Name, err)
+		}
+	}
+	if err := r.Get(ctx, client.ObjectKey{Name: "open5gs-upf-entrypoint", Namespace: "default"}, &corev1.ConfigMap{}); err != nil {
+		t.Errorf("expected the UPF entrypoint ConfigMap: %v", err)
+	}
+
+	// Disabling a function deletes its resources, including the extra ones
+	if err := r.Get(ctx, request.NamespacedName, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	open5gs.Spec.UPF.Enabled = boolPtr(false)
+	if err := r.Update(ctx, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	for _, name := range []string{"open5gs-upf", "open5gs-upf-entrypoint"} {
+		if err := r.Get(ctx, client.ObjectKey{Name: name, Namespace: "default"}, &corev1.ConfigMap{}); !errors.IsNotFound(err) {
+			t.Errorf("expected ConfigMap %s to be deleted, got %v", name, err)
+		}
+	}
+	if err := r.Get(ctx, client.ObjectKey{Name: "open5gs-upf", Namespace: "default"}, &appsv1.Deployment{}); !errors.IsNotFound(err) {
+		t.Errorf("expected the UPF Deployment to be deleted, got %v", err)
+	}
+}
+
+func TestOpen5GSStartupOrder(t *testing.T) {
+	ctx := context.Background()
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default", UID: "uid"}}
+	open5gs.Spec.SCP.Enabled = boolPtr(false)
+	r := newTestOpen5GSReconciler(t, open5gs)
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(open5gs)}
+	phases := func() map[string]netv1.Open5GSFunctionStatus {
+		t.Helper()
+		if _, err := r.Reconcile(ctx, request); err != nil {
+			t.Fatalf("Reconcile returned error: %v", err)
+		}
+		if err := r.Get(ctx, request.NamespacedName, open5gs); err != nil {
+			t.Fatal(err)
+		}
+		result := map[string]netv1.Open5GSFunctionStatus{}
+		for _, function := range open5gs.Status.Functions {
+			result[function.Name] = function
+		}
+		return result
+	}
+
+	// Only MongoDB is created on the first pass
+	status := phases()
+	if status["MongoDB"].Phase != netv1.FunctionPhaseProgressing {
+		t.Errorf("expected MongoDB to be progressing, got %+v", status["MongoDB"])
+	}
+	if nrf := status["NRF"]; nrf.Phase != netv1.FunctionPhaseWaiting || len(nrf.WaitingFor) != 1 || nrf.WaitingFor[0] != "MongoDB" {
+		t.Errorf("expected the NRF to wait for MongoDB, got %+v", nrf)
+	}
+	if err := r.Get(ctx, client.ObjectKey{Name: "open5gs-nrf", Namespace: "default"}, &appsv1.Deployment{}); !errors.IsNotFound(err) {
+		t.Errorf("expected the NRF Deployment not to be created yet, got %v", err)
+	}
+	if open5gs.Status.Ready {
+		t.Error("expected the instance not to be ready")
+	}
+
+	markAvailable(t, r, "open5gs-mongodb")
+	status = phases()
+	if status["NRF"].Phase != netv1.FunctionPhaseProgressing {
+		t.Errorf("expected the NRF to be created, got %+v", status["NRF"])
+	}
+	// With the SCP disabled, its dependents wait for the NRF instead
+	if amf := status["AMF"]; len(amf.WaitingFor) != 1 || amf.WaitingFor[0] != "NRF" {
+		t.Errorf("expected the AMF to wait for the NRF, got %+v", amf)
+	}
+	if _, ok := status["SCP"]; ok {
+		t.Error("expected no status for the disabled SCP")
+	}
+
+	markAvailable(t, r, "open5gs-nrf")
+	status = phases()
+	if smf := status["SMF"]; smf.Phase != netv1.FunctionPhaseWaiting || len(smf.WaitingFor) != 1 || smf.WaitingFor[0] != "UPF" {
+		t.Errorf("expected the SMF to wait for the UPF, got %+v", smf)
+	}
+	if status["UDR"].Phase != netv1.FunctionPhaseProgressing {
+		t.Errorf("expected the UDR to be created, got %+v", status["UDR"])
+	}
+
+	markAvailable(t, r, "open5gs-upf")
+	if phases()["SMF"].Phase != netv1.FunctionPhaseProgressing {
+		t.Error("expected the SMF to be created once the UPF is available")
+	}
+
+	reconcileUntilReady(t, r, request)
+	if err := r.Get(ctx, request.NamespacedName, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	if !open5gs.Status.Ready {
+		t.Errorf("expected the instance to be ready, got %+v", open5gs.Status.Functions)
+	}
+}
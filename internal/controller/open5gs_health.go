@@ -0,0 +1,109 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+)
+
+// FunctionHealthChecks runs the health checks of the network functions of an
+// instance during an upgrade of its Open5GS image
+type FunctionHealthChecks interface {
+	// Check returns an error when the function fails the check
+	Check(ctx context.Context, open5gs *netv1.Open5GS, function string, check netv1.Open5GSHealthCheck) error
+}
+
+// NetworkHealthChecks runs the health checks against the Services of the
+// instance, so the operator must be able to reach them. Functions without an
+// SBI, such as the UPF, pass every check.
+type NetworkHealthChecks struct {
+	// Timeout of each check
+	Timeout time.Duration
+}
+
+func (c NetworkHealthChecks) Check(ctx context.Context, open5gs *netv1.Open5GS, function string, check netv1.Open5GSHealthCheck) error {
+	nf, ok := functionByName(function)
+	if !ok {
+		return fmt.Errorf("unknown network function %s", function)
+	}
+	if !nf.hasSBI() {
+		return nil
+	}
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+
+	switch check {
+	case netv1.HealthCheckSBI:
+		dialer := &net.Dialer{Timeout: timeout}
+		conn, err := dialer.DialContext(ctx, "tcp", sbiAddress(open5gs, function))
+		if err != nil {
+			return fmt.Errorf("the SBI of the %s is not reachable: %w", function, err)
+		}
+		return conn.Close()
+	case netv1.HealthCheckNRFRegistration:
+		if function == "NRF" {
+			return nil
+		}
+		instances, err := nrfInstances(ctx, open5gs, function, timeout)
+		if err != nil {
+			return fmt.Errorf("failed to query the NRF: %w", err)
+		}
+		if instances == 0 {
+			return fmt.Errorf("the %s is not registered in the NRF", function)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown health check %s", check)
+	}
+}
+
+// sbiAddress returns the address of the SBI Service of the function
+func sbiAddress(open5gs *netv1.Open5GS, function string) string {
+	return fmt.Sprintf("%s-%s-sbi.%s.svc:%d", open5gs.Name, strings.ToLower(function), open5gs.Namespace, sbiPort.Port)
+}
+
+// nrfInstances returns the number of instances of the function type
+// registered in the NRF of the instance. The SBI of Open5GS only speaks
+// HTTP/2 without TLS.
+func nrfInstances(ctx context.Context, open5gs *netv1.Open5GS, function string, timeout time.Duration) (int, error) {
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Timeout: timeout, Transport: &http.Transport{Protocols: protocols}}
+
+	url := "http://" + sbiAddress(open5gs, "NRF") + "/nnrf-nfm/v1/nf-instances?nf-type=" + function
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status %s", response.Status)
+	}
+	var result struct {
+		Links struct {
+			Items []json.RawMessage `json:"items"`
+		} `json:"_links"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+	return len(result.Links.Items), nil
+}
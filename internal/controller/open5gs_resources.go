@@ -19,6 +19,12 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+// UE address pool assigned by the SMF and routed by the UPF
+const (
+	ueSubnetIPv4  = "10.45.0.0/16"
+	ueGatewayIPv4 = "10.45.0.1"
+)
+
 func CreateService(namespace, open5gsName, functionName string, protocol string, port int32, l4_protocol corev1.Protocol, args ...interface{}) *corev1.Service {
 	labels := map[string]string{
 		"app.kubernetes.io/instance": open5gsName,
@@ -414,8 +420,8 @@ smf:
   session:
     -
       dnn: internet
-      gateway: 10.45.0.1
-      subnet: 10.45.0.0/16
+      gateway: ` + ueGatewayIPv4 + `
+      subnet: ` + ueSubnetIPv4 + `
   dns:
     -
       8.8.8.8
@@ -611,8 +617,8 @@ upf:
     -
       dev: ogstun
       dnn: internet
-      gateway: 10.45.0.1
-      subnet: 10.45.0.0/16
+      gateway: ` + ueGatewayIPv4 + `
+      subnet: ` + ueSubnetIPv4 + `
 `,
 		},
 	}
@@ -0,0 +1,219 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// maxReportedIMSIs bounds the number of unmanaged IMSIs kept in the status
+const maxReportedIMSIs = 100
+
+// Open5GSSubscribersReconciler looks for subscribers of an Open5GS instance
+// that no Open5GSUser or Open5GSUserPool manages, and reports or deletes them
+// according to the subscriber policy of the instance
+type Open5GSSubscribersReconciler struct {
+	client.Client
+	Scheme      *runtime.Scheme
+	Subscribers SubscriberStores
+	// ResyncPeriod is the interval between scans of each instance. It is
+	// jittered; zero limits the scans to spec changes.
+	ResyncPeriod time.Duration
+}
+
+//+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gses,verbs=get;list;watch
+//+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gses/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gsusers,verbs=get;list;watch
+//+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gsuserpools,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch
+
+func (r *Open5GSSubscribersReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	open5gs := &netv1.Open5GS{}
+	if err := r.Get(ctx, req.NamespacedName, open5gs); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !open5gs.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	policy := open5gs.Spec.SubscriberPolicy
+	if policy == "" || policy == netv1.SubscriberPolicyIgnore {
+		if err := r.patchSubscribersStatus(ctx, open5gs, nil); err != nil {
+			logger.Error(err, "Failed to update Open5GS status")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	store, err := r.Subscribers.Store(ctx, req.NamespacedName)
+	if err != nil {
+		logger.Info("MongoDB not available. Skipping unmanaged subscribers scan.", "reason", err.Error())
+		return resyncResult(r.ResyncPeriod), nil
+	}
+	// A paused instance is only reported on
+	prune := policy == netv1.SubscriberPolicyPrune && !instancePaused(open5gs)
+	status, err := r.scanSubscribers(ctx, open5gs, store, prune, logger)
+	if err != nil {
+		logger.Error(err, "Failed to scan subscribers")
+		return ctrl.Result{}, err
+	}
+	if err := r.patchSubscribersStatus(ctx, open5gs, status); err != nil {
+		logger.Error(err, "Failed to update Open5GS status")
+		return ctrl.Result{}, err
+	}
+	return resyncResult(r.ResyncPeriod), nil
+}
+
+// patchSubscribersStatus writes the result of a scan to the status of the
+// instance, unless it is the same as the one of the previous scan
+func (r *Open5GSSubscribersReconciler) patchSubscribersStatus(ctx context.Context, open5gs *netv1.Open5GS, status *netv1.Open5GSSubscribersStatus) error {
+	if current := open5gs.Status.Subscribers; current == nil || status == nil {
+		if current == status {
+			return nil
+		}
+	} else {
+		unchanged := status.DeepCopy()
+		unchanged.LastScanTime = current.LastScanTime
+		if equality.Semantic.DeepEqual(unchanged, current) {
+			return nil
+		}
+	}
+	original := open5gs.DeepCopy()
+	open5gs.Status.Subscribers = status
+	return r.Status().Patch(ctx, open5gs, client.MergeFrom(original))
+}
+
+// scanSubscribers counts the managed and unmanaged subscribers of the
+// instance and deletes the unmanaged ones if prune is set
+func (r *Open5GSSubscribersReconciler) scanSubscribers(ctx context.Context, open5gs *netv1.Open5GS, store SubscriberStore, prune bool, logger logr.Logger) (*netv1.Open5GSSubscribersStatus, error) {
+	// Subscribers are listed before the resources that manage them, so that a
+	// subscriber written for a resource created in between is never pruned
+	subscribers, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	managed, err := managedIMSIs(ctx, r.Client, open5gs)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &netv1.Open5GSSubscribersStatus{}
+	var unmanaged []string
+	for _, subscriber := range subscribers {
+		imsi, _ := subscriber["imsi"].(string)
+		if imsi == "" {
+			continue
+		}
+		if managed[imsi] {
+			status.Managed++
+		} else if subscriber[retainedField] != nil {
+			status.Retained++
+		} else {
+			unmanaged = append(unmanaged, imsi)
+		}
+	}
+	sort.Strings(unmanaged)
+
+	if prune && len(unmanaged) > 0 {
+		deleted, err := store.Delete(ctx, unmanaged...)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("Unmanaged subscribers pruned", "count", deleted)
+		status.Pruned = int32(deleted)
+		unmanaged = nil
+	} else if len(unmanaged) > 0 {
+		logger.Info("Unmanaged subscribers found", "count", len(unmanaged))
+	}
+
+	status.Unmanaged = int32(len(unmanaged))
+	if len(unmanaged) > maxReportedIMSIs {
+		unmanaged = unmanaged[:maxReportedIMSIs]
+	}
+	status.UnmanagedIMSIs = unmanaged
+	now := metav1.Now()
+	status.LastScanTime = &now
+	return status, nil
+}
+
+// managedIMSIs returns the IMSIs of the Open5GSUsers and Open5GSUserPools
+// allowed to reference the instance
+func managedIMSIs(ctx context.Context, c client.Reader, open5gs *netv1.Open5GS) (map[string]bool, error) {
+	key := client.ObjectKeyFromObject(open5gs)
+	managed := make(map[string]bool)
+
+	var users netv1.Open5GSUserList
+	if err := c.List(ctx, &users); err != nil {
+		return nil, err
+	}
+	for i := range users.Items {
+		user := &users.Items[i]
+		if open5gsKey(user) == key && referenceAllowed(open5gs, user.Namespace) {
+			managed[user.Spec.IMSI] = true
+			// The subscriber of the previous IMSI is kept until the user has
+			// moved it to the new one
+			if user.Status.IMSI != "" {
+				managed[user.Status.IMSI] = true
+			}
+		}
+	}
+
+	var pools netv1.Open5GSUserPoolList
+	if err := c.List(ctx, &pools); err != nil {
+		return nil, err
+	}
+	for i := range pools.Items {
+		pool := &pools.Items[i]
+		if poolOpen5GSKey(pool) != key || !referenceAllowed(open5gs, pool.Namespace) {
+			continue
+		}
+		// Both the requested range and the one still provisioned are managed,
+		// so that a pool being resized keeps all of its subscribers
+		for _, imsis := range [][]string{poolIMSIs(pool.Spec.IMSIStart, pool.Spec.Count), poolIMSIs(pool.Status.IMSIStart, pool.Status.Count)} {
+			for _, imsi := range imsis {
+				managed[imsi] = true
+			}
+		}
+	}
+	return managed, nil
+}
+
+// poolIMSIs is imsiRange ignoring invalid ranges, which provision nothing
+func poolIMSIs(start string, count int32) []string {
+	if start == "" || count <= 0 {
+		return nil
+	}
+	imsis, err := imsiRange(start, count)
+	if err != nil {
+		return nil
+	}
+	return imsis
+}
+
+func (r *Open5GSSubscribersReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Subscribers == nil {
+		r.Subscribers = &MongoSubscriberStores{Client: mgr.GetClient(), Clients: NewMongoClients()}
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("open5gs-subscribers").
+		For(&netv1.Open5GS{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
@@ -0,0 +1,134 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestOpen5GSSubscribersPolicy(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = netv1.AddToScheme(scheme)
+
+	open5gs := &netv1.Open5GS{
+		ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default"},
+		Spec:       netv1.Open5GSSpec{SubscriberPolicy: netv1.SubscriberPolicyReport},
+	}
+	user := &netv1.Open5GSUser{
+		ObjectMeta: metav1.ObjectMeta{Name: "user", Namespace: "default"},
+		Spec: netv1.Open5GSUserSpec{
+			IMSI:    "999700000000001",
+			Open5GS: netv1.Open5GSReference{Name: "open5gs", Namespace: "default"},
+		},
+		// The user is moving its subscriber from this IMSI
+		Status: netv1.Open5GSUserStatus{IMSI: "999700000000004"},
+	}
+	pool := &netv1.Open5GSUserPool{
+		ObjectMeta: metav1.ObjectMeta{Name: "pool", Namespace: "default"},
+		Spec: netv1.Open5GSUserPoolSpec{
+			IMSIStart: "999700000000100",
+			Count:     2,
+			Open5GS:   netv1.Open5GSReference{Name: "open5gs", Namespace: "default"},
+		},
+	}
+	stores := NewMemorySubscriberStores()
+	store := stores.For(client.ObjectKeyFromObject(open5gs))
+	for _, imsi := range []string{"999700000000001", "999700000000004", "999700000000100", "999700000000101", "999700000000002", "999700000000003"} {
+		if err := store.Insert(ctx, bson.M{"imsi": imsi}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Left behind by a user deleted with deletionPolicy Retain
+	retained := bson.M{"imsi": "999700000000005", retainedField: bson.M{"policy": netv1.DeletionPolicyRetain, "user": "default/gone"}}
+	if err := store.Insert(ctx, retained); err != nil {
+		t.Fatal(err)
+	}
+	reconciler := &Open5GSSubscribersReconciler{
+		Client:      fake.NewClientBuilder().WithScheme(scheme).WithObjects(open5gs, user, pool).WithStatusSubresource(&netv1.Open5GS{}).Build(),
+		Scheme:      scheme,
+		Subscribers: stores,
+	}
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(open5gs)}
+
+	if _, err := reconciler.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if err := reconciler.Get(ctx, request.NamespacedName, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	status := open5gs.Status.Subscribers
+	if status == nil || status.Managed != 4 || status.Retained != 1 || status.Unmanaged != 2 || len(status.UnmanagedIMSIs) != 2 || status.UnmanagedIMSIs[0] != "999700000000002" {
+		t.Fatalf("unexpected report %+v", status)
+	}
+	if subscribers, _ := store.List(ctx); len(subscribers) != 7 {
+		t.Errorf("expected Report to keep unmanaged subscribers, %d left", len(subscribers))
+	}
+
+	resourceVersion := open5gs.ResourceVersion
+	if _, err := reconciler.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if err := reconciler.Get(ctx, request.NamespacedName, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	if open5gs.ResourceVersion != resourceVersion {
+		t.Error("expected an unchanged report not to be written again")
+	}
+
+	open5gs.Spec.SubscriberPolicy = netv1.SubscriberPolicyPrune
+	if err := reconciler.Update(ctx, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reconciler.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if err := reconciler.Get(ctx, request.NamespacedName, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	if status := open5gs.Status.Subscribers; status.Pruned != 2 || status.Unmanaged != 0 || status.Retained != 1 {
+		t.Errorf("unexpected prune result %+v", status)
+	}
+	if _, err := store.Get(ctx, "999700000000002"); err != ErrSubscriberNotFound {
+		t.Errorf("expected the unmanaged subscriber to be pruned, got %v", err)
+	}
+	if _, err := store.Get(ctx, "999700000000101"); err != nil {
+		t.Errorf("expected the pool subscriber to be kept, got %v", err)
+	}
+	if _, err := store.Get(ctx, "999700000000004"); err != nil {
+		t.Errorf("expected the subscriber of the previous IMSI of the user to be kept, got %v", err)
+	}
+	if _, err := store.Get(ctx, "999700000000005"); err != nil {
+		t.Errorf("expected the retained subscriber to be kept, got %v", err)
+	}
+
+	open5gs.Spec.SubscriberPolicy = netv1.SubscriberPolicyIgnore
+	if err := reconciler.Update(ctx, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reconciler.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if err := reconciler.Get(ctx, request.NamespacedName, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	if open5gs.Status.Subscribers != nil {
+		t.Errorf("expected the report to be cleared with Ignore, got %+v", open5gs.Status.Subscribers)
+	}
+}
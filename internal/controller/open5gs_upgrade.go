@@ -0,0 +1,228 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/go-logr/logr"
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// upgradePollInterval is how often the function being upgraded is checked
+	upgradePollInterval = 5 * time.Second
+	// defaultFunctionTimeout is how long a function may take to be upgraded
+	defaultFunctionTimeout = 300 * time.Second
+)
+
+// upgradeOrder returns the functions running the Open5GS image in the order
+// they are upgraded
+func upgradeOrder() []networkFunction {
+	var first, last []networkFunction
+	for _, nf := range networkFunctions {
+		switch {
+		case nf.OwnImage:
+		case nf.UpgradeLast:
+			last = append(last, nf)
+		default:
+			first = append(first, nf)
+		}
+	}
+	return append(first, last...)
+}
+
+// functionImage returns the Open5GS image the function must run: the new
+// image once its turn in an upgrade has come, the previous one otherwise
+func functionImage(open5gs *netv1.Open5GS, nf networkFunction) string {
+	upgrade := open5gs.Status.Upgrade
+	if upgrade == nil || (upgrade.Phase != netv1.UpgradePhaseProgressing && upgrade.Phase != netv1.UpgradePhasePaused) {
+		return open5gs.Status.Open5GSImage
+	}
+	if nf.Name == upgrade.Function || slices.Contains(upgrade.UpgradedFunctions, nf.Name) {
+		return upgrade.ToImage
+	}
+	return upgrade.FromImage
+}
+
+// advanceUpgrade starts, moves forward or fails the upgrade of the Open5GS
+// image of the instance, recording it in its status. It returns how soon the
+// instance must be reconciled again.
+func (r *Open5GSReconciler) advanceUpgrade(ctx context.Context, open5gs *netv1.Open5GS, logger logr.Logger) (time.Duration, error) {
+	status := &open5gs.Status
+	target := open5gs.Spec.Open5GSImage
+	if status.Open5GSImage == "" {
+		// New instances, and the ones created before upgrades were tracked,
+		// start on the image of their spec
+		status.Open5GSImage = target
+		return 0, nil
+	}
+
+	upgrade := status.Upgrade
+	inProgress := upgrade != nil && (upgrade.Phase == netv1.UpgradePhaseProgressing || upgrade.Phase == netv1.UpgradePhasePaused)
+	if target == status.Open5GSImage {
+		if inProgress {
+			logger.Info("Open5GS upgrade cancelled", "from", upgrade.FromImage, "to", upgrade.ToImage)
+			r.Recorder.Eventf(open5gs, nil, corev1.EventTypeNormal, "UpgradeCancelled", "Upgrade", "Upgrade to %s cancelled", upgrade.ToImage)
+			upgrade.Phase = netv1.UpgradePhaseRolledBack
+			upgrade.Function = ""
+			upgrade.FunctionStartTime = nil
+			upgrade.Message = "Cancelled, open5gsImage was set back to " + target
+		}
+		return 0, nil
+	}
+	if upgrade == nil || upgrade.ToImage != target || upgrade.FromImage != status.Open5GSImage {
+		logger.Info("Upgrading the Open5GS image", "from", status.Open5GSImage, "to", target)
+		r.Recorder.Eventf(open5gs, nil, corev1.EventTypeNormal, "UpgradeStarted", "Upgrade", "Upgrading from %s to %s", status.Open5GSImage, target)
+		upgrade = &netv1.Open5GSUpgradeStatus{
+			FromImage: status.Open5GSImage,
+			ToImage:   target,
+			Phase:     netv1.UpgradePhaseProgressing,
+		}
+		status.Upgrade = upgrade
+	}
+	if upgrade.Phase != netv1.UpgradePhaseProgressing {
+		// A failed upgrade waits for a new image, or for the previous one
+		return 0, nil
+	}
+
+	for {
+		if upgrade.Function == "" {
+			next := nextUpgradeFunction(upgrade)
+			if next == "" {
+				logger.Info("Open5GS upgrade completed", "image", target)
+				r.Recorder.Eventf(open5gs, nil, corev1.EventTypeNormal, "UpgradeCompleted", "Upgrade", "Upgrade to %s completed", target)
+				upgrade.Phase = netv1.UpgradePhaseCompleted
+				upgrade.FunctionStartTime = nil
+				upgrade.Message = ""
+				status.Open5GSImage = target
+				return 0, nil
+			}
+			logger.Info("Upgrading network function", "component", next, "image", target)
+			now := metav1.Now()
+			upgrade.Function = next
+			upgrade.FunctionStartTime = &now
+			upgrade.Message = ""
+			return upgradePollInterval, nil
+		}
+
+		nf, ok := functionByName(upgrade.Function)
+		if !ok {
+			upgrade.Function = ""
+			continue
+		}
+		if functionPaused(open5gs, nf) {
+			upgrade.Message = "Waiting for the " + nf.Name + " to be resumed"
+			upgrade.FunctionStartTime = nil
+			return upgradePollInterval, nil
+		}
+		if upgrade.FunctionStartTime == nil {
+			// The function, or the whole instance, was resumed
+			now := metav1.Now()
+			upgrade.FunctionStartTime = &now
+		}
+		message, err := r.functionUpgraded(ctx, open5gs, nf, target)
+		if err != nil {
+			return 0, err
+		}
+		if message == "" {
+			upgrade.UpgradedFunctions = append(upgrade.UpgradedFunctions, nf.Name)
+			upgrade.Function = ""
+			continue
+		}
+		upgrade.Message = message
+
+		timeout := defaultFunctionTimeout
+		if seconds := open5gs.Spec.Upgrade.FunctionTimeoutSeconds; seconds != nil {
+			timeout = time.Duration(*seconds) * time.Second
+		}
+		if upgrade.FunctionStartTime != nil && time.Since(upgrade.FunctionStartTime.Time) > timeout {
+			upgrade.Message = fmt.Sprintf("The %s was not available and healthy after %s: %s", nf.Name, timeout, message)
+			if open5gs.Spec.Upgrade.OnFailure == netv1.UpgradeOnFailureRollback {
+				logger.Info("Open5GS upgrade failed, rolling back", "component", nf.Name, "image", upgrade.FromImage, "reason", message)
+				r.Recorder.Eventf(open5gs, nil, corev1.EventTypeWarning, "UpgradeRolledBack", "Upgrade", "%s. Rolling back to %s", upgrade.Message, upgrade.FromImage)
+				upgrade.Phase = netv1.UpgradePhaseRolledBack
+				upgrade.Function = ""
+				upgrade.FunctionStartTime = nil
+			} else {
+				logger.Info("Open5GS upgrade failed, pausing it", "component", nf.Name, "reason", message)
+				r.Recorder.Eventf(open5gs, nil, corev1.EventTypeWarning, "UpgradePaused", "Upgrade", "%s. Upgrade paused", upgrade.Message)
+				upgrade.Phase = netv1.UpgradePhasePaused
+			}
+			return 0, nil
+		}
+		return upgradePollInterval, nil
+	}
+}
+
+// nextUpgradeFunction returns the next function to upgrade, or "" once they
+// have all been upgraded
+func nextUpgradeFunction(upgrade *netv1.Open5GSUpgradeStatus) string {
+	for _, nf := range upgradeOrder() {
+		if !slices.Contains(upgrade.UpgradedFunctions, nf.Name) {
+			return nf.Name
+		}
+	}
+	return ""
+}
+
+// functionUpgraded tells whether the function runs the image and passes its
+// health checks. It returns what it is waiting for, or "" once it does.
+// Disabled functions and those not created yet have nothing to wait for.
+func (r *Open5GSReconciler) functionUpgraded(ctx context.Context, open5gs *netv1.Open5GS, nf networkFunction, image string) (string, error) {
+	if !*nf.Spec(&open5gs.Spec).Enabled {
+		return "", nil
+	}
+	deployment := &appsv1.Deployment{}
+	err := r.Get(ctx, client.ObjectKey{Name: nf.resourceName(open5gs), Namespace: open5gs.Namespace}, deployment)
+	if errors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !deploymentRolledOut(deployment, image) {
+		return "Waiting for the Deployment of the " + nf.Name + " to roll out", nil
+	}
+	if r.HealthChecks == nil {
+		return "", nil
+	}
+	for _, check := range open5gs.Spec.Upgrade.HealthChecks {
+		if err := r.HealthChecks.Check(ctx, open5gs, nf.Name, check); err != nil {
+			return fmt.Sprintf("Health check %s failed: %v", check, err), nil
+		}
+	}
+	return "", nil
+}
+
+// deploymentRolledOut tells whether every replica of the Deployment runs the
+// image and the Deployment is available
+func deploymentRolledOut(deployment *appsv1.Deployment, image string) bool {
+	runsImage := false
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		if container.Image == image {
+			runsImage = true
+		}
+	}
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return runsImage &&
+		deployment.Status.ObservedGeneration >= deployment.Generation &&
+		deployment.Status.UpdatedReplicas == replicas &&
+		deployment.Status.Replicas == replicas &&
+		deploymentAvailable(deployment)
+}
@@ -0,0 +1,194 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	previousImage = "docker.io/gradiant/open5gs:2.7.5"
+	nextImage     = "docker.io/gradiant/open5gs:2.7.6"
+)
+
+// fakeHealthChecks fails every check of the listed functions
+type fakeHealthChecks map[string]bool
+
+func (f fakeHealthChecks) Check(_ context.Context, _ *netv1.Open5GS, function string, _ netv1.Open5GSHealthCheck) error {
+	if f[function] {
+		return errors.New("not registered")
+	}
+	return nil
+}
+
+// startUpgrade brings up an instance on the previous image and sets the next
+// one in its spec
+func startUpgrade(t *testing.T, upgrade netv1.Open5GSUpgradeStrategy, failing fakeHealthChecks) (*Open5GSReconciler, ctrl.Request) {
+	t.Helper()
+	ctx := context.Background()
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default", UID: "uid"}}
+	open5gs.Spec.Upgrade = upgrade
+	r := newTestOpen5GSReconciler(t, open5gs)
+	r.HealthChecks = failing
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(open5gs)}
+	reconcileUntilReady(t, r, request)
+
+	if err := r.Get(ctx, request.NamespacedName, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	if open5gs.Status.Open5GSImage != previousImage {
+		t.Fatalf("expected the instance to run %s, got %q", previousImage, open5gs.Status.Open5GSImage)
+	}
+	open5gs.Spec.Open5GSImage = nextImage
+	if err := r.Update(ctx, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	return r, request
+}
+
+// upgradeStep reconciles the instance, rolls out its Deployments and returns
+// its upgrade status
+func upgradeStep(t *testing.T, r *Open5GSReconciler, request ctrl.Request) *netv1.Open5GSUpgradeStatus {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	var deployments appsv1.DeploymentList
+	if err := r.List(ctx, &deployments); err != nil {
+		t.Fatal(err)
+	}
+	for _, deployment := range deployments.Items {
+		markAvailable(t, r, deployment.Name)
+	}
+	open5gs := &netv1.Open5GS{}
+	if err := r.Get(ctx, request.NamespacedName, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	return open5gs.Status.Upgrade
+}
+
+func functionImages(t *testing.T, r *Open5GSReconciler) map[string]string {
+	t.Helper()
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default"}}
+	images := map[string]string{}
+	for _, nf := range upgradeOrder() {
+		deployment := &appsv1.Deployment{}
+		if err := r.Get(context.Background(), client.ObjectKey{Name: nf.resourceName(open5gs), Namespace: "default"}, deployment); err != nil {
+			t.Fatal(err)
+		}
+		images[nf.Name] = deployment.Spec.Template.Spec.Containers[0].Image
+	}
+	return images
+}
+
+func TestOpen5GSUpgrade(t *testing.T) {
+	r, request := startUpgrade(t, netv1.Open5GSUpgradeStrategy{HealthChecks: []netv1.Open5GSHealthCheck{netv1.HealthCheckNRFRegistration}}, nil)
+
+	// The NRF goes first, alone
+	upgrade := upgradeStep(t, r, request)
+	if upgrade == nil || upgrade.Phase != netv1.UpgradePhaseProgressing || upgrade.Function != "NRF" {
+		t.Fatalf("expected the upgrade of the NRF, got %+v", upgrade)
+	}
+	images := functionImages(t, r)
+	if images["NRF"] != nextImage || images["AMF"] != previousImage || images["UPF"] != previousImage {
+		t.Errorf("expected only the NRF on the new image, got %v", images)
+	}
+
+	for range networkFunctions {
+		if upgrade = upgradeStep(t, r, request); upgrade.Phase != netv1.UpgradePhaseProgressing {
+			break
+		}
+	}
+	if upgrade.Phase != netv1.UpgradePhaseCompleted {
+		t.Fatalf("expected the upgrade to complete, got %+v", upgrade)
+	}
+	var order []string
+	for _, nf := range upgradeOrder() {
+		order = append(order, nf.Name)
+	}
+	if !slices.Equal(upgrade.UpgradedFunctions, order) || order[len(order)-1] != "UPF" || order[0] != "NRF" || order[1] != "SCP" {
+		t.Errorf("unexpected upgrade order %v", upgrade.UpgradedFunctions)
+	}
+	for name, image := range functionImages(t, r) {
+		if image != nextImage {
+			t.Errorf("expected the %s on the new image, got %s", name, image)
+		}
+	}
+	open5gs := &netv1.Open5GS{}
+	if err := r.Get(context.Background(), request.NamespacedName, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	if open5gs.Status.Open5GSImage != nextImage {
+		t.Errorf("expected the instance to run the new image, got %s", open5gs.Status.Open5GSImage)
+	}
+}
+
+// failUpgrade moves the upgrade to the AMF, whose health checks fail, and
+// expires its timeout
+func failUpgrade(t *testing.T, onFailure string) (*Open5GSReconciler, ctrl.Request, *netv1.Open5GSUpgradeStatus) {
+	t.Helper()
+	ctx := context.Background()
+	strategy := netv1.Open5GSUpgradeStrategy{HealthChecks: []netv1.Open5GSHealthCheck{netv1.HealthCheckSBI}, OnFailure: onFailure}
+	r, request := startUpgrade(t, strategy, fakeHealthChecks{"AMF": true})
+	var upgrade *netv1.Open5GSUpgradeStatus
+	for range networkFunctions {
+		if upgrade = upgradeStep(t, r, request); upgrade.Function == "AMF" && upgrade.Message != "" {
+			break
+		}
+	}
+	if upgrade.Function != "AMF" || upgrade.Phase != netv1.UpgradePhaseProgressing {
+		t.Fatalf("expected the upgrade to wait for the AMF, got %+v", upgrade)
+	}
+
+	open5gs := &netv1.Open5GS{}
+	if err := r.Get(ctx, request.NamespacedName, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	expired := metav1.NewTime(time.Now().Add(-time.Hour))
+	open5gs.Status.Upgrade.FunctionStartTime = &expired
+	if err := r.Status().Update(ctx, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	return r, request, upgradeStep(t, r, request)
+}
+
+func TestOpen5GSUpgradePause(t *testing.T) {
+	r, request, upgrade := failUpgrade(t, netv1.UpgradeOnFailurePause)
+	if upgrade.Phase != netv1.UpgradePhasePaused || upgrade.Message == "" {
+		t.Fatalf("expected the upgrade to be paused, got %+v", upgrade)
+	}
+	images := functionImages(t, r)
+	if images["NRF"] != nextImage || images["AMF"] != nextImage || images["UPF"] != previousImage {
+		t.Errorf("expected the upgrade to stop at the AMF, got %v", images)
+	}
+	if upgrade = upgradeStep(t, r, request); upgrade.Phase != netv1.UpgradePhasePaused {
+		t.Errorf("expected the upgrade to stay paused, got %+v", upgrade)
+	}
+}
+
+func TestOpen5GSUpgradeRollback(t *testing.T) {
+	r, _, upgrade := failUpgrade(t, netv1.UpgradeOnFailureRollback)
+	if upgrade.Phase != netv1.UpgradePhaseRolledBack {
+		t.Fatalf("expected the upgrade to be rolled back, got %+v", upgrade)
+	}
+	for name, image := range functionImages(t, r) {
+		if image != previousImage {
+			t.Errorf("expected the %s back on the previous image, got %s", name, image)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestIgnoreStatusUpdates(t *testing.T) {
+	replicas := int32(1)
+	old := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "open5gs-amf", Namespace: "default", ResourceVersion: "1"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+	}
+
+	statusOnly := old.DeepCopy()
+	statusOnly.ResourceVersion = "2"
+	statusOnly.Status.ReadyReplicas = 1
+	if ignoreStatusUpdates.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: statusOnly}) {
+		t.Error("expected a status-only update to be ignored")
+	}
+
+	scaled := old.DeepCopy()
+	scaled.ResourceVersion = "2"
+	scaled.Spec.Replicas = new(int32)
+	if !ignoreStatusUpdates.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: scaled}) {
+		t.Error("expected a spec update to trigger a reconciliation")
+	}
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "open5gs-amf", Namespace: "default", ResourceVersion: "1"},
+		Data:       map[string]string{"amf.yaml": "a"},
+	}
+	edited := configMap.DeepCopy()
+	edited.ResourceVersion = "2"
+	edited.Data["amf.yaml"] = "b"
+	if !ignoreStatusUpdates.Update(event.UpdateEvent{ObjectOld: configMap, ObjectNew: edited}) {
+		t.Error("expected a ConfigMap edit to trigger a reconciliation")
+	}
+}
+
+func TestDeploymentAvailabilityChanges(t *testing.T) {
+	old := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "open5gs-nrf", Namespace: "default"}}
+	progressing := old.DeepCopy()
+	progressing.Status.UpdatedReplicas = 1
+	if deploymentAvailabilityChanges.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: progressing}) {
+		t.Error("expected a status update without availability change to be ignored")
+	}
+	available := progressing.DeepCopy()
+	available.Status.Conditions = []appsv1.DeploymentCondition{{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue}}
+	if !deploymentAvailabilityChanges.Update(event.UpdateEvent{ObjectOld: progressing, ObjectNew: available}) {
+		t.Error("expected a Deployment becoming available to trigger a reconciliation")
+	}
+}
@@ -0,0 +1,92 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"context"
+
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Open5GSSubscriberProfileReconciler reports the rollout of each profile to
+// the Open5GSUsers referencing it. The subscribers themselves are rewritten by
+// the Open5GSUser controller.
+type Open5GSSubscriberProfileReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gssubscriberprofiles,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gssubscriberprofiles/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gsusers,verbs=get;list;watch
+
+func (r *Open5GSSubscriberProfileReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	profile := &netv1.Open5GSSubscriberProfile{}
+	if err := r.Get(ctx, req.NamespacedName, profile); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	users, err := profileUsers(ctx, r.Client, profile.Namespace, profile.Name)
+	if err != nil {
+		logger.Error(err, "Failed to list the users of the profile")
+		return ctrl.Result{}, err
+	}
+	status := netv1.Open5GSSubscriberProfileStatus{ObservedGeneration: profile.Generation}
+	for _, user := range users {
+		status.Users++
+		if user.Status.ProfileGeneration == profile.Generation {
+			status.UpdatedUsers++
+		}
+	}
+	if status == profile.Status {
+		return ctrl.Result{}, nil
+	}
+	profile.Status = status
+	if err := r.Status().Update(ctx, profile); err != nil {
+		logger.Error(err, "Failed to update Open5GSSubscriberProfile status")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// profileUsers returns the Open5GSUsers of the namespace that reference the
+// profile
+func profileUsers(ctx context.Context, c client.Reader, namespace, profile string) ([]netv1.Open5GSUser, error) {
+	var users netv1.Open5GSUserList
+	if err := c.List(ctx, &users, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	var result []netv1.Open5GSUser
+	for _, user := range users.Items {
+		if user.Spec.ProfileRef != nil && user.Spec.ProfileRef.Name == profile {
+			result = append(result, user)
+		}
+	}
+	return result, nil
+}
+
+func (r *Open5GSSubscriberProfileReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// The rollout is recounted whenever a user of the profile changes
+	enqueueProfile := handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+		user, ok := obj.(*netv1.Open5GSUser)
+		if !ok || user.Spec.ProfileRef == nil {
+			return nil
+		}
+		return []reconcile.Request{{NamespacedName: client.ObjectKey{Name: user.Spec.ProfileRef.Name, Namespace: user.Namespace}}}
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&netv1.Open5GSSubscriberProfile{}).
+		Watches(&netv1.Open5GSUser{}, enqueueProfile).
+		Complete(r)
+}
@@ -0,0 +1,117 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestOpen5GSSubscriberProfileRollout(t *testing.T) {
+	ctx := context.Background()
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default"}}
+	profile := &netv1.Open5GSSubscriberProfile{
+		ObjectMeta: metav1.ObjectMeta{Name: "iot", Namespace: "default", Generation: 1},
+		Spec: netv1.Open5GSSubscriberProfileSpec{
+			SST:         "2",
+			APN:         "iot",
+			SessionAMBR: netv1.Open5GSUserAMBR{Downlink: "10 Mbps", Uplink: "5 Mbps"},
+		},
+	}
+	user := &netv1.Open5GSUser{
+		ObjectMeta: metav1.ObjectMeta{Name: "user", Namespace: "default"},
+		Spec: netv1.Open5GSUserSpec{
+			IMSI:        "999700000000040",
+			Key:         "465B5CE8B199B49FAA5F0A2EE238A6BC",
+			OPC:         "E8ED289DEBA952E4283B54E88E6183CA",
+			APN:         "internet",
+			ProfileRef:  &corev1.LocalObjectReference{Name: "iot"},
+			SessionAMBR: netv1.Open5GSUserAMBR{Uplink: "1 Mbps"},
+			Open5GS:     netv1.Open5GSReference{Name: "open5gs", Namespace: "default"},
+		},
+	}
+	reconciler, stores := newTestUserReconciler(t, open5gs, profile, user)
+	store := stores.For(client.ObjectKeyFromObject(open5gs))
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(user)}
+	profiles := &Open5GSSubscriberProfileReconciler{Client: reconciler.Client, Scheme: reconciler.Scheme}
+	profileRequest := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(profile)}
+
+	if _, err := reconciler.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	subscriber, err := store.Get(ctx, user.Spec.IMSI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slice := subscriber["slice"].(bson.A)[0].(bson.M)
+	session := slice["session"].(bson.A)[0].(bson.M)
+	if sst, _ := bsonInt(slice["sst"]); sst != 2 {
+		t.Errorf("expected the SST of the profile, got %v", slice["sst"])
+	}
+	if session["name"] != "internet" {
+		t.Errorf("expected the APN of the user to override the profile, got %v", session["name"])
+	}
+	if ambr := session["ambr"].(bson.M); formatBitrate(ambr["downlink"]) != "10 Mbps" || formatBitrate(ambr["uplink"]) != "1 Mbps" {
+		t.Errorf("expected the session AMBR to be merged per direction, got %v", ambr)
+	}
+
+	if _, err := profiles.Reconcile(ctx, profileRequest); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if err := reconciler.Get(ctx, profileRequest.NamespacedName, profile); err != nil {
+		t.Fatal(err)
+	}
+	if profile.Status.Users != 1 || profile.Status.UpdatedUsers != 1 {
+		t.Errorf("unexpected rollout status %+v", profile.Status)
+	}
+
+	// A profile change is rolled out when its users are reconciled
+	profile.Spec.SST = "3"
+	profile.Generation = 2
+	if err := reconciler.Update(ctx, profile); err != nil {
+		t.Fatal(err)
+	}
+	if err := reconciler.Get(ctx, profileRequest.NamespacedName, profile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := profiles.Reconcile(ctx, profileRequest); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if err := reconciler.Get(ctx, profileRequest.NamespacedName, profile); err != nil {
+		t.Fatal(err)
+	}
+	if profile.Status.UpdatedUsers != 0 {
+		t.Errorf("expected the user to be pending, got %+v", profile.Status)
+	}
+	if requests := profileRequests(reconciler.Client)(ctx, profile); len(requests) != 1 || requests[0] != request {
+		t.Errorf("expected the user of the profile to be enqueued, got %v", requests)
+	}
+	if _, err := reconciler.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	subscriber, _ = store.Get(ctx, user.Spec.IMSI)
+	if sst, _ := bsonInt(subscriber["slice"].(bson.A)[0].(bson.M)["sst"]); sst != 3 {
+		t.Errorf("expected the new SST of the profile, got %d", sst)
+	}
+	if _, err := profiles.Reconcile(ctx, profileRequest); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if err := reconciler.Get(ctx, profileRequest.NamespacedName, profile); err != nil {
+		t.Fatal(err)
+	}
+	if profile.Status.UpdatedUsers != 1 || profile.Status.ObservedGeneration != profile.Generation {
+		t.Errorf("expected the rollout to be complete, got %+v", profile.Status)
+	}
+}
@@ -0,0 +1,54 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+)
+
+// applyProfile fills the fields of the user spec left empty with the settings
+// of the profile. Fields set in the user always win.
+func applyProfile(spec *netv1.Open5GSUserSpec, profile netv1.Open5GSSubscriberProfileSpec) {
+	if spec.SD == "" {
+		spec.SD = profile.SD
+	}
+	if spec.SST == "" {
+		spec.SST = profile.SST
+	}
+	if spec.APN == "" {
+		spec.APN = profile.APN
+	}
+	if spec.PDUSessionType == "" {
+		spec.PDUSessionType = profile.PDUSessionType
+	}
+
+	if spec.QoS.Index == nil {
+		spec.QoS.Index = profile.QoS.Index
+	}
+	arp := &spec.QoS.ARP
+	if arp.PriorityLevel == nil {
+		arp.PriorityLevel = profile.QoS.ARP.PriorityLevel
+	}
+	if arp.PreEmptionCapability == "" {
+		arp.PreEmptionCapability = profile.QoS.ARP.PreEmptionCapability
+	}
+	if arp.PreEmptionVulnerability == "" {
+		arp.PreEmptionVulnerability = profile.QoS.ARP.PreEmptionVulnerability
+	}
+
+	applyProfileAMBR(&spec.SessionAMBR, profile.SessionAMBR)
+	applyProfileAMBR(&spec.UEAMBR, profile.UEAMBR)
+}
+
+func applyProfileAMBR(ambr *netv1.Open5GSUserAMBR, profile netv1.Open5GSUserAMBR) {
+	if ambr.Downlink == "" {
+		ambr.Downlink = profile.Downlink
+	}
+	if ambr.Uplink == "" {
+		ambr.Uplink = profile.Uplink
+	}
+}
@@ -15,41 +15,71 @@ import (
 	"github.com/go-logr/logr"
 	netv1 "github.com/gradiant/open5gs-operator/api/v1"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 type Open5GSUserReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
-	Log    logr.Logger
+	Scheme      *runtime.Scheme
+	Log         logr.Logger
+	Subscribers SubscriberStores
+	// ResyncPeriod is the interval of the periodic drift check of each
+	// subscriber. It is jittered; zero disables it.
+	ResyncPeriod time.Duration
+	// DeletionTimeout bounds the time a deleted user waits for its subscriber
+	// to be cleaned up before its finalizer is removed anyway. Zero waits
+	// forever.
+	DeletionTimeout time.Duration
+	Recorder        events.EventRecorder
 }
 
 //+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gsusers,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gsusers/status,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gsusers/finalizers,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=core,resources=services,verbs=get;list
-//+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gses,verbs=get;list
+//+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch
+//+kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gses,verbs=get;list;watch
+//+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gssubscriberprofiles,verbs=get;list;watch
+//+kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
 
 const (
 	Open5GSUserFinalizer = "finalizer.open5gsuser.net.gradiant.org/user"
 )
 
-func (r *Open5GSUserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *Open5GSUserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	defer func(start time.Time) { observeReconcile("Open5GSUser", start, err) }(time.Now())
 	logger := log.FromContext(ctx)
 	user := &netv1.Open5GSUser{}
-	err := r.Get(ctx, req.NamespacedName, user)
-	if err != nil {
+	if err := r.Get(ctx, req.NamespacedName, user); err != nil {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	// Get the associated Open5GS instance
+	// Get the associated Open5GS instance. It is nil once the instance is gone.
 	open5gsName := user.Spec.Open5GS.Name
-	var open5gs netv1.Open5GS
-	if err := r.Get(ctx, client.ObjectKey{Name: open5gsName, Namespace: user.Namespace}, &open5gs); err != nil {
-		logger.Error(err, "Failed to get Open5GS instance", "Open5GS", open5gsName)
+	open5gs := &netv1.Open5GS{}
+	if err := r.Get(ctx, open5gsKey(user), open5gs); err != nil {
+		if !apierrors.IsNotFound(err) {
+			logger.Error(err, "Failed to get Open5GS instance", "Open5GS", open5gsName)
+			return ctrl.Result{}, err
+		}
+		open5gs = nil
+	} else if !referenceAllowed(open5gs, user.Namespace) {
+		return r.rejectReference(ctx, user, open5gs, logger)
 	}
 
 	// Check if the user is being deleted
@@ -59,80 +89,540 @@ func (r *Open5GSUserReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 			user.ObjectMeta.Finalizers = append(user.ObjectMeta.Finalizers, Open5GSUserFinalizer)
 			if err := r.Update(ctx, user); err != nil {
 				logger.Error(err, "Failed to add finalizer to Open5GSUser")
-				return ctrl.Result{RequeueAfter: 10 * time.Second}, err
+				return ctrl.Result{}, err
 			}
 		}
 	} else {
 		// Handle deletion
 		if containsString(user.ObjectMeta.Finalizers, Open5GSUserFinalizer) {
-			if err := r.deleteSubscriber(ctx, user, &open5gs, logger); err != nil {
-				logger.Error(err, "Failed to delete subscriber from MongoDB", "Open5GS", open5gsName)
-				return ctrl.Result{RequeueAfter: 10 * time.Second}, err
+			if err := r.deleteSubscriber(ctx, user, open5gs, logger); err != nil {
+				if r.DeletionTimeout == 0 {
+					logger.Error(err, "Failed to clean up subscriber in MongoDB", "Open5GS", open5gsName)
+					r.Recorder.Eventf(user, nil, corev1.EventTypeWarning, "SubscriberFailed", "Delete", "Failed to clean up subscriber %s: %v", user.Spec.IMSI, err)
+					return ctrl.Result{}, err
+				}
+				if remaining := time.Until(user.DeletionTimestamp.Add(r.DeletionTimeout)); remaining > 0 {
+					logger.Error(err, "Failed to clean up subscriber in MongoDB. Retrying.", "Open5GS", open5gsName, "timeout", remaining.Round(time.Second).String())
+					r.Recorder.Eventf(user, nil, corev1.EventTypeWarning, "SubscriberFailed", "Delete", "Failed to clean up subscriber %s: %v", user.Spec.IMSI, err)
+					return ctrl.Result{RequeueAfter: min(remaining, 10*time.Second)}, nil
+				}
+				logger.Error(err, "Deletion timeout reached. Removing finalizer without cleaning up the subscriber.", "Open5GS", open5gsName)
+				r.Recorder.Eventf(user, nil, corev1.EventTypeWarning, "SubscriberCleanupTimeout", "Delete",
+					"Subscriber %s was not cleaned up within %s and may remain in MongoDB: %v", user.Spec.IMSI, r.DeletionTimeout, err)
 			}
 			user.ObjectMeta.Finalizers = removeString(user.ObjectMeta.Finalizers, Open5GSUserFinalizer)
 			if err := r.Update(ctx, user); err != nil {
 				logger.Error(err, "Failed to remove finalizer from Open5GSUser")
-				return ctrl.Result{RequeueAfter: 10 * time.Second}, err
+				return ctrl.Result{}, err
 			}
 		}
-		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+		return ctrl.Result{}, nil
+	}
+
+	if open5gs == nil {
+		// The user is reconciled again when the instance is created
+		logger.Info("Open5GS instance not found. Waiting for it.", "Open5GS", open5gsName)
+		return ctrl.Result{}, nil
 	}
 
-	if err := r.reconcileSubscriber(ctx, *user, &open5gs, logger); err != nil {
+	if userPaused(user) {
+		return r.reportPaused(ctx, user, logger)
+	}
+
+	resolved, err := r.resolveKeys(ctx, *user)
+	if err != nil {
+		logger.Error(err, "Failed to read the keys of Open5GSUser")
+		return ctrl.Result{}, err
+	}
+	profile, err := r.resolveProfile(ctx, &resolved)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			// The user is reconciled again when the profile is created
+			logger.Info("Subscriber profile not found. Waiting for it.", "profile", user.Spec.ProfileRef.Name)
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get subscriber profile", "profile", user.Spec.ProfileRef.Name)
+		return ctrl.Result{}, err
+	}
+	owner, err := r.imsiOwner(ctx, user)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if owner != nil {
+		return r.reportIMSIConflict(ctx, user, owner, logger)
+	}
+	addressOwner, err := r.staticAddressOwner(ctx, resolved)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if addressOwner != nil {
+		return r.reportAddressConflict(ctx, user, addressOwner, logger)
+	}
+	drifted, provisioned, err := r.reconcileSubscriber(ctx, resolved, open5gs, logger)
+	if err != nil {
 		logger.Error(err, "Failed to reconcile subscriber in MongoDB", "Open5GS", open5gsName)
-		return ctrl.Result{RequeueAfter: 10 * time.Second}, err
+		r.Recorder.Eventf(user, nil, corev1.EventTypeWarning, "SubscriberFailed", "Reconcile", "Failed to write subscriber %s: %v", user.Spec.IMSI, err)
+		subscriberProvisioningFailures.WithLabelValues(open5gs.Namespace, open5gs.Name).Inc()
+		return ctrl.Result{}, err
+	}
+	statusChanged := meta.RemoveStatusCondition(&user.Status.Conditions, netv1.IMSIConflictCondition)
+	statusChanged = meta.RemoveStatusCondition(&user.Status.Conditions, netv1.AddressConflictCondition) || statusChanged
+	statusChanged = meta.RemoveStatusCondition(&user.Status.Conditions, netv1.PausedCondition) || statusChanged
+	statusChanged = meta.RemoveStatusCondition(&user.Status.Conditions, netv1.ReferenceNotAllowedCondition) || statusChanged
+	if provisioned && user.Status.IMSI != user.Spec.IMSI {
+		user.Status.IMSI = user.Spec.IMSI
+		statusChanged = true
+	}
+	var profileGeneration int64
+	if profile != nil {
+		profileGeneration = profile.Generation
+	}
+	if provisioned && user.Status.ProfileGeneration != profileGeneration {
+		user.Status.ProfileGeneration = profileGeneration
+		statusChanged = true
+	}
+	if len(drifted) > 0 {
+		now := metav1.Now()
+		user.Status.DriftedFields = drifted
+		user.Status.LastDriftRepair = &now
+		statusChanged = true
+	}
+	if statusChanged {
+		if err := r.Status().Update(ctx, user); err != nil {
+			logger.Error(err, "Failed to update Open5GSUser status")
+			return ctrl.Result{}, err
+		}
 	}
 
-	return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	if _, ok := user.Annotations[netv1.SQNAnnotation]; ok {
+		if err := r.reconcileSQN(ctx, user, open5gs, logger); err != nil {
+			logger.Error(err, "Failed to set subscriber SQN", "Open5GS", open5gsName)
+			return ctrl.Result{}, err
+		}
+	}
+
+	return resyncResult(r.ResyncPeriod), nil
 }
 
-func (r *Open5GSUserReconciler) reconcileSubscriber(ctx context.Context, user netv1.Open5GSUser, open5gs *netv1.Open5GS, logger logr.Logger) error {
-	serviceName := fmt.Sprintf("%s-mongodb", strings.ToLower(open5gs.Name))
-	ipService, err := r.GetServiceIp(ctx, serviceName, open5gs.Namespace)
-	if err != nil {
-		logger.Info("MongoDB service not found. Skipping reconciliation.", "service", serviceName)
-		return nil
+// reconcileSubscriber creates or repairs the subscriber of the user and
+// returns the fields that had to be repaired. When the IMSI of the user
+// changed, the subscriber of the previous IMSI is deleted once the new one is
+// written. provisioned is false if MongoDB could not be reached.
+func (r *Open5GSUserReconciler) reconcileSubscriber(ctx context.Context, user netv1.Open5GSUser, open5gs *netv1.Open5GS, logger logr.Logger) (drifted []string, provisioned bool, err error) {
+	if err := validateUEAddresses(user); err != nil {
+		return nil, false, err
 	}
 
-	mongoURI := fmt.Sprintf("mongodb://%s:27017", ipService)
+	store, err := r.Subscribers.Store(ctx, client.ObjectKey{Name: open5gs.Name, Namespace: open5gs.Namespace})
+	if err != nil {
+		logger.Info("MongoDB not available. Skipping reconciliation.", "open5gs", open5gs.Name, "reason", err.Error())
+		return nil, false, nil
+	}
 
-	err = addOrUpdateSubscriber(user, mongoURI, logger)
+	drifted, created, err := addOrUpdateSubscriber(ctx, store, user, logger)
 	if err != nil {
 		logger.Error(err, "Failed to add or update subscriber", "IMSI", user.Spec.IMSI)
+		return nil, false, err
+	}
+	if created {
+		r.Recorder.Eventf(&user, nil, corev1.EventTypeNormal, "SubscriberAdded", "Add", "Subscriber %s added to MongoDB", user.Spec.IMSI)
+	} else if len(drifted) > 0 {
+		subscriberDriftCorrections.WithLabelValues(open5gs.Namespace, open5gs.Name).Inc()
+		r.Recorder.Eventf(&user, nil, corev1.EventTypeNormal, "SubscriberUpdated", "Update",
+			"Subscriber %s updated, fields out of sync: %s", user.Spec.IMSI, strings.Join(drifted, ", "))
+	}
+
+	previous := user.Status.IMSI
+	if previous != "" && previous != user.Spec.IMSI {
+		claimed, err := r.imsiClaimed(ctx, &user, previous)
+		if err != nil {
+			return nil, false, err
+		}
+		if !claimed {
+			if _, err := store.Delete(ctx, previous); err != nil {
+				return nil, false, err
+			}
+		}
+		logger.Info("Subscriber moved to the new IMSI", "IMSI", user.Spec.IMSI, "previousIMSI", previous)
+		r.Recorder.Eventf(&user, nil, corev1.EventTypeNormal, "SubscriberMoved", "Update", "Subscriber moved from IMSI %s to %s", previous, user.Spec.IMSI)
+	}
+
+	return drifted, true, nil
+}
+
+// resolveKeys returns the user with the key material of its keys Secret, if it
+// references one
+func (r *Open5GSUserReconciler) resolveKeys(ctx context.Context, user netv1.Open5GSUser) (netv1.Open5GSUser, error) {
+	if user.Spec.KeysSecretRef == nil {
+		return user, nil
+	}
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Name: user.Spec.KeysSecretRef.Name, Namespace: user.Namespace}, secret); err != nil {
+		return user, fmt.Errorf("failed to get keys Secret %s: %v", user.Spec.KeysSecretRef.Name, err)
+	}
+	resolved := *user.DeepCopy()
+	if k, ok := secret.Data["k"]; ok {
+		resolved.Spec.Key = string(k)
+	}
+	if opc, ok := secret.Data["opc"]; ok {
+		resolved.Spec.OPC = string(opc)
+	}
+	if op, ok := secret.Data["op"]; ok {
+		resolved.Spec.OP = string(op)
+	}
+	return resolved, nil
+}
+
+// resolveProfile applies the subscriber profile referenced by the user, if
+// any, to its spec and returns the profile
+func (r *Open5GSUserReconciler) resolveProfile(ctx context.Context, user *netv1.Open5GSUser) (*netv1.Open5GSSubscriberProfile, error) {
+	if user.Spec.ProfileRef == nil {
+		return nil, nil
+	}
+	profile := &netv1.Open5GSSubscriberProfile{}
+	if err := r.Get(ctx, client.ObjectKey{Name: user.Spec.ProfileRef.Name, Namespace: user.Namespace}, profile); err != nil {
+		return nil, err
+	}
+	applyProfile(&user.Spec, profile.Spec)
+	return profile, nil
+}
+
+// reconcileSQN writes the SQN requested through the annotation and removes the
+// annotation so that it is applied only once.
+func (r *Open5GSUserReconciler) reconcileSQN(ctx context.Context, user *netv1.Open5GSUser, open5gs *netv1.Open5GS, logger logr.Logger) error {
+	sqn, err := parseSQN(user.Annotations[netv1.SQNAnnotation])
+	if err != nil {
 		return err
 	}
+	store, err := r.Subscribers.Store(ctx, client.ObjectKey{Name: open5gs.Name, Namespace: open5gs.Namespace})
+	if err != nil {
+		logger.Info("MongoDB not available. Skipping SQN update.", "open5gs", open5gs.Name, "reason", err.Error())
+		return nil
+	}
 
-	return nil
+	if err := setSubscriberSQN(ctx, store, *user, sqn); err != nil {
+		return err
+	}
+	logger.Info("Subscriber SQN set", "IMSI", user.Spec.IMSI, "SQN", sqn)
+	r.Recorder.Eventf(user, nil, corev1.EventTypeNormal, "SQNSet", "Update", "SQN of subscriber %s set to %d", user.Spec.IMSI, sqn)
+
+	delete(user.Annotations, netv1.SQNAnnotation)
+	return r.Update(ctx, user)
 }
 
+// deleteSubscriber applies the deletion policy of the user to the subscriber
+// written for it, unless another Open5GSUser of the instance manages its IMSI.
+// Nothing is left to clean up once the instance or its MongoDB is gone; an
+// unreachable MongoDB is an error so that the cleanup is retried.
 func (r *Open5GSUserReconciler) deleteSubscriber(ctx context.Context, user *netv1.Open5GSUser, open5gs *netv1.Open5GS, logger logr.Logger) error {
-	serviceName := fmt.Sprintf("%s-mongodb", strings.ToLower(open5gs.Name))
-	ipService, err := r.GetServiceIp(ctx, serviceName, open5gs.Namespace)
+	imsi := user.Status.IMSI
+	if imsi == "" && !meta.IsStatusConditionTrue(user.Status.Conditions, netv1.IMSIConflictCondition) {
+		// Users provisioned before the IMSI was recorded in the status
+		imsi = user.Spec.IMSI
+	}
+	if imsi == "" {
+		return nil
+	}
+	if open5gs == nil || !open5gs.DeletionTimestamp.IsZero() || (open5gs.Spec.MongoDB.Enabled != nil && !*open5gs.Spec.MongoDB.Enabled) {
+		logger.Info("Open5GS instance or its MongoDB is gone. Nothing to clean up.", "IMSI", imsi)
+		return nil
+	}
+	claimed, err := r.imsiClaimed(ctx, user, imsi)
 	if err != nil {
-		logger.Info("MongoDB service not found. Skipping deletion.", "service", serviceName)
+		return err
+	}
+	if claimed {
+		logger.Info("Subscriber kept, its IMSI is managed by another Open5GSUser", "IMSI", imsi)
 		return nil
 	}
 
-	mongoURI := fmt.Sprintf("mongodb://%s:27017", ipService)
+	store, err := r.Subscribers.Store(ctx, client.ObjectKey{Name: open5gs.Name, Namespace: open5gs.Namespace})
+	if err != nil {
+		return fmt.Errorf("MongoDB not available: %v", err)
+	}
+
+	policy := user.Spec.DeletionPolicy
+	if policy == netv1.DeletionPolicyOrphan || policy == netv1.DeletionPolicyRetain {
+		// The marker keeps the subscriber from being pruned as unmanaged
+		set := bson.M{retainedField: bson.M{"policy": policy, "user": user.Namespace + "/" + user.Name}}
+		if policy == netv1.DeletionPolicyRetain {
+			// Barring category 0 bars all packet oriented services
+			set["subscriber_status"] = int32(1)
+			set["operator_determined_barring"] = int32(0)
+		}
+		err := store.Update(ctx, imsi, set, nil)
+		if err != nil && err != ErrSubscriberNotFound {
+			return err
+		}
+		if policy == netv1.DeletionPolicyOrphan {
+			logger.Info("Subscriber orphaned in MongoDB", "IMSI", imsi)
+			r.Recorder.Eventf(user, nil, corev1.EventTypeNormal, "SubscriberOrphaned", "Delete", "Subscriber %s left in MongoDB", imsi)
+		} else {
+			logger.Info("Subscriber retained in MongoDB and barred", "IMSI", imsi)
+			r.Recorder.Eventf(user, nil, corev1.EventTypeNormal, "SubscriberRetained", "Delete", "Subscriber %s retained in MongoDB and barred", imsi)
+		}
+		return nil
+	}
 
-	err = deleteSubscriberMongo(*user, mongoURI)
+	deleted, err := store.Delete(ctx, imsi)
 	if err != nil {
-		logger.Error(err, "Failed to delete subscriber", "IMSI", user.Spec.IMSI)
 		return err
 	}
-
-	logger.Info("Subscriber deleted from MongoDB", "IMSI", user.Spec.IMSI)
+	if deleted == 0 {
+		logger.Info("Subscriber already gone from MongoDB", "IMSI", imsi)
+		return nil
+	}
+	logger.Info("Subscriber deleted from MongoDB", "IMSI", imsi)
+	r.Recorder.Eventf(user, nil, corev1.EventTypeNormal, "SubscriberDeleted", "Delete", "Subscriber %s deleted from MongoDB", imsi)
 
 	return nil
 }
 
-func (r *Open5GSUserReconciler) GetServiceIp(ctx context.Context, serviceName string, namespace string) (string, error) {
-	var service corev1.Service
-	namespacedName := client.ObjectKey{Name: serviceName, Namespace: namespace}
-	if err := r.Get(ctx, namespacedName, &service); err != nil {
-		return "", err
+// imsiOwner returns the Open5GSUser of the same Open5GS instance that claimed
+// the IMSI of the user first, or nil if the user owns it
+func (r *Open5GSUserReconciler) imsiOwner(ctx context.Context, user *netv1.Open5GSUser) (*netv1.Open5GSUser, error) {
+	users, err := r.ListOpen5GSUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var owner *netv1.Open5GSUser
+	for i := range users {
+		other := &users[i]
+		if other.UID == user.UID || other.Spec.IMSI != user.Spec.IMSI || open5gsKey(other) != open5gsKey(user) || !other.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if claimedBefore(other, user) && (owner == nil || claimedBefore(other, owner)) {
+			owner = other
+		}
+	}
+	return owner, nil
+}
+
+// imsiClaimed reports whether another Open5GSUser of the same Open5GS instance
+// has the given IMSI in its spec
+func (r *Open5GSUserReconciler) imsiClaimed(ctx context.Context, user *netv1.Open5GSUser, imsi string) (bool, error) {
+	users, err := r.ListOpen5GSUsers(ctx)
+	if err != nil {
+		return false, err
+	}
+	for i := range users {
+		other := &users[i]
+		if other.UID != user.UID && other.Spec.IMSI == imsi && open5gsKey(other) == open5gsKey(user) && other.DeletionTimestamp.IsZero() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// reportIMSIConflict sets the IMSIConflict condition on a user whose IMSI is
+// managed by an older user. Its subscriber is left untouched.
+func (r *Open5GSUserReconciler) reportIMSIConflict(ctx context.Context, user, owner *netv1.Open5GSUser, logger logr.Logger) (ctrl.Result, error) {
+	err := fmt.Errorf("IMSI %s is already managed by Open5GSUser %s/%s", user.Spec.IMSI, owner.Namespace, owner.Name)
+	logger.Error(err, "Duplicate IMSI", "IMSI", user.Spec.IMSI)
+	changed := meta.SetStatusCondition(&user.Status.Conditions, metav1.Condition{
+		Type:               netv1.IMSIConflictCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             "DuplicateIMSI",
+		Message:            err.Error(),
+		ObservedGeneration: user.Generation,
+	})
+	changed = meta.RemoveStatusCondition(&user.Status.Conditions, netv1.AddressConflictCondition) || changed
+	changed = meta.RemoveStatusCondition(&user.Status.Conditions, netv1.PausedCondition) || changed
+	changed = meta.RemoveStatusCondition(&user.Status.Conditions, netv1.ReferenceNotAllowedCondition) || changed
+	if changed {
+		r.Recorder.Eventf(user, owner, corev1.EventTypeWarning, "DuplicateIMSI", "Reconcile", "%v", err)
+		if err := r.Status().Update(ctx, user); err != nil {
+			logger.Error(err, "Failed to update Open5GSUser status")
+			return ctrl.Result{}, err
+		}
+	}
+	return resyncResult(r.ResyncPeriod), nil
+}
+
+// reportAddressConflict sets the AddressConflict condition on a user whose
+// static UE address is assigned to an older user. Its subscriber is not
+// written until the address is free, which triggers a reconciliation.
+func (r *Open5GSUserReconciler) reportAddressConflict(ctx context.Context, user, owner *netv1.Open5GSUser, logger logr.Logger) (ctrl.Result, error) {
+	err := fmt.Errorf("static UE address of Open5GSUser %s/%s is already assigned to Open5GSUser %s/%s", user.Namespace, user.Name, owner.Namespace, owner.Name)
+	logger.Error(err, "Duplicate static UE address", "IMSI", user.Spec.IMSI)
+	changed := meta.SetStatusCondition(&user.Status.Conditions, metav1.Condition{
+		Type:               netv1.AddressConflictCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             "DuplicateAddress",
+		Message:            err.Error(),
+		ObservedGeneration: user.Generation,
+	})
+	changed = meta.RemoveStatusCondition(&user.Status.Conditions, netv1.IMSIConflictCondition) || changed
+	changed = meta.RemoveStatusCondition(&user.Status.Conditions, netv1.PausedCondition) || changed
+	changed = meta.RemoveStatusCondition(&user.Status.Conditions, netv1.ReferenceNotAllowedCondition) || changed
+	if changed {
+		r.Recorder.Eventf(user, owner, corev1.EventTypeWarning, "DuplicateAddress", "Reconcile", "%v", err)
+		if err := r.Status().Update(ctx, user); err != nil {
+			logger.Error(err, "Failed to update Open5GSUser status")
+			return ctrl.Result{}, err
+		}
+	}
+	return resyncResult(r.ResyncPeriod), nil
+}
+
+// userPaused tells whether the user is paused by spec.paused or by the paused
+// annotation
+func userPaused(user *netv1.Open5GSUser) bool {
+	return user.Spec.Paused || user.Annotations[netv1.PausedAnnotation] == "true"
+}
+
+// reportPaused sets the Paused condition on a paused user. Its subscriber is
+// left untouched until the user is resumed, which triggers a reconciliation.
+func (r *Open5GSUserReconciler) reportPaused(ctx context.Context, user *netv1.Open5GSUser, logger logr.Logger) (ctrl.Result, error) {
+	logger.Info("Open5GSUser paused. Skipping writes of its subscriber.", "IMSI", user.Spec.IMSI)
+	changed := meta.SetStatusCondition(&user.Status.Conditions, metav1.Condition{
+		Type:               netv1.PausedCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Paused",
+		Message:            "Writes of the subscriber to MongoDB are suspended",
+		ObservedGeneration: user.Generation,
+	})
+	if changed {
+		r.Recorder.Eventf(user, nil, corev1.EventTypeNormal, "Paused", "Reconcile", "Writes of subscriber %s suspended", user.Spec.IMSI)
+	}
+	changed = meta.RemoveStatusCondition(&user.Status.Conditions, netv1.AddressConflictCondition) || changed
+	changed = meta.RemoveStatusCondition(&user.Status.Conditions, netv1.ReferenceNotAllowedCondition) || changed
+	if changed {
+		if err := r.Status().Update(ctx, user); err != nil {
+			logger.Error(err, "Failed to update Open5GSUser status")
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// conflictingUserRequests enqueues the other users of the IMSI or of a static
+// UE address of the object, so that the user left in conflict takes the IMSI
+// or the address over when its owner goes away
+func conflictingUserRequests(c client.Client) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		user, ok := obj.(*netv1.Open5GSUser)
+		if !ok || user.Spec.IMSI == "" {
+			return nil
+		}
+		var users netv1.Open5GSUserList
+		if err := c.List(ctx, &users); err != nil {
+			return nil
+		}
+		var requests []reconcile.Request
+		for i := range users.Items {
+			other := &users.Items[i]
+			if other.UID == user.UID || open5gsKey(other) != open5gsKey(user) {
+				continue
+			}
+			if other.Spec.IMSI == user.Spec.IMSI || sameStaticAddress(other.Spec.UE, user.Spec.UE) {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(other)})
+			}
+		}
+		return requests
 	}
-	return service.Spec.ClusterIP, nil
+}
+
+// staticAddressOwner returns the Open5GSUser of the same Open5GS instance that
+// already claims one of the static UE addresses of the user, or nil. The
+// oldest user keeps the address.
+func (r *Open5GSUserReconciler) staticAddressOwner(ctx context.Context, user netv1.Open5GSUser) (*netv1.Open5GSUser, error) {
+	if user.Spec.UE.IPv4 == "" && user.Spec.UE.IPv6 == "" {
+		return nil, nil
+	}
+	users, err := r.ListOpen5GSUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range users {
+		other := &users[i]
+		if other.UID == user.UID || open5gsKey(other) != open5gsKey(&user) || !other.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if !sameStaticAddress(user.Spec.UE, other.Spec.UE) {
+			continue
+		}
+		if claimedBefore(&user, other) {
+			continue
+		}
+		return other, nil
+	}
+	return nil, nil
+}
+
+func sameStaticAddress(a, b netv1.Open5GSUserUE) bool {
+	return (a.IPv4 != "" && a.IPv4 == b.IPv4) || (a.IPv6 != "" && normalizeIP(a.IPv6) == normalizeIP(b.IPv6))
+}
+
+// claimedBefore reports whether a was created before b, using the name as a
+// tie-breaker so that exactly one of two conflicting users wins.
+func claimedBefore(a, b *netv1.Open5GSUser) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	return a.Namespace+"/"+a.Name < b.Namespace+"/"+b.Name
+}
+
+// rejectReference handles a user that references an Open5GS instance of
+// another namespace without being allowed to. The subscriber is never written;
+// a user being deleted only gets its finalizer removed.
+func (r *Open5GSUserReconciler) rejectReference(ctx context.Context, user *netv1.Open5GSUser, open5gs *netv1.Open5GS, logger logr.Logger) (ctrl.Result, error) {
+	if !user.ObjectMeta.DeletionTimestamp.IsZero() {
+		if containsString(user.ObjectMeta.Finalizers, Open5GSUserFinalizer) {
+			user.ObjectMeta.Finalizers = removeString(user.ObjectMeta.Finalizers, Open5GSUserFinalizer)
+			if err := r.Update(ctx, user); err != nil {
+				logger.Error(err, "Failed to remove finalizer from Open5GSUser")
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+	err := fmt.Errorf("Open5GS %s/%s does not allow references from namespace %s", open5gs.Namespace, open5gs.Name, user.Namespace)
+	logger.Error(err, "Open5GS reference not allowed", "Open5GS", open5gs.Name)
+	changed := meta.SetStatusCondition(&user.Status.Conditions, metav1.Condition{
+		Type:               netv1.ReferenceNotAllowedCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             "ReferenceNotAllowed",
+		Message:            err.Error(),
+		ObservedGeneration: user.Generation,
+	})
+	if changed {
+		r.Recorder.Eventf(user, open5gs, corev1.EventTypeWarning, "ReferenceNotAllowed", "Reconcile", "%v", err)
+		if err := r.Status().Update(ctx, user); err != nil {
+			logger.Error(err, "Failed to update Open5GSUser status")
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// open5gsKey returns the key of the Open5GS instance referenced by the user
+func open5gsKey(user *netv1.Open5GSUser) client.ObjectKey {
+	return open5gsReferenceKey(user.Spec.Open5GS, user.Namespace)
+}
+
+// open5gsReferenceKey resolves a reference made from the given namespace. The
+// namespace of the referencing object is used when the reference has none.
+func open5gsReferenceKey(ref netv1.Open5GSReference, namespace string) client.ObjectKey {
+	if ref.Namespace != "" {
+		namespace = ref.Namespace
+	}
+	return client.ObjectKey{Name: ref.Name, Namespace: namespace}
+}
+
+// referenceAllowed reports whether objects of the given namespace may
+// reference the Open5GS instance, which is always the case within its own
+// namespace and otherwise requires an entry in spec.allowedUserNamespaces.
+func referenceAllowed(open5gs *netv1.Open5GS, namespace string) bool {
+	if open5gs.Namespace == namespace {
+		return true
+	}
+	for _, allowed := range open5gs.Spec.AllowedUserNamespaces {
+		if allowed == "*" || allowed == namespace {
+			return true
+		}
+	}
+	return false
 }
 
 func containsString(slice []string, s string) bool {
@@ -153,8 +643,47 @@ func removeString(slice []string, s string) (result []string) {
 	return
 }
 
+// profileRequests enqueues the users of a subscriber profile, so that a profile
+// change is rolled out to every subscriber using it
+func profileRequests(c client.Client) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		users, err := profileUsers(ctx, c, obj.GetNamespace(), obj.GetName())
+		if err != nil {
+			return nil
+		}
+		requests := make([]reconcile.Request, 0, len(users))
+		for i := range users {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&users[i])})
+		}
+		return requests
+	}
+}
+
 func (r *Open5GSUserReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Subscribers == nil {
+		r.Subscribers = &MongoSubscriberStores{Client: mgr.GetClient(), Clients: NewMongoClients()}
+	}
+	if r.Recorder == nil {
+		r.Recorder = mgr.GetEventRecorder("open5gsuser-controller")
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &netv1.Open5GSUser{}, open5gsRefIndex, func(obj client.Object) []string {
+		return []string{open5gsKey(obj.(*netv1.Open5GSUser)).String()}
+	}); err != nil {
+		return err
+	}
+
+	// Users are reconciled when their Open5GS instance changes and when its
+	// MongoDB Service or endpoints change, so that a restarted, empty MongoDB
+	// gets every subscriber back without waiting for the periodic resync.
+	enqueueUsers := handler.EnqueueRequestsFromMapFunc(referencingRequests(mgr.GetClient(), func() client.ObjectList {
+		return &netv1.Open5GSUserList{}
+	}))
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&netv1.Open5GSUser{}).
+		Watches(&netv1.Open5GSUser{}, handler.EnqueueRequestsFromMapFunc(conflictingUserRequests(mgr.GetClient()))).
+		Watches(&netv1.Open5GSSubscriberProfile{}, handler.EnqueueRequestsFromMapFunc(profileRequests(mgr.GetClient())), builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&netv1.Open5GS{}, enqueueUsers, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&corev1.Service{}, enqueueUsers, builder.WithPredicates(mongoServicePredicate)).
+		Watches(&discoveryv1.EndpointSlice{}, enqueueUsers, builder.WithPredicates(mongoServicePredicate)).
 		Complete(r)
 }
@@ -0,0 +1,591 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func newTestUserReconciler(t *testing.T, objects ...client.Object) (*Open5GSUserReconciler, *MemorySubscriberStores) {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := netv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	stores := NewMemorySubscriberStores()
+	reconciler := &Open5GSUserReconciler{
+		Client:      fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).WithStatusSubresource(&netv1.Open5GSUser{}, &netv1.Open5GSSubscriberProfile{}).Build(),
+		Scheme:      scheme,
+		Subscribers: stores,
+		Recorder:    events.NewFakeRecorder(10),
+	}
+	return reconciler, stores
+}
+
+func TestOpen5GSUserReconcile(t *testing.T) {
+	ctx := context.Background()
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default"}}
+	user := &netv1.Open5GSUser{
+		ObjectMeta: metav1.ObjectMeta{Name: "user", Namespace: "default"},
+		Spec: netv1.Open5GSUserSpec{
+			IMSI:    "999700000000001",
+			Key:     "465B5CE8B199B49FAA5F0A2EE238A6BC",
+			OPC:     "E8ED289DEBA952E4283B54E88E6183CA",
+			SST:     "1",
+			SD:      "111111",
+			APN:     "internet",
+			Open5GS: netv1.Open5GSReference{Name: "open5gs", Namespace: "default"},
+		},
+	}
+	reconciler, stores := newTestUserReconciler(t, open5gs, user)
+	store := stores.For(client.ObjectKey{Name: "open5gs", Namespace: "default"})
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(user)}
+
+	if _, err := reconciler.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	subscriber, err := store.Get(ctx, user.Spec.IMSI)
+	if err != nil {
+		t.Fatalf("subscriber was not created: %v", err)
+	}
+	if repair, _ := diffSubscriber(*user, subscriber); !repair.Empty() {
+		t.Errorf("expected the created subscriber to match the spec, got drift on %v", repair.Paths)
+	}
+	recorder := reconciler.Recorder.(*events.FakeRecorder)
+	if event := <-recorder.Events; event != "Normal SubscriberAdded Subscriber 999700000000001 added to MongoDB" {
+		t.Errorf("unexpected event %q", event)
+	}
+
+	// Out-of-band changes are reverted and unmanaged fields are preserved
+	if err := store.Update(ctx, user.Spec.IMSI, bson.M{"security.opc": "00", "security.sqn": int64(64)}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reconciler.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	subscriber, _ = store.Get(ctx, user.Spec.IMSI)
+	security := subscriber["security"].(bson.M)
+	if security["opc"] != user.Spec.OPC {
+		t.Errorf("expected the OPc to be restored, got %v", security["opc"])
+	}
+	if sqn, _ := bsonInt(security["sqn"]); sqn != 64 {
+		t.Errorf("expected the SQN to be preserved, got %v", security["sqn"])
+	}
+	current := &netv1.Open5GSUser{}
+	if err := reconciler.Get(ctx, request.NamespacedName, current); err != nil {
+		t.Fatal(err)
+	}
+	if len(current.Status.DriftedFields) != 1 || current.Status.DriftedFields[0] != "security.opc" {
+		t.Errorf("expected the repaired field in the status, got %v", current.Status.DriftedFields)
+	}
+	if event := <-recorder.Events; event != "Normal SubscriberUpdated Subscriber 999700000000001 updated, fields out of sync: security.opc" {
+		t.Errorf("unexpected event %q", event)
+	}
+
+	// Deleting the user removes the subscriber
+	if err := reconciler.Get(ctx, request.NamespacedName, current); err != nil {
+		t.Fatal(err)
+	}
+	if err := reconciler.Delete(ctx, current); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reconciler.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if _, err := store.Get(ctx, user.Spec.IMSI); err != ErrSubscriberNotFound {
+		t.Errorf("expected the subscriber to be deleted, got %v", err)
+	}
+	if event := <-recorder.Events; event != "Normal SubscriberDeleted Subscriber 999700000000001 deleted from MongoDB" {
+		t.Errorf("unexpected event %q", event)
+	}
+}
+
+func TestOpen5GSUserCrossNamespaceReference(t *testing.T) {
+	ctx := context.Background()
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "core", Namespace: "platform"}}
+	user := &netv1.Open5GSUser{
+		ObjectMeta: metav1.ObjectMeta{Name: "user", Namespace: "team-a"},
+		Spec: netv1.Open5GSUserSpec{
+			IMSI:    "999700000000002",
+			Key:     "465B5CE8B199B49FAA5F0A2EE238A6BC",
+			OPC:     "E8ED289DEBA952E4283B54E88E6183CA",
+			Open5GS: netv1.Open5GSReference{Name: "core", Namespace: "platform"},
+		},
+	}
+	reconciler, stores := newTestUserReconciler(t, open5gs, user)
+	store := stores.For(client.ObjectKey{Name: "core", Namespace: "platform"})
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(user)}
+
+	if _, err := reconciler.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if _, err := store.Get(ctx, user.Spec.IMSI); err != ErrSubscriberNotFound {
+		t.Fatalf("expected the reference to be rejected, got %v", err)
+	}
+	if err := reconciler.Get(ctx, request.NamespacedName, user); err != nil {
+		t.Fatal(err)
+	}
+	if !meta.IsStatusConditionTrue(user.Status.Conditions, netv1.ReferenceNotAllowedCondition) {
+		t.Errorf("expected the ReferenceNotAllowed condition, got %v", user.Status.Conditions)
+	}
+	if event := <-reconciler.Recorder.(*events.FakeRecorder).Events; !strings.Contains(event, "Warning ReferenceNotAllowed") {
+		t.Errorf("expected a ReferenceNotAllowed warning event, got %q", event)
+	}
+
+	open5gs.Spec.AllowedUserNamespaces = []string{"team-a"}
+	if err := reconciler.Update(ctx, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reconciler.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if _, err := store.Get(ctx, user.Spec.IMSI); err != nil {
+		t.Errorf("expected the subscriber to be created once the namespace is allowed, got %v", err)
+	}
+	if err := reconciler.Get(ctx, request.NamespacedName, user); err != nil {
+		t.Fatal(err)
+	}
+	if meta.FindStatusCondition(user.Status.Conditions, netv1.ReferenceNotAllowedCondition) != nil {
+		t.Errorf("expected the ReferenceNotAllowed condition to be removed, got %v", user.Status.Conditions)
+	}
+}
+
+func TestOpen5GSUserKeysSecretRef(t *testing.T) {
+	ctx := context.Background()
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default"}}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "user-keys", Namespace: "default"},
+		Data: map[string][]byte{
+			"k":   []byte("465B5CE8B199B49FAA5F0A2EE238A6BC"),
+			"opc": []byte("E8ED289DEBA952E4283B54E88E6183CA"),
+		},
+	}
+	user := &netv1.Open5GSUser{
+		ObjectMeta: metav1.ObjectMeta{Name: "user", Namespace: "default"},
+		Spec: netv1.Open5GSUserSpec{
+			IMSI:          "999700000000003",
+			KeysSecretRef: &corev1.LocalObjectReference{Name: "user-keys"},
+			Open5GS:       netv1.Open5GSReference{Name: "open5gs", Namespace: "default"},
+		},
+	}
+	reconciler, stores := newTestUserReconciler(t, open5gs, secret, user)
+	store := stores.For(client.ObjectKeyFromObject(open5gs))
+
+	if _, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(user)}); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	subscriber, err := store.Get(ctx, user.Spec.IMSI)
+	if err != nil {
+		t.Fatalf("subscriber was not created: %v", err)
+	}
+	security := subscriber["security"].(bson.M)
+	if security["k"] != "465B5CE8B199B49FAA5F0A2EE238A6BC" || security["opc"] != "E8ED289DEBA952E4283B54E88E6183CA" {
+		t.Errorf("expected the keys to be read from the Secret, got %v", security)
+	}
+}
+
+func TestOpen5GSUserIMSIChange(t *testing.T) {
+	ctx := context.Background()
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default"}}
+	user := &netv1.Open5GSUser{
+		ObjectMeta: metav1.ObjectMeta{Name: "user", Namespace: "default"},
+		Spec: netv1.Open5GSUserSpec{
+			IMSI:    "999700000000010",
+			Key:     "465B5CE8B199B49FAA5F0A2EE238A6BC",
+			OPC:     "E8ED289DEBA952E4283B54E88E6183CA",
+			Open5GS: netv1.Open5GSReference{Name: "open5gs", Namespace: "default"},
+		},
+	}
+	reconciler, stores := newTestUserReconciler(t, open5gs, user)
+	store := stores.For(client.ObjectKeyFromObject(open5gs))
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(user)}
+
+	if _, err := reconciler.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if err := reconciler.Get(ctx, request.NamespacedName, user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Status.IMSI != "999700000000010" {
+		t.Fatalf("expected the provisioned IMSI in the status, got %q", user.Status.IMSI)
+	}
+
+	user.Spec.IMSI = "999700000000011"
+	if err := reconciler.Update(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reconciler.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if _, err := store.Get(ctx, "999700000000010"); err != ErrSubscriberNotFound {
+		t.Errorf("expected the subscriber of the previous IMSI to be deleted, got %v", err)
+	}
+	if _, err := store.Get(ctx, "999700000000011"); err != nil {
+		t.Errorf("expected the subscriber of the new IMSI, got %v", err)
+	}
+	if err := reconciler.Get(ctx, request.NamespacedName, user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Status.IMSI != "999700000000011" {
+		t.Errorf("expected the status to follow the new IMSI, got %q", user.Status.IMSI)
+	}
+}
+
+func TestOpen5GSUserDuplicateIMSI(t *testing.T) {
+	ctx := context.Background()
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default"}}
+	newUser := func(name, opc string, created metav1.Time) *netv1.Open5GSUser {
+		return &netv1.Open5GSUser{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name), CreationTimestamp: created},
+			Spec: netv1.Open5GSUserSpec{
+				IMSI:    "999700000000020",
+				Key:     "465B5CE8B199B49FAA5F0A2EE238A6BC",
+				OPC:     opc,
+				Open5GS: netv1.Open5GSReference{Name: "open5gs", Namespace: "default"},
+			},
+		}
+	}
+	older := newUser("older", "E8ED289DEBA952E4283B54E88E6183CA", metav1.Unix(100, 0))
+	newer := newUser("newer", "00112233445566778899AABBCCDDEEFF", metav1.Unix(200, 0))
+	reconciler, stores := newTestUserReconciler(t, open5gs, older, newer)
+	store := stores.For(client.ObjectKeyFromObject(open5gs))
+
+	for _, user := range []*netv1.Open5GSUser{older, newer} {
+		if _, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(user)}); err != nil {
+			t.Fatalf("Reconcile returned error: %v", err)
+		}
+	}
+	subscriber, err := store.Get(ctx, "999700000000020")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opc := subscriber["security"].(bson.M)["opc"]; opc != "E8ED289DEBA952E4283B54E88E6183CA" {
+		t.Errorf("expected the older user to keep the subscriber, got OPc %v", opc)
+	}
+	if err := reconciler.Get(ctx, client.ObjectKeyFromObject(newer), newer); err != nil {
+		t.Fatal(err)
+	}
+	if !meta.IsStatusConditionTrue(newer.Status.Conditions, netv1.IMSIConflictCondition) {
+		t.Errorf("expected the IMSIConflict condition on the newer user, got %v", newer.Status.Conditions)
+	}
+
+	// Deleting the user in conflict leaves the subscriber of the owner alone
+	if err := reconciler.Delete(ctx, newer); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(newer)}); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if _, err := store.Get(ctx, "999700000000020"); err != nil {
+		t.Errorf("expected the subscriber of the older user to be kept, got %v", err)
+	}
+}
+
+func TestOpen5GSUserDuplicateAddress(t *testing.T) {
+	ctx := context.Background()
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default"}}
+	newUser := func(name, imsi string, created metav1.Time) *netv1.Open5GSUser {
+		return &netv1.Open5GSUser{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name), CreationTimestamp: created},
+			Spec: netv1.Open5GSUserSpec{
+				IMSI:    imsi,
+				Key:     "465B5CE8B199B49FAA5F0A2EE238A6BC",
+				OPC:     "E8ED289DEBA952E4283B54E88E6183CA",
+				UE:      netv1.Open5GSUserUE{IPv4: "10.45.0.10"},
+				Open5GS: netv1.Open5GSReference{Name: "open5gs", Namespace: "default"},
+			},
+		}
+	}
+	older := newUser("older", "999700000000021", metav1.Unix(100, 0))
+	newer := newUser("newer", "999700000000022", metav1.Unix(200, 0))
+	reconciler, stores := newTestUserReconciler(t, open5gs, older, newer)
+	store := stores.For(client.ObjectKeyFromObject(open5gs))
+
+	// The conflict is reported on the newer user instead of being retried
+	for _, user := range []*netv1.Open5GSUser{older, newer} {
+		if _, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(user)}); err != nil {
+			t.Fatalf("Reconcile returned error: %v", err)
+		}
+	}
+	if _, err := store.Get(ctx, "999700000000022"); err == nil {
+		t.Error("did not expect the subscriber of the newer user to be written")
+	}
+	if err := reconciler.Get(ctx, client.ObjectKeyFromObject(newer), newer); err != nil {
+		t.Fatal(err)
+	}
+	if !meta.IsStatusConditionTrue(newer.Status.Conditions, netv1.AddressConflictCondition) {
+		t.Errorf("expected the AddressConflict condition on the newer user, got %v", newer.Status.Conditions)
+	}
+	recorder := reconciler.Recorder.(*events.FakeRecorder)
+	<-recorder.Events // SubscriberAdded of the older user
+	if event := <-recorder.Events; !strings.HasPrefix(event, "Warning DuplicateAddress") {
+		t.Errorf("expected a DuplicateAddress event, got %q", event)
+	}
+	if requests := conflictingUserRequests(reconciler.Client)(ctx, older); len(requests) != 1 || requests[0].Name != "newer" {
+		t.Errorf("expected the older user to enqueue the newer one, got %v", requests)
+	}
+
+	// The address is taken over once the older user gives it up
+	if err := reconciler.Get(ctx, client.ObjectKeyFromObject(older), older); err != nil {
+		t.Fatal(err)
+	}
+	older.Spec.UE.IPv4 = "10.45.0.11"
+	if err := reconciler.Update(ctx, older); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(newer)}); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if _, err := store.Get(ctx, "999700000000022"); err != nil {
+		t.Errorf("expected the subscriber of the newer user to be written, got %v", err)
+	}
+	if err := reconciler.Get(ctx, client.ObjectKeyFromObject(newer), newer); err != nil {
+		t.Fatal(err)
+	}
+	if meta.FindStatusCondition(newer.Status.Conditions, netv1.AddressConflictCondition) != nil {
+		t.Errorf("expected the AddressConflict condition to be removed, got %v", newer.Status.Conditions)
+	}
+}
+
+// unavailableStores stands for a MongoDB that cannot be reached
+type unavailableStores struct{}
+
+func (unavailableStores) Store(context.Context, client.ObjectKey) (SubscriberStore, error) {
+	return nil, fmt.Errorf("connection refused")
+}
+
+func TestOpen5GSUserDeletionPolicy(t *testing.T) {
+	ctx := context.Background()
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default"}}
+	newUser := func(name, imsi, policy string) *netv1.Open5GSUser {
+		return &netv1.Open5GSUser{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: netv1.Open5GSUserSpec{
+				IMSI:           imsi,
+				Key:            "465B5CE8B199B49FAA5F0A2EE238A6BC",
+				OPC:            "E8ED289DEBA952E4283B54E88E6183CA",
+				DeletionPolicy: policy,
+				Open5GS:        netv1.Open5GSReference{Name: "open5gs", Namespace: "default"},
+			},
+		}
+	}
+	orphan := newUser("orphan", "999700000000030", netv1.DeletionPolicyOrphan)
+	retain := newUser("retain", "999700000000031", netv1.DeletionPolicyRetain)
+	reconciler, stores := newTestUserReconciler(t, open5gs, orphan, retain)
+	store := stores.For(client.ObjectKeyFromObject(open5gs))
+
+	for _, user := range []*netv1.Open5GSUser{orphan, retain} {
+		request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(user)}
+		if _, err := reconciler.Reconcile(ctx, request); err != nil {
+			t.Fatalf("Reconcile returned error: %v", err)
+		}
+		if err := reconciler.Delete(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := reconciler.Reconcile(ctx, request); err != nil {
+			t.Fatalf("Reconcile returned error: %v", err)
+		}
+		if err := reconciler.Get(ctx, request.NamespacedName, user); !apierrors.IsNotFound(err) {
+			t.Errorf("expected %s to be deleted, got %v", user.Name, err)
+		}
+	}
+
+	subscriber, err := store.Get(ctx, orphan.Spec.IMSI)
+	if err != nil {
+		t.Fatalf("expected the orphaned subscriber to be kept: %v", err)
+	}
+	if status, _ := bsonInt(subscriber["subscriber_status"]); status != 0 {
+		t.Errorf("expected the orphaned subscriber to be left untouched, got status %d", status)
+	}
+	if subscriber[retainedField] == nil {
+		t.Error("expected the orphaned subscriber to be marked as retained")
+	}
+	subscriber, err = store.Get(ctx, retain.Spec.IMSI)
+	if err != nil {
+		t.Fatalf("expected the retained subscriber to be kept: %v", err)
+	}
+	if status, _ := bsonInt(subscriber["subscriber_status"]); status != 1 {
+		t.Errorf("expected the retained subscriber to be barred, got status %d", status)
+	}
+	if subscriber[retainedField] == nil {
+		t.Error("expected the retained subscriber to be marked as retained")
+	}
+
+	// A user managing the IMSI again takes the subscriber back
+	reclaim := newUser("reclaim", retain.Spec.IMSI, "")
+	if err := reconciler.Create(ctx, reclaim); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(reclaim)}); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if subscriber, err = store.Get(ctx, retain.Spec.IMSI); err != nil {
+		t.Fatal(err)
+	}
+	if subscriber[retainedField] != nil {
+		t.Error("expected the marker to be removed once the IMSI is managed again")
+	}
+	if status, _ := bsonInt(subscriber["subscriber_status"]); status != 0 {
+		t.Errorf("expected the reclaimed subscriber to be unbarred, got status %d", status)
+	}
+}
+
+func TestOpen5GSUserDeletionWithoutOpen5GS(t *testing.T) {
+	ctx := context.Background()
+	user := &netv1.Open5GSUser{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "user",
+			Namespace:  "default",
+			Finalizers: []string{Open5GSUserFinalizer},
+		},
+		Spec: netv1.Open5GSUserSpec{
+			IMSI:    "999700000000032",
+			Open5GS: netv1.Open5GSReference{Name: "gone", Namespace: "default"},
+		},
+		Status: netv1.Open5GSUserStatus{IMSI: "999700000000032"},
+	}
+	reconciler, _ := newTestUserReconciler(t, user)
+	reconciler.Subscribers = unavailableStores{}
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(user)}
+
+	if err := reconciler.Delete(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reconciler.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if err := reconciler.Get(ctx, request.NamespacedName, user); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the user of a deleted Open5GS instance to be released, got %v", err)
+	}
+}
+
+func TestOpen5GSUserDeletionTimeout(t *testing.T) {
+	ctx := context.Background()
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default"}}
+	user := &netv1.Open5GSUser{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "user",
+			Namespace:  "default",
+			Finalizers: []string{Open5GSUserFinalizer},
+		},
+		Spec: netv1.Open5GSUserSpec{
+			IMSI:    "999700000000033",
+			Open5GS: netv1.Open5GSReference{Name: "open5gs", Namespace: "default"},
+		},
+		Status: netv1.Open5GSUserStatus{IMSI: "999700000000033"},
+	}
+	reconciler, _ := newTestUserReconciler(t, open5gs, user)
+	reconciler.Subscribers = unavailableStores{}
+	recorder := events.NewFakeRecorder(10)
+	reconciler.Recorder = recorder
+	reconciler.DeletionTimeout = time.Hour
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(user)}
+
+	if err := reconciler.Delete(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	result, err := reconciler.Reconcile(ctx, request)
+	if err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if result.RequeueAfter == 0 {
+		t.Error("expected the cleanup to be retried while MongoDB is unreachable")
+	}
+	if err := reconciler.Get(ctx, request.NamespacedName, user); err != nil {
+		t.Fatalf("expected the finalizer to be kept before the timeout, got %v", err)
+	}
+
+	reconciler.DeletionTimeout = time.Nanosecond
+	if _, err := reconciler.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if err := reconciler.Get(ctx, request.NamespacedName, user); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the finalizer to be removed after the timeout, got %v", err)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "SubscriberFailed") {
+		t.Errorf("expected a warning event for the failed cleanup, got %q", event)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, "SubscriberCleanupTimeout") {
+			t.Errorf("unexpected event %q", event)
+		}
+	default:
+		t.Error("expected a warning event when the timeout is reached")
+	}
+}
+
+func TestOpen5GSUserPaused(t *testing.T) {
+	ctx := context.Background()
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default"}}
+	user := &netv1.Open5GSUser{
+		ObjectMeta: metav1.ObjectMeta{Name: "user", Namespace: "default", Annotations: map[string]string{netv1.PausedAnnotation: "true"}},
+		Spec: netv1.Open5GSUserSpec{
+			IMSI:    "999700000000001",
+			Key:     "465B5CE8B199B49FAA5F0A2EE238A6BC",
+			OPC:     "E8ED289DEBA952E4283B54E88E6183CA",
+			Open5GS: netv1.Open5GSReference{Name: "open5gs", Namespace: "default"},
+		},
+	}
+	reconciler, stores := newTestUserReconciler(t, open5gs, user)
+	store := stores.For(client.ObjectKey{Name: "open5gs", Namespace: "default"})
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(user)}
+
+	if _, err := reconciler.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if _, err := store.Get(ctx, user.Spec.IMSI); err != ErrSubscriberNotFound {
+		t.Errorf("expected no subscriber for a paused user, got %v", err)
+	}
+	current := &netv1.Open5GSUser{}
+	if err := reconciler.Get(ctx, request.NamespacedName, current); err != nil {
+		t.Fatal(err)
+	}
+	if !meta.IsStatusConditionTrue(current.Status.Conditions, netv1.PausedCondition) {
+		t.Errorf("expected the Paused condition, got %+v", current.Status.Conditions)
+	}
+
+	// Resuming the user writes its subscriber and clears the condition
+	delete(current.Annotations, netv1.PausedAnnotation)
+	if err := reconciler.Update(ctx, current); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reconciler.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if _, err := store.Get(ctx, user.Spec.IMSI); err != nil {
+		t.Errorf("expected the subscriber once resumed: %v", err)
+	}
+	if err := reconciler.Get(ctx, request.NamespacedName, current); err != nil {
+		t.Fatal(err)
+	}
+	if meta.FindStatusCondition(current.Status.Conditions, netv1.PausedCondition) != nil {
+		t.Errorf("expected the Paused condition to be removed, got %+v", current.Status.Conditions)
+	}
+}
@@ -9,379 +9,478 @@ package controller
 import (
 	"context"
 	"fmt"
+	"net"
 	"strconv"
-	"time"
+	"strings"
+	"unicode"
 
 	"github.com/go-logr/logr"
 	netv1 "github.com/gradiant/open5gs-operator/api/v1"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func updateSubscriber(Open5GSUser netv1.Open5GSUser, mongoURI string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+func addSubscriber(ctx context.Context, store SubscriberStore, Open5GSUser netv1.Open5GSUser) error {
+	subscriber, err := newSubscriberDocument(Open5GSUser)
 	if err != nil {
-		return fmt.Errorf("failed to connect to mongo: %v", err)
+		return err
 	}
-	defer client.Disconnect(ctx)
 
-	collection := client.Database("open5gs").Collection("subscribers")
+	return store.Insert(ctx, subscriber)
+}
 
-	updateFields := bson.M{
-		"security.k":   Open5GSUser.Spec.Key,
-		"security.opc": Open5GSUser.Spec.OPC,
-	}
+// newSubscriberDocument builds the complete document of the subscriber
+// described by the spec. The SST defaults to 1, the SD is omitted when not set
+// and the APN defaults to "internet".
+func newSubscriberDocument(Open5GSUser netv1.Open5GSUser) (bson.M, error) {
+	const defaultSST = 1
+	const defaultAPN = "internet"
 
-	if Open5GSUser.Spec.SST != "" || Open5GSUser.Spec.SD != "" {
+	slice := bson.M{
+		"sst":               defaultSST,
+		"default_indicator": true,
+		"_id":               primitive.NewObjectID(),
+	}
+	if Open5GSUser.Spec.SST != "" {
 		sst, err := strconv.Atoi(Open5GSUser.Spec.SST)
 		if err != nil {
-			return fmt.Errorf("failed to convert SST to int: %v", err)
+			return nil, fmt.Errorf("failed to convert SST to int: %v", err)
 		}
-		updateFields["slice.0.sst"] = sst
-		updateFields["slice.0.sd"] = Open5GSUser.Spec.SD
+		slice["sst"] = sst
+	}
+	if Open5GSUser.Spec.SD != "" {
+		slice["sd"] = Open5GSUser.Spec.SD
+	}
+	apn := Open5GSUser.Spec.APN
+	if apn == "" {
+		apn = defaultAPN
 	}
 
-	updateFields["slice.0.session.0.name"] = Open5GSUser.Spec.APN
-
-	update := bson.M{"$set": updateFields}
-	filter := bson.M{"imsi": Open5GSUser.Spec.IMSI}
-	result, err := collection.UpdateOne(ctx, filter, update)
+	session, err := subscriberSession(Open5GSUser, apn)
 	if err != nil {
-		return fmt.Errorf("failed to update subscriber: %v", err)
+		return nil, err
 	}
-
-	if result.MatchedCount == 0 {
-		return fmt.Errorf("no subscriber found with IMSI %s", Open5GSUser.Spec.IMSI)
+	slice["session"] = []bson.M{session}
+	ueAMBR, err := ambrDocument(Open5GSUser.Spec.UEAMBR)
+	if err != nil {
+		return nil, err
 	}
-
-	return nil
-}
-
-func deleteSubscriberMongo(Open5GSUser netv1.Open5GSUser, mongoURI string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	security, err := subscriberSecurity(Open5GSUser)
 	if err != nil {
-		return fmt.Errorf("failed to connect to mongo: %v", err)
+		return nil, err
 	}
-	defer client.Disconnect(ctx)
-
-	collection := client.Database("open5gs").Collection("subscribers")
-
-	result, err := collection.DeleteOne(ctx, bson.M{"imsi": Open5GSUser.Spec.IMSI})
+	access, err := subscriberAccess(Open5GSUser)
 	if err != nil {
-		return fmt.Errorf("failed to delete subscriber: %v", err)
+		return nil, err
 	}
 
-	if result.DeletedCount == 0 {
-		return fmt.Errorf("no subscriber found with IMSI %s", Open5GSUser.Spec.IMSI)
+	subscriber := bson.M{
+		"_id":                      primitive.NewObjectID(),
+		"schema_version":           1,
+		"imsi":                     Open5GSUser.Spec.IMSI,
+		"msisdn":                   subscriberMSISDN(Open5GSUser),
+		"imeisv":                   subscriberIMEISV(Open5GSUser),
+		"mme_host":                 []string{},
+		"mm_realm":                 []string{},
+		"purge_flag":               []string{},
+		"slice":                    []bson.M{slice},
+		"security":                 security,
+		"ambr":                     ueAMBR,
+		"subscribed_rau_tau_timer": 12,
+		"__v":                      0,
 	}
-
-	return nil
+	for field, value := range access {
+		subscriber[field] = value
+	}
+	return subscriber, nil
 }
 
-func addSubscriberWithSlice(Open5GSUser netv1.Open5GSUser, mongoURI string) error {
+func (r *Open5GSUserReconciler) ListOpen5GSUsers(ctx context.Context) ([]netv1.Open5GSUser, error) {
+	var userList netv1.Open5GSUserList
+	if err := r.List(ctx, &userList); err != nil {
+		return nil, err
+	}
+	return userList.Items, nil
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// addOrUpdateSubscriber creates the subscriber or repairs the fields that
+// drifted from the spec, returning the repaired paths and whether the
+// subscriber was created
+func addOrUpdateSubscriber(ctx context.Context, store SubscriberStore, user netv1.Open5GSUser, logger logr.Logger) ([]string, bool, error) {
+	subscriber, err := store.Get(ctx, user.Spec.IMSI)
+	if err != nil {
+		if err == ErrSubscriberNotFound {
+			logger.Info("Adding new subscriber.", "IMSI", user.Spec.IMSI)
+			return nil, true, addSubscriber(ctx, store, user)
+		} else {
+			return nil, false, err
+		}
+	}
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	repair, err := diffSubscriber(user, subscriber)
 	if err != nil {
-		return fmt.Errorf("failed to connect to mongo: %v", err)
+		return nil, false, err
+	}
+	if repair.Empty() {
+		return nil, false, nil
 	}
-	defer client.Disconnect(ctx)
+	logger.Info("Changes detected. Updating subscriber.", "IMSI", user.Spec.IMSI, "fields", repair.Paths)
+	if err := store.Update(ctx, user.Spec.IMSI, repair.Set, repair.Unset); err != nil {
+		if err == ErrSubscriberNotFound {
+			return nil, false, fmt.Errorf("no subscriber found with IMSI %s", user.Spec.IMSI)
+		}
+		return nil, false, err
+	}
+	return repair.Paths, false, nil
+}
 
-	collection := client.Database("open5gs").Collection("subscribers")
+// bitrateUnits maps the AMBR units accepted in the spec to the unit codes
+// stored by Open5GS.
+var bitrateUnits = map[string]int{
+	"bps":  0,
+	"Kbps": 1,
+	"Mbps": 2,
+	"Gbps": 3,
+	"Tbps": 4,
+}
 
-	sst, err := strconv.Atoi(Open5GSUser.Spec.SST)
+// parseBitrate converts a bit rate such as "1 Gbps" or "512Kbps" into the
+// value/unit pair used in the subscriber document. A bare number is in bps.
+func parseBitrate(bitrate string) (int64, int, error) {
+	bitrate = strings.TrimSpace(bitrate)
+	digits := strings.TrimRightFunc(bitrate, func(r rune) bool { return !unicode.IsDigit(r) })
+	unitName := strings.TrimSpace(bitrate[len(digits):])
+	if unitName == "" {
+		unitName = "bps"
+	}
+	unit, ok := bitrateUnits[unitName]
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid bit rate unit %q in %q", unitName, bitrate)
+	}
+	value, err := strconv.ParseInt(digits, 10, 64)
 	if err != nil {
-		return fmt.Errorf("failed to convert SST to int: %v", err)
+		return 0, 0, fmt.Errorf("invalid bit rate %q: %v", bitrate, err)
 	}
+	return value, unit, nil
+}
 
-	subscriber := bson.M{
-		"_id":            primitive.NewObjectID(),
-		"schema_version": 1,
-		"imsi":           Open5GSUser.Spec.IMSI,
-		"msisdn":         []string{},
-		"imeisv":         []string{},
-		"mme_host":       []string{},
-		"mm_realm":       []string{},
-		"purge_flag":     []string{},
-		"slice": []bson.M{
-			{
-				"sst":               sst,
-				"sd":                Open5GSUser.Spec.SD,
-				"default_indicator": true,
-				"session": []bson.M{
-					{
-						"name": Open5GSUser.Spec.APN,
-						"type": 3,
-						"qos": bson.M{
-							"index": 9,
-							"arp": bson.M{
-								"priority_level":            8,
-								"pre_emption_capability":    1,
-								"pre_emption_vulnerability": 2,
-							},
-						},
-						"ambr": bson.M{
-							"downlink": bson.M{"value": 1000000000, "unit": 0},
-							"uplink":   bson.M{"value": 1000000000, "unit": 0},
-						},
-						"pcc_rule": []string{},
-						"_id":      primitive.NewObjectID(),
-					},
-				},
-				"_id": primitive.NewObjectID(),
-			},
-		},
-		"security": bson.M{
-			"k":   Open5GSUser.Spec.Key,
-			"opc": Open5GSUser.Spec.OPC,
-			"amf": "8000",
-		},
-		"ambr": bson.M{
-			"downlink": bson.M{"value": 1000000000, "unit": 0},
-			"uplink":   bson.M{"value": 1000000000, "unit": 0},
-		},
-		"access_restriction_data":     32,
-		"network_access_mode":         0,
-		"subscriber_status":           0,
-		"operator_determined_barring": 0,
-		"subscribed_rau_tau_timer":    12,
-		"__v":                         0,
+func ambrDocument(ambr netv1.Open5GSUserAMBR) (bson.M, error) {
+	downlink := ambr.Downlink
+	if downlink == "" {
+		downlink = "1 Gbps"
 	}
-
-	_, err = collection.InsertOne(ctx, subscriber)
+	uplink := ambr.Uplink
+	if uplink == "" {
+		uplink = "1 Gbps"
+	}
+	downlinkValue, downlinkUnit, err := parseBitrate(downlink)
 	if err != nil {
-		return fmt.Errorf("failed to insert subscriber: %v", err)
+		return nil, err
 	}
+	uplinkValue, uplinkUnit, err := parseBitrate(uplink)
+	if err != nil {
+		return nil, err
+	}
+	return bson.M{
+		"downlink": bson.M{"value": downlinkValue, "unit": downlinkUnit},
+		"uplink":   bson.M{"value": uplinkValue, "unit": uplinkUnit},
+	}, nil
+}
 
-	return nil
+func pduSessionType(sessionType string) (int, error) {
+	switch sessionType {
+	case "IPv4":
+		return 1, nil
+	case "IPv6":
+		return 2, nil
+	case "IPv4v6", "":
+		return 3, nil
+	}
+	return 0, fmt.Errorf("invalid PDU session type %q", sessionType)
 }
 
-func addSubscriberWithAPN(Open5GSUser netv1.Open5GSUser, mongoURI string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func preEmption(value, defaultValue string) (int, error) {
+	if value == "" {
+		value = defaultValue
+	}
+	switch value {
+	case "Disabled":
+		return 1, nil
+	case "Enabled":
+		return 2, nil
+	}
+	return 0, fmt.Errorf("invalid pre-emption value %q", value)
+}
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+// subscriberSession builds the default session of the subscriber document from
+// the QoS, AMBR and PDU session type in the spec, falling back to the values
+// Open5GS uses when a field is not set.
+func subscriberSession(user netv1.Open5GSUser, apn string) (bson.M, error) {
+	sessionType, err := pduSessionType(user.Spec.PDUSessionType)
 	if err != nil {
-		return fmt.Errorf("failed to connect to mongo: %v", err)
+		return nil, err
 	}
-	defer client.Disconnect(ctx)
-
-	collection := client.Database("open5gs").Collection("subscribers")
-
-	const defaultSST = 1
-
-	subscriber := bson.M{
-		"_id":            primitive.NewObjectID(),
-		"schema_version": 1,
-		"imsi":           Open5GSUser.Spec.IMSI,
-		"msisdn":         []string{},
-		"imeisv":         []string{},
-		"mme_host":       []string{},
-		"mm_realm":       []string{},
-		"purge_flag":     []string{},
-		"slice": []bson.M{
-			{
-				"sst":               defaultSST,
-				"default_indicator": true,
-				"session": []bson.M{
-					{
-						"name": Open5GSUser.Spec.APN,
-						"type": 3,
-						"qos": bson.M{
-							"index": 9,
-							"arp": bson.M{
-								"priority_level":            8,
-								"pre_emption_capability":    1,
-								"pre_emption_vulnerability": 2,
-							},
-						},
-						"ambr": bson.M{
-							"downlink": bson.M{"value": 1000000000, "unit": 0},
-							"uplink":   bson.M{"value": 1000000000, "unit": 0},
-						},
-						"pcc_rule": []string{},
-						"_id":      primitive.NewObjectID(),
-					},
-				},
-				"_id": primitive.NewObjectID(),
-			},
-		},
-		"security": bson.M{
-			"k":   Open5GSUser.Spec.Key,
-			"opc": Open5GSUser.Spec.OPC,
-			"amf": "8000",
-		},
-		"ambr": bson.M{
-			"downlink": bson.M{"value": 1000000000, "unit": 0},
-			"uplink":   bson.M{"value": 1000000000, "unit": 0},
-		},
-		"access_restriction_data":     32,
-		"network_access_mode":         0,
-		"subscriber_status":           0,
-		"operator_determined_barring": 0,
-		"subscribed_rau_tau_timer":    12,
-		"__v":                         0,
+	index := int32(9)
+	if user.Spec.QoS.Index != nil {
+		index = *user.Spec.QoS.Index
 	}
-
-	_, err = collection.InsertOne(ctx, subscriber)
+	priorityLevel := int32(8)
+	if user.Spec.QoS.ARP.PriorityLevel != nil {
+		priorityLevel = *user.Spec.QoS.ARP.PriorityLevel
+	}
+	capability, err := preEmption(user.Spec.QoS.ARP.PreEmptionCapability, "Disabled")
 	if err != nil {
-		return fmt.Errorf("failed to insert subscriber: %v", err)
+		return nil, err
 	}
-
-	return nil
-}
-func addSubscriberWithDefaults(Open5GSUser netv1.Open5GSUser, mongoURI string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	vulnerability, err := preEmption(user.Spec.QoS.ARP.PreEmptionVulnerability, "Enabled")
 	if err != nil {
-		return fmt.Errorf("failed to connect to mongo: %v", err)
+		return nil, err
 	}
-	defer client.Disconnect(ctx)
-
-	collection := client.Database("open5gs").Collection("subscribers")
-
-	const defaultSST = 1
-	const defaultAPN = "internet"
-
-	subscriber := bson.M{
-		"_id":            primitive.NewObjectID(),
-		"schema_version": 1,
-		"imsi":           Open5GSUser.Spec.IMSI,
-		"msisdn":         []string{},
-		"imeisv":         []string{},
-		"mme_host":       []string{},
-		"mm_realm":       []string{},
-		"purge_flag":     []string{},
-		"slice": []bson.M{
-			{
-				"sst":               defaultSST,
-				"default_indicator": true,
-				"session": []bson.M{
-					{
-						"name": defaultAPN,
-						"type": 3,
-						"qos": bson.M{
-							"index": 9,
-							"arp": bson.M{
-								"priority_level":            8,
-								"pre_emption_capability":    1,
-								"pre_emption_vulnerability": 2,
-							},
-						},
-						"ambr": bson.M{
-							"downlink": bson.M{"value": 1000000000, "unit": 0},
-							"uplink":   bson.M{"value": 1000000000, "unit": 0},
-						},
-						"pcc_rule": []string{},
-						"_id":      primitive.NewObjectID(),
-					},
-				},
-				"_id": primitive.NewObjectID(),
+	sessionAMBR, err := ambrDocument(user.Spec.SessionAMBR)
+	if err != nil {
+		return nil, err
+	}
+	session := bson.M{
+		"name": apn,
+		"type": sessionType,
+		"qos": bson.M{
+			"index": index,
+			"arp": bson.M{
+				"priority_level":            priorityLevel,
+				"pre_emption_capability":    capability,
+				"pre_emption_vulnerability": vulnerability,
 			},
 		},
-		"security": bson.M{
-			"k":   Open5GSUser.Spec.Key,
-			"opc": Open5GSUser.Spec.OPC,
-			"amf": "8000",
-		},
-		"ambr": bson.M{
-			"downlink": bson.M{"value": 1000000000, "unit": 0},
-			"uplink":   bson.M{"value": 1000000000, "unit": 0},
-		},
-		"access_restriction_data":     32,
-		"network_access_mode":         0,
-		"subscriber_status":           0,
-		"operator_determined_barring": 0,
-		"subscribed_rau_tau_timer":    12,
-		"__v":                         0,
+		"ambr":     sessionAMBR,
+		"pcc_rule": []string{},
+		"_id":      primitive.NewObjectID(),
+	}
+	ue := bson.M{}
+	if user.Spec.UE.IPv4 != "" {
+		ue["ipv4"] = user.Spec.UE.IPv4
 	}
+	if user.Spec.UE.IPv6 != "" {
+		ue["ipv6"] = user.Spec.UE.IPv6
+	}
+	if len(ue) > 0 {
+		session["ue"] = ue
+	}
+	return session, nil
+}
 
-	_, err = collection.InsertOne(ctx, subscriber)
-	if err != nil {
-		return fmt.Errorf("failed to insert subscriber with defaults: %v", err)
+func subscriberMSISDN(user netv1.Open5GSUser) []string {
+	if user.Spec.MSISDN == nil {
+		return []string{}
 	}
+	return user.Spec.MSISDN
+}
 
-	return nil
+func subscriberIMEISV(user netv1.Open5GSUser) []string {
+	if user.Spec.IMEISV == "" {
+		return []string{}
+	}
+	return []string{user.Spec.IMEISV}
 }
 
-func hasDrift(open5GSUser netv1.Open5GSUser, subscriber bson.M) bool {
-	if subscriber["security"].(bson.M)["k"] != open5GSUser.Spec.Key {
+// bsonValuesEqual compares a desired value with the one decoded from MongoDB,
+// treating all integer widths as equal and ignoring keys that are only
+// present in the stored document.
+func bsonValuesEqual(desired, stored interface{}) bool {
+	switch d := desired.(type) {
+	case bson.M:
+		s, ok := stored.(bson.M)
+		if !ok {
+			return false
+		}
+		for k, v := range d {
+			if !bsonValuesEqual(v, s[k]) {
+				return false
+			}
+		}
 		return true
-	}
-	if subscriber["security"].(bson.M)["opc"] != open5GSUser.Spec.OPC {
+	case int, int32, int64:
+		dv, _ := bsonInt(d)
+		sv, ok := bsonInt(stored)
+		return ok && dv == sv
+	case []string:
+		s, _ := stored.(bson.A)
+		if len(d) != len(s) {
+			return false
+		}
+		for i := range d {
+			if d[i] != s[i] {
+				return false
+			}
+		}
+		return true
+	case bson.A:
+		s, _ := stored.(bson.A)
+		if len(d) != len(s) {
+			return false
+		}
+		for i := range d {
+			if !bsonValuesEqual(d[i], s[i]) {
+				return false
+			}
+		}
 		return true
+	case nil:
+		return stored == nil
+	default:
+		return desired == stored
 	}
+}
 
-	if sst, ok := subscriber["slice"].(bson.A)[0].(bson.M)["sst"].(int); ok && strconv.Itoa(sst) != open5GSUser.Spec.SST {
-		return true
+func bsonInt(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case float64:
+		return int64(n), float64(int64(n)) == n
 	}
+	return 0, false
+}
 
-	if sd, ok := subscriber["slice"].(bson.A)[0].(bson.M)["sd"].(string); ok && sd != open5GSUser.Spec.SD {
-		return true
+// validateUEAddresses checks that the static addresses of the user are valid,
+// allowed by its PDU session type and inside the UE pools of Open5GS.
+func validateUEAddresses(user netv1.Open5GSUser) error {
+	sessionType := user.Spec.PDUSessionType
+	if user.Spec.UE.IPv4 != "" {
+		ip := net.ParseIP(user.Spec.UE.IPv4)
+		if ip == nil || ip.To4() == nil {
+			return fmt.Errorf("invalid static IPv4 address %q", user.Spec.UE.IPv4)
+		}
+		if sessionType == "IPv6" {
+			return fmt.Errorf("static IPv4 address %s requires an IPv4 or IPv4v6 PDU session", user.Spec.UE.IPv4)
+		}
+		_, pool, _ := net.ParseCIDR(ueSubnetIPv4)
+		if !pool.Contains(ip) {
+			return fmt.Errorf("static IPv4 address %s is outside the UE pool %s", user.Spec.UE.IPv4, ueSubnetIPv4)
+		}
+		if ip.Equal(pool.IP) || ip.Equal(net.ParseIP(ueGatewayIPv4)) || ip.Equal(broadcastAddress(pool)) {
+			return fmt.Errorf("static IPv4 address %s is reserved in the UE pool %s", user.Spec.UE.IPv4, ueSubnetIPv4)
+		}
 	}
+	if user.Spec.UE.IPv6 != "" {
+		ip := net.ParseIP(user.Spec.UE.IPv6)
+		if ip == nil || ip.To4() != nil {
+			return fmt.Errorf("invalid static IPv6 address %q", user.Spec.UE.IPv6)
+		}
+		if sessionType == "IPv4" {
+			return fmt.Errorf("static IPv6 address %s requires an IPv6 or IPv4v6 PDU session", user.Spec.UE.IPv6)
+		}
+		return fmt.Errorf("static IPv6 address %s cannot be assigned: no IPv6 UE pool is configured", user.Spec.UE.IPv6)
+	}
+	return nil
+}
 
-	if name, ok := subscriber["slice"].(bson.A)[0].(bson.M)["session"].(bson.A)[0].(bson.M)["name"].(string); ok && name != open5GSUser.Spec.APN {
-		return true
+func broadcastAddress(network *net.IPNet) net.IP {
+	ip := network.IP.To4()
+	broadcast := make(net.IP, len(ip))
+	for i := range ip {
+		broadcast[i] = ip[i] | ^network.Mask[i]
 	}
+	return broadcast
+}
 
-	return false
+func normalizeIP(address string) string {
+	if ip := net.ParseIP(address); ip != nil {
+		return ip.String()
+	}
+	return address
 }
 
-func (r *Open5GSUserReconciler) ListOpen5GSUsers(ctx context.Context) ([]netv1.Open5GSUser, error) {
-	var userList netv1.Open5GSUserList
-	if err := r.List(ctx, &userList); err != nil {
-		return nil, err
+// subscriberSecurity builds the authentication fields of the subscriber
+// document. Only one of op/opc is set, depending on the OP type of the user.
+func subscriberSecurity(user netv1.Open5GSUser) (bson.M, error) {
+	amf := user.Spec.AMF
+	if amf == "" {
+		amf = "8000"
 	}
-	return userList.Items, nil
+	security := bson.M{
+		"k":   user.Spec.Key,
+		"op":  nil,
+		"opc": nil,
+		"amf": amf,
+	}
+	switch user.Spec.OPType {
+	case "OP":
+		if user.Spec.OP == "" {
+			return nil, fmt.Errorf("opType OP requires the op field to be set")
+		}
+		security["op"] = user.Spec.OP
+	case "OPc", "":
+		security["opc"] = user.Spec.OPC
+	default:
+		return nil, fmt.Errorf("invalid opType %q", user.Spec.OPType)
+	}
+	return security, nil
 }
 
-func addOrUpdateSubscriber(user netv1.Open5GSUser, mongoURI string, logger logr.Logger) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// maxSQN is the largest sequence number representable in 48 bits
+const maxSQN = 1<<48 - 1
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+// parseSQN parses the value of the SQN annotation
+func parseSQN(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(value, "reset") {
+		return 0, nil
+	}
+	sqn, err := strconv.ParseInt(value, 0, 64)
 	if err != nil {
-		return fmt.Errorf("failed to connect to MongoDB: %v", err)
+		return 0, fmt.Errorf("invalid SQN %q: %v", value, err)
+	}
+	if sqn < 0 || sqn > maxSQN {
+		return 0, fmt.Errorf("SQN %q is out of range", value)
 	}
-	defer client.Disconnect(ctx)
+	return sqn, nil
+}
 
-	collection := client.Database("open5gs").Collection("subscribers")
+func setSubscriberSQN(ctx context.Context, store SubscriberStore, user netv1.Open5GSUser, sqn int64) error {
+	err := store.Update(ctx, user.Spec.IMSI, bson.M{"security.sqn": sqn}, nil)
+	if err == ErrSubscriberNotFound {
+		return fmt.Errorf("no subscriber found with IMSI %s", user.Spec.IMSI)
+	}
+	return err
+}
 
-	filter := bson.M{"imsi": user.Spec.IMSI}
-	var subscriber bson.M
-	err = collection.FindOne(ctx, filter).Decode(&subscriber)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			logger.Info("Adding new subscriber.", "IMSI", user.Spec.IMSI)
-			if user.Spec.SST != "" && user.Spec.SD != "" && user.Spec.APN != "" {
-				return addSubscriberWithSlice(user, mongoURI)
-			} else if user.Spec.APN != "" {
-				return addSubscriberWithAPN(user, mongoURI)
-			} else {
-				return addSubscriberWithDefaults(user, mongoURI)
-			}
-		} else {
-			return fmt.Errorf("failed to find subscriber: %v", err)
+// subscriberAccess builds the top-level fields of the subscriber document that
+// grant, bar or restrict network access.
+func subscriberAccess(user netv1.Open5GSUser) (bson.M, error) {
+	var status, barring int32
+	switch user.Spec.SubscriberStatus {
+	case "ServiceGranted", "":
+		status = 0
+	case "OperatorDeterminedBarring":
+		status = 1
+		if user.Spec.OperatorDeterminedBarring != nil {
+			barring = *user.Spec.OperatorDeterminedBarring
 		}
+	default:
+		return nil, fmt.Errorf("invalid subscriberStatus %q", user.Spec.SubscriberStatus)
 	}
-
-	if hasDrift(user, subscriber) {
-		logger.Info("Changes detected. Updating subscriber.", "IMSI", user.Spec.IMSI)
-		return updateSubscriber(user, mongoURI)
+	var accessMode int32
+	switch user.Spec.NetworkAccessMode {
+	case "PacketAndCircuit", "":
+		accessMode = 0
+	case "OnlyPacket":
+		accessMode = 2
+	default:
+		return nil, fmt.Errorf("invalid networkAccessMode %q", user.Spec.NetworkAccessMode)
 	}
-
-	return nil
+	restriction := int32(32)
+	if user.Spec.AccessRestrictionData != nil {
+		restriction = *user.Spec.AccessRestrictionData
+	}
+	return bson.M{
+		"subscriber_status":           status,
+		"operator_determined_barring": barring,
+		"network_access_mode":         accessMode,
+		"access_restriction_data":     restriction,
+	}, nil
 }
@@ -0,0 +1,288 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseBitrate(t *testing.T) {
+	cases := map[string]struct {
+		value int64
+		unit  int
+	}{
+		"1 Gbps":   {1, 3},
+		"512Kbps":  {512, 1},
+		"100 Mbps": {100, 2},
+		"2000":     {2000, 0},
+	}
+	for in, want := range cases {
+		value, unit, err := parseBitrate(in)
+		if err != nil {
+			t.Errorf("parseBitrate(%q) returned error: %v", in, err)
+			continue
+		}
+		if value != want.value || unit != want.unit {
+			t.Errorf("parseBitrate(%q) = %d/%d, expected %d/%d", in, value, unit, want.value, want.unit)
+		}
+	}
+	if _, _, err := parseBitrate("10 Xbps"); err == nil {
+		t.Error("expected an error for an unknown bit rate unit")
+	}
+}
+
+func TestSubscriberSessionDefaults(t *testing.T) {
+	session, err := subscriberSession(netv1.Open5GSUser{}, "internet")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if session["type"] != 3 {
+		t.Errorf("expected default PDU session type 3 (IPv4v6), got %v", session["type"])
+	}
+	qos := session["qos"].(bson.M)
+	if qos["index"] != int32(9) {
+		t.Errorf("expected default 5QI 9, got %v", qos["index"])
+	}
+	arp := qos["arp"].(bson.M)
+	if arp["priority_level"] != int32(8) || arp["pre_emption_capability"] != 1 || arp["pre_emption_vulnerability"] != 2 {
+		t.Errorf("unexpected default ARP %v", arp)
+	}
+}
+
+func TestDiffSubscriberSessionPolicy(t *testing.T) {
+	index := int32(7)
+	user := netv1.Open5GSUser{Spec: netv1.Open5GSUserSpec{
+		IMSI:           "999700000000001",
+		APN:            "internet",
+		PDUSessionType: "IPv4",
+		QoS:            netv1.Open5GSUserQoS{Index: &index},
+		SessionAMBR:    netv1.Open5GSUserAMBR{Downlink: "10 Mbps", Uplink: "5 Mbps"},
+	}}
+	document, err := newSubscriberDocument(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Values as decoded from MongoDB, where integers come back as int32/int64.
+	stored, err := copyDocument(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repair, _ := diffSubscriber(user, stored); !repair.Empty() {
+		t.Errorf("did not expect drift when stored values match the spec, got %v", repair.Paths)
+	}
+
+	user.Spec.UEAMBR = netv1.Open5GSUserAMBR{Downlink: "100 Mbps"}
+	repair, _ := diffSubscriber(user, stored)
+	if len(repair.Paths) != 1 || repair.Paths[0] != "ambr" {
+		t.Errorf("expected drift on the UE AMBR only, got %v", repair.Paths)
+	}
+}
+
+func TestDiffSubscriberRepairsChangedPaths(t *testing.T) {
+	user := netv1.Open5GSUser{Spec: netv1.Open5GSUserSpec{
+		IMSI: "999700000000001",
+		Key:  "465B5CE8B199B49FAA5F0A2EE238A6BC",
+		OPC:  "E8ED289DEBA952E4283B54E88E6183CA",
+		SST:  "1",
+		SD:   "111111",
+	}}
+	document, _ := newSubscriberDocument(user)
+	stored, _ := copyDocument(document)
+
+	// Out-of-band edits, as done from the WebUI, plus an unmanaged field
+	stored["security"].(bson.M)["opc"] = "00000000000000000000000000000000"
+	stored["security"].(bson.M)["sqn"] = int64(97)
+	slice := stored["slice"].(bson.A)[0].(bson.M)
+	slice["sst"] = int32(2)
+	delete(slice, "sd")
+
+	repair, err := diffSubscriber(user, stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"security.opc": user.Spec.OPC,
+		"slice.0.sst":  int32(1),
+		"slice.0.sd":   "111111",
+	}
+	if len(repair.Paths) != len(expected) || len(repair.Unset) != 0 {
+		t.Fatalf("unexpected repair %+v", repair)
+	}
+	for path, value := range expected {
+		if !bsonValuesEqual(value, repair.Set[path]) {
+			t.Errorf("expected %s to be set to %v, got %v", path, value, repair.Set[path])
+		}
+	}
+
+	// A stored SD is removed when the spec has none
+	user.Spec.SD = ""
+	stored, _ = copyDocument(document)
+	repair, _ = diffSubscriber(user, stored)
+	if len(repair.Unset) != 1 || repair.Unset[0] != "slice.0.sd" {
+		t.Errorf("expected the SD to be removed, got %+v", repair)
+	}
+}
+
+func TestDiffSubscriberUnexpectedShape(t *testing.T) {
+	user := netv1.Open5GSUser{Spec: netv1.Open5GSUserSpec{
+		IMSI: "999700000000001",
+		Key:  "465B5CE8B199B49FAA5F0A2EE238A6BC",
+		OPC:  "E8ED289DEBA952E4283B54E88E6183CA",
+	}}
+	stored := bson.M{
+		"imsi":     user.Spec.IMSI,
+		"security": "corrupted",
+		"slice":    bson.A{},
+	}
+	repair, err := diffSubscriber(user, stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"security", "slice"} {
+		if _, ok := repair.Set[path]; !ok {
+			t.Errorf("expected %s to be rewritten, got %v", path, repair.Paths)
+		}
+	}
+	for _, path := range repair.Paths {
+		if strings.HasPrefix(path, "security.") || strings.HasPrefix(path, "slice.") {
+			t.Errorf("did not expect %s to be repaired separately from its parent", path)
+		}
+	}
+}
+
+func TestValidateUEAddresses(t *testing.T) {
+	cases := []struct {
+		ue          netv1.Open5GSUserUE
+		sessionType string
+		valid       bool
+	}{
+		{netv1.Open5GSUserUE{IPv4: "10.45.0.10"}, "", true},
+		{netv1.Open5GSUserUE{IPv4: "10.45.0.10"}, "IPv6", false},
+		{netv1.Open5GSUserUE{IPv4: "10.46.0.10"}, "", false},
+		{netv1.Open5GSUserUE{IPv4: "10.45.0.1"}, "", false},
+		{netv1.Open5GSUserUE{IPv4: "10.45.255.255"}, "", false},
+		{netv1.Open5GSUserUE{IPv4: "not-an-ip"}, "", false},
+		{netv1.Open5GSUserUE{IPv6: "2001:db8::1"}, "", false},
+		{netv1.Open5GSUserUE{IPv4: "10.45.0.10", IPv6: "2001:db8::1"}, "IPv4v6", false},
+	}
+	for _, c := range cases {
+		user := netv1.Open5GSUser{Spec: netv1.Open5GSUserSpec{UE: c.ue, PDUSessionType: c.sessionType}}
+		err := validateUEAddresses(user)
+		if c.valid && err != nil {
+			t.Errorf("expected %+v (%s) to be valid, got %v", c.ue, c.sessionType, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("expected %+v (%s) to be rejected", c.ue, c.sessionType)
+		}
+	}
+}
+
+func TestUEPoolConfigured(t *testing.T) {
+	// Static addresses are checked against the pool the SMF and UPF configure
+	smf := CreateSMFConfigMap("default", "test", netv1.Open5GSConfiguration{}, false).Data["smf.yaml"]
+	upf := CreateUPFConfigMap("default", "test", netv1.Open5GSConfiguration{}, false, "eth0").Data["upf.yaml"]
+	for name, config := range map[string]string{"SMF": smf, "UPF": upf} {
+		if !strings.Contains(config, "gateway: "+ueGatewayIPv4+"\n      subnet: "+ueSubnetIPv4+"\n") {
+			t.Errorf("expected the %s config to have the UE pool %s", name, ueSubnetIPv4)
+		}
+		if strings.Count(config, "subnet:") != 1 {
+			t.Errorf("expected the %s config to have a single UE pool", name)
+		}
+	}
+}
+
+func TestSubscriberSessionStaticAddress(t *testing.T) {
+	user := netv1.Open5GSUser{Spec: netv1.Open5GSUserSpec{UE: netv1.Open5GSUserUE{IPv4: "10.45.0.10"}}}
+	session, err := subscriberSession(user, "internet")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ue, ok := session["ue"].(bson.M)
+	if !ok || ue["ipv4"] != "10.45.0.10" {
+		t.Errorf("expected session ue.ipv4 to be set, got %v", session["ue"])
+	}
+	if _, ok := ue["ipv6"]; ok {
+		t.Error("did not expect ue.ipv6 to be set")
+	}
+}
+
+func TestSubscriberSecurityOPType(t *testing.T) {
+	user := netv1.Open5GSUser{Spec: netv1.Open5GSUserSpec{Key: "K", OPC: "OPC", OP: "OP"}}
+	security, err := subscriberSecurity(user)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if security["opc"] != "OPC" || security["op"] != nil || security["amf"] != "8000" {
+		t.Errorf("unexpected OPc security document %v", security)
+	}
+
+	user.Spec.OPType = "OP"
+	user.Spec.AMF = "9001"
+	security, err = subscriberSecurity(user)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if security["op"] != "OP" || security["opc"] != nil || security["amf"] != "9001" {
+		t.Errorf("unexpected OP security document %v", security)
+	}
+
+	user.Spec.OP = ""
+	if _, err := subscriberSecurity(user); err == nil {
+		t.Error("expected an error when opType is OP and op is empty")
+	}
+}
+
+func TestParseSQN(t *testing.T) {
+	cases := map[string]int64{"reset": 0, "32": 32, "0x1F": 31}
+	for in, want := range cases {
+		sqn, err := parseSQN(in)
+		if err != nil || sqn != want {
+			t.Errorf("parseSQN(%q) = %d, %v; expected %d", in, sqn, err, want)
+		}
+	}
+	for _, in := range []string{"-1", "0x1000000000000", "abc"} {
+		if _, err := parseSQN(in); err == nil {
+			t.Errorf("expected parseSQN(%q) to fail", in)
+		}
+	}
+}
+
+func TestSubscriberAccessBarring(t *testing.T) {
+	user := netv1.Open5GSUser{}
+	access, err := subscriberAccess(user)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stored := bson.M{
+		"subscriber_status":           int32(0),
+		"operator_determined_barring": int32(0),
+		"network_access_mode":         int32(0),
+		"access_restriction_data":     int32(32),
+	}
+	if !bsonValuesEqual(access, stored) {
+		t.Errorf("expected defaults %v to match stored document %v", access, stored)
+	}
+
+	barring := int32(1)
+	user.Spec.SubscriberStatus = "OperatorDeterminedBarring"
+	user.Spec.OperatorDeterminedBarring = &barring
+	user.Spec.NetworkAccessMode = "OnlyPacket"
+	access, err = subscriberAccess(user)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if access["subscriber_status"] != int32(1) || access["operator_determined_barring"] != int32(1) || access["network_access_mode"] != int32(2) {
+		t.Errorf("unexpected barred access document %v", access)
+	}
+	if bsonValuesEqual(access, stored) {
+		t.Error("expected a barred subscriber to drift from a granted one")
+	}
+}
@@ -0,0 +1,257 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/go-logr/logr"
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// maxImportErrors bounds the number of errors kept in the import status
+const maxImportErrors = 20
+
+type Open5GSUserImportReconciler struct {
+	client.Client
+	Scheme      *runtime.Scheme
+	Subscribers SubscriberStores
+	Recorder    events.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gsuserimports,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gsuserimports/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gsusers,verbs=get;list;watch;create
+//+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gsuserpools,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;delete
+//+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gses,verbs=get;list;watch
+//+kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
+
+func (r *Open5GSUserImportReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	userImport := &netv1.Open5GSUserImport{}
+	if err := r.Get(ctx, req.NamespacedName, userImport); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if userImport.Status.CompletionTime != nil || !userImport.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	key := open5gsReferenceKey(userImport.Spec.Open5GS, userImport.Namespace)
+	var open5gs netv1.Open5GS
+	if err := r.Get(ctx, key, &open5gs); err != nil {
+		logger.Error(err, "Failed to get Open5GS instance", "Open5GS", key.Name)
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+	if !referenceAllowed(&open5gs, userImport.Namespace) {
+		return r.rejectReference(ctx, userImport, &open5gs, logger)
+	}
+
+	store, err := r.Subscribers.Store(ctx, key)
+	if err != nil {
+		logger.Info("MongoDB not available. Retrying import later.", "open5gs", key.Name, "reason", err.Error())
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+	subscribers, err := store.List(ctx)
+	if err != nil {
+		logger.Error(err, "Failed to list subscribers")
+		return ctrl.Result{}, err
+	}
+
+	status, err := r.importSubscribers(ctx, userImport, &open5gs, subscribers, logger)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	now := metav1.Now()
+	status.CompletionTime = &now
+	userImport.Status = status
+	if err := r.Status().Update(ctx, userImport); err != nil {
+		logger.Error(err, "Failed to update Open5GSUserImport status")
+		return ctrl.Result{}, err
+	}
+	logger.Info("Subscribers imported", "imported", status.Imported, "skipped", status.Skipped, "failed", status.Failed)
+	return ctrl.Result{}, nil
+}
+
+// rejectReference completes an import that references an Open5GS instance of
+// another namespace without being allowed to, with the ReferenceNotAllowed
+// condition and without importing anything
+func (r *Open5GSUserImportReconciler) rejectReference(ctx context.Context, userImport *netv1.Open5GSUserImport, open5gs *netv1.Open5GS, logger logr.Logger) (ctrl.Result, error) {
+	err := fmt.Errorf("Open5GS %s/%s does not allow references from namespace %s", open5gs.Namespace, open5gs.Name, userImport.Namespace)
+	logger.Error(err, "Open5GS reference not allowed", "Open5GS", open5gs.Name)
+	now := metav1.Now()
+	userImport.Status.CompletionTime = &now
+	meta.SetStatusCondition(&userImport.Status.Conditions, metav1.Condition{
+		Type:               netv1.ReferenceNotAllowedCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             "ReferenceNotAllowed",
+		Message:            err.Error(),
+		ObservedGeneration: userImport.Generation,
+	})
+	if err := r.Status().Update(ctx, userImport); err != nil {
+		logger.Error(err, "Failed to update Open5GSUserImport status")
+		return ctrl.Result{}, err
+	}
+	r.Recorder.Eventf(userImport, open5gs, corev1.EventTypeWarning, "ReferenceNotAllowed", "Import", "%v", err)
+	return ctrl.Result{}, nil
+}
+
+// importSubscribers creates an Open5GSUser and a keys Secret for every
+// subscriber that no Open5GSUser or Open5GSUserPool of the instance manages
+// yet. The Secret is created first, so that a user never exists without its
+// keys, and is owned by the user afterward so that it goes away with it.
+func (r *Open5GSUserImportReconciler) importSubscribers(ctx context.Context, userImport *netv1.Open5GSUserImport, open5gs *netv1.Open5GS, subscribers []bson.M, logger logr.Logger) (netv1.Open5GSUserImportStatus, error) {
+	status := netv1.Open5GSUserImportStatus{}
+	fail := func(err error) {
+		status.Failed++
+		if len(status.Errors) < maxImportErrors {
+			status.Errors = append(status.Errors, err.Error())
+		}
+	}
+
+	managed, err := managedIMSIs(ctx, r.Client, open5gs)
+	if err != nil {
+		return status, err
+	}
+
+	for _, subscriber := range subscribers {
+		spec, keys, err := subscriberSpec(subscriber)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		if managed[spec.IMSI] {
+			status.Skipped++
+			continue
+		}
+
+		name := fmt.Sprintf("%simsi-%s", userImport.Spec.NamePrefix, spec.IMSI)
+		spec.Open5GS = netv1.Open5GSReference{Name: open5gs.Name, Namespace: open5gs.Namespace}
+		spec.KeysSecretRef = &corev1.LocalObjectReference{Name: name + "-keys"}
+		user := &netv1.Open5GSUser{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: userImport.Namespace},
+			Spec:       spec,
+		}
+
+		secret, created, err := r.createKeysSecret(ctx, userImport.Namespace, spec.KeysSecretRef.Name, keys)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		if err := r.Create(ctx, user); err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				// The user may come from an earlier attempt of this import that
+				// failed before taking ownership of its Secret
+				existing := &netv1.Open5GSUser{}
+				if err := r.Get(ctx, client.ObjectKeyFromObject(user), existing); err == nil && existing.Spec.IMSI == spec.IMSI &&
+					existing.Spec.KeysSecretRef != nil && existing.Spec.KeysSecretRef.Name == secret.Name {
+					if err := r.ownKeysSecret(ctx, existing, secret); err != nil {
+						fail(err)
+						continue
+					}
+				} else if created {
+					r.deleteKeysSecret(ctx, secret, logger)
+				}
+				status.Skipped++
+				continue
+			}
+			if created {
+				r.deleteKeysSecret(ctx, secret, logger)
+			}
+			fail(fmt.Errorf("failed to create Open5GSUser %s: %v", name, err))
+			continue
+		}
+		if err := r.ownKeysSecret(ctx, user, secret); err != nil {
+			fail(err)
+			continue
+		}
+		logger.Info("Subscriber imported", "IMSI", spec.IMSI, "Open5GSUser", name)
+		status.Imported++
+	}
+	return status, nil
+}
+
+// createKeysSecret creates the Secret holding the keys of an imported
+// subscriber and tells whether it was created. An existing Secret of the same
+// name is only accepted when it holds the same keys.
+func (r *Open5GSUserImportReconciler) createKeysSecret(ctx context.Context, namespace, name string, keys simKeys) (*corev1.Secret, bool, error) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Data:       map[string][]byte{"k": []byte(keys.K)},
+	}
+	if keys.OPC != "" {
+		secret.Data["opc"] = []byte(keys.OPC)
+	}
+	if keys.OP != "" {
+		secret.Data["op"] = []byte(keys.OP)
+	}
+	err := r.Create(ctx, secret)
+	if err == nil {
+		return secret, true, nil
+	}
+	if !apierrors.IsAlreadyExists(err) {
+		return nil, false, fmt.Errorf("failed to create Secret %s: %v", name, err)
+	}
+	existing := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(secret), existing); err != nil {
+		return nil, false, fmt.Errorf("failed to get Secret %s: %v", name, err)
+	}
+	if !maps.EqualFunc(existing.Data, secret.Data, bytes.Equal) {
+		return nil, false, fmt.Errorf("Secret %s already exists with other keys", name)
+	}
+	return existing, false, nil
+}
+
+// ownKeysSecret makes the user the controller of its keys Secret
+func (r *Open5GSUserImportReconciler) ownKeysSecret(ctx context.Context, user *netv1.Open5GSUser, secret *corev1.Secret) error {
+	if metav1.IsControlledBy(secret, user) {
+		return nil
+	}
+	if err := controllerutil.SetControllerReference(user, secret, r.Scheme); err != nil {
+		return fmt.Errorf("failed to set the owner of Secret %s: %v", secret.Name, err)
+	}
+	if err := r.Update(ctx, secret); err != nil {
+		return fmt.Errorf("failed to set the owner of Secret %s: %v", secret.Name, err)
+	}
+	return nil
+}
+
+// deleteKeysSecret removes a Secret created for a user that could not be
+// created
+func (r *Open5GSUserImportReconciler) deleteKeysSecret(ctx context.Context, secret *corev1.Secret, logger logr.Logger) {
+	if err := r.Delete(ctx, secret); err != nil && !apierrors.IsNotFound(err) {
+		logger.Error(err, "Failed to delete keys Secret", "Secret", secret.Name)
+	}
+}
+
+func (r *Open5GSUserImportReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Subscribers == nil {
+		r.Subscribers = &MongoSubscriberStores{Client: mgr.GetClient(), Clients: NewMongoClients()}
+	}
+	if r.Recorder == nil {
+		r.Recorder = mgr.GetEventRecorder("open5gsuserimport-controller")
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&netv1.Open5GSUserImport{}).
+		Complete(r)
+}
@@ -0,0 +1,224 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSubscriberSpecRoundTrip(t *testing.T) {
+	priority := int32(2)
+	user := netv1.Open5GSUser{Spec: netv1.Open5GSUserSpec{
+		IMSI:           "999700000000001",
+		Key:            "465B5CE8B199B49FAA5F0A2EE238A6BC",
+		OP:             "E8ED289DEBA952E4283B54E88E6183CA",
+		OPType:         "OP",
+		AMF:            "9001",
+		SST:            "2",
+		SD:             "000001",
+		APN:            "ims",
+		PDUSessionType: "IPv4",
+		MSISDN:         []string{"34600000001"},
+		UEAMBR:         netv1.Open5GSUserAMBR{Downlink: "2 Gbps", Uplink: "512 Mbps"},
+	}}
+	user.Spec.QoS.ARP.PriorityLevel = &priority
+	user.Spec.QoS.ARP.PreEmptionCapability = "Enabled"
+
+	document, err := newSubscriberDocument(user)
+	if err != nil {
+		t.Fatalf("newSubscriberDocument returned error: %v", err)
+	}
+	stored, err := copyDocument(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, keys, err := subscriberSpec(stored)
+	if err != nil {
+		t.Fatalf("subscriberSpec returned error: %v", err)
+	}
+	if keys.K != user.Spec.Key || keys.OP != user.Spec.OP || keys.OPC != "" {
+		t.Errorf("unexpected keys %+v", keys)
+	}
+	imported := netv1.Open5GSUser{Spec: spec}
+	imported.Spec.Key, imported.Spec.OP = keys.K, keys.OP
+	if repair, err := diffSubscriber(imported, stored); err != nil || !repair.Empty() {
+		t.Errorf("expected the imported spec to match the subscriber, got drift on %v (%v)", repair.Paths, err)
+	}
+
+	if _, _, err := subscriberSpec(bson.M{"imsi": "999700000000002"}); err == nil {
+		t.Error("expected an error for a subscriber without security parameters")
+	}
+}
+
+func TestOpen5GSUserImportReconcile(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = netv1.AddToScheme(scheme)
+
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default"}}
+	existing := &netv1.Open5GSUser{
+		ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "default"},
+		Spec: netv1.Open5GSUserSpec{
+			IMSI:    "999700000000001",
+			Open5GS: netv1.Open5GSReference{Name: "open5gs", Namespace: "default"},
+		},
+	}
+	pool := &netv1.Open5GSUserPool{
+		ObjectMeta: metav1.ObjectMeta{Name: "pool", Namespace: "default"},
+		Spec: netv1.Open5GSUserPoolSpec{
+			IMSIStart: "999700000000004",
+			Count:     1,
+			Open5GS:   netv1.Open5GSReference{Name: "open5gs", Namespace: "default"},
+		},
+	}
+	conflicting := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "legacy-imsi-999700000000005-keys", Namespace: "default"},
+		Data:       map[string][]byte{"k": []byte("00000000000000000000000000000000")},
+	}
+	userImport := &netv1.Open5GSUserImport{
+		ObjectMeta: metav1.ObjectMeta{Name: "import", Namespace: "default"},
+		Spec: netv1.Open5GSUserImportSpec{
+			Open5GS:    netv1.Open5GSReference{Name: "open5gs", Namespace: "default"},
+			NamePrefix: "legacy-",
+		},
+	}
+	stores := NewMemorySubscriberStores()
+	store := stores.For(client.ObjectKeyFromObject(open5gs))
+	for _, imsi := range []string{"999700000000001", "999700000000002", "999700000000004", "999700000000005", "999700000000006"} {
+		document, err := newSubscriberDocument(netv1.Open5GSUser{Spec: netv1.Open5GSUserSpec{
+			IMSI: imsi,
+			Key:  "465B5CE8B199B49FAA5F0A2EE238A6BC",
+			OPC:  "E8ED289DEBA952E4283B54E88E6183CA",
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Insert(ctx, document); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Insert(ctx, bson.M{"imsi": "999700000000003"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reconciler := &Open5GSUserImportReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(open5gs, existing, pool, conflicting, userImport).
+			WithStatusSubresource(&netv1.Open5GSUserImport{}).
+			WithInterceptorFuncs(interceptor.Funcs{Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				if obj.GetName() == "legacy-imsi-999700000000006-keys" {
+					return fmt.Errorf("admission webhook denied the request")
+				}
+				return c.Create(ctx, obj, opts...)
+			}}).Build(),
+		Scheme:      scheme,
+		Subscribers: stores,
+	}
+	if _, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(userImport)}); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+
+	if err := reconciler.Get(ctx, client.ObjectKeyFromObject(userImport), userImport); err != nil {
+		t.Fatal(err)
+	}
+	status := userImport.Status
+	if status.CompletionTime == nil || status.Imported != 1 || status.Skipped != 2 || status.Failed != 3 {
+		t.Errorf("unexpected import status %+v", status)
+	}
+	for _, imsi := range []string{"999700000000004", "999700000000005", "999700000000006"} {
+		name := client.ObjectKey{Name: "legacy-imsi-" + imsi, Namespace: "default"}
+		if err := reconciler.Get(ctx, name, &netv1.Open5GSUser{}); !apierrors.IsNotFound(err) {
+			t.Errorf("expected no Open5GSUser for IMSI %s, got %v", imsi, err)
+		}
+	}
+	if err := reconciler.Get(ctx, client.ObjectKeyFromObject(conflicting), conflicting); err != nil || string(conflicting.Data["k"]) != "00000000000000000000000000000000" {
+		t.Errorf("expected the conflicting Secret to be left untouched, got %v (%v)", conflicting.Data, err)
+	}
+
+	user := &netv1.Open5GSUser{}
+	if err := reconciler.Get(ctx, client.ObjectKey{Name: "legacy-imsi-999700000000002", Namespace: "default"}, user); err != nil {
+		t.Fatalf("imported user was not created: %v", err)
+	}
+	if user.Spec.Key != "" || user.Spec.KeysSecretRef == nil {
+		t.Errorf("expected the keys to be kept out of the spec, got %+v", user.Spec)
+	}
+	secret := &corev1.Secret{}
+	if err := reconciler.Get(ctx, client.ObjectKey{Name: user.Spec.KeysSecretRef.Name, Namespace: "default"}, secret); err != nil {
+		t.Fatalf("keys Secret was not created: %v", err)
+	}
+	if string(secret.Data["k"]) != "465B5CE8B199B49FAA5F0A2EE238A6BC" || string(secret.Data["opc"]) != "E8ED289DEBA952E4283B54E88E6183CA" {
+		t.Errorf("unexpected keys Secret data %v", secret.Data)
+	}
+	if !metav1.IsControlledBy(secret, user) {
+		t.Errorf("expected the keys Secret to be owned by the user, got %v", secret.OwnerReferences)
+	}
+}
+
+func TestOpen5GSUserImportCrossNamespaceReference(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = netv1.AddToScheme(scheme)
+
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "core", Namespace: "platform"}}
+	userImport := &netv1.Open5GSUserImport{
+		ObjectMeta: metav1.ObjectMeta{Name: "import", Namespace: "team-a"},
+		Spec:       netv1.Open5GSUserImportSpec{Open5GS: netv1.Open5GSReference{Name: "core", Namespace: "platform"}},
+	}
+	stores := NewMemorySubscriberStores()
+	if err := stores.For(client.ObjectKeyFromObject(open5gs)).Insert(ctx, bson.M{"imsi": "999700000000001"}); err != nil {
+		t.Fatal(err)
+	}
+	recorder := events.NewFakeRecorder(10)
+	reconciler := &Open5GSUserImportReconciler{
+		Client:      fake.NewClientBuilder().WithScheme(scheme).WithObjects(open5gs, userImport).WithStatusSubresource(&netv1.Open5GSUserImport{}).Build(),
+		Scheme:      scheme,
+		Subscribers: stores,
+		Recorder:    recorder,
+	}
+	if _, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(userImport)}); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+
+	if err := reconciler.Get(ctx, client.ObjectKeyFromObject(userImport), userImport); err != nil {
+		t.Fatal(err)
+	}
+	if userImport.Status.CompletionTime == nil || userImport.Status.Imported != 0 {
+		t.Errorf("expected the import to complete without importing anything, got %+v", userImport.Status)
+	}
+	if !meta.IsStatusConditionTrue(userImport.Status.Conditions, netv1.ReferenceNotAllowedCondition) {
+		t.Errorf("expected the ReferenceNotAllowed condition, got %v", userImport.Status.Conditions)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "Warning ReferenceNotAllowed") {
+		t.Errorf("expected a ReferenceNotAllowed warning event, got %q", event)
+	}
+	var users netv1.Open5GSUserList
+	if err := reconciler.List(ctx, &users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users.Items) != 0 {
+		t.Errorf("did not expect any Open5GSUser, got %d", len(users.Items))
+	}
+}
@@ -0,0 +1,172 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"fmt"
+	"strconv"
+
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// subscriberSpec builds the Open5GSUser spec and the key material that
+// describe a stored subscriber, so that the document built back from them has
+// no drift. Only the first slice and its first session are imported.
+func subscriberSpec(subscriber bson.M) (netv1.Open5GSUserSpec, simKeys, error) {
+	spec := netv1.Open5GSUserSpec{}
+	keys := simKeys{}
+
+	imsi, ok := subscriber["imsi"].(string)
+	if !ok || imsi == "" {
+		return spec, keys, fmt.Errorf("subscriber without IMSI")
+	}
+	spec.IMSI = imsi
+
+	security, ok := subscriber["security"].(bson.M)
+	if !ok {
+		return spec, keys, fmt.Errorf("subscriber %s has no security parameters", imsi)
+	}
+	keys.K, _ = security["k"].(string)
+	keys.OPC, _ = security["opc"].(string)
+	keys.OP, _ = security["op"].(string)
+	if keys.K == "" || (keys.OPC == "" && keys.OP == "") {
+		return spec, keys, fmt.Errorf("subscriber %s has no K and OPc or OP", imsi)
+	}
+	if keys.OPC == "" {
+		spec.OPType = "OP"
+	}
+	if amf, ok := security["amf"].(string); ok && amf != "8000" {
+		spec.AMF = amf
+	}
+
+	if err := importSlice(&spec, subscriber); err != nil {
+		return spec, keys, fmt.Errorf("subscriber %s: %v", imsi, err)
+	}
+
+	if ambr, ok := subscriber["ambr"].(bson.M); ok {
+		spec.UEAMBR = importAMBR(ambr)
+	}
+	if msisdn, ok := subscriber["msisdn"].(bson.A); ok {
+		for _, number := range msisdn {
+			if number, ok := number.(string); ok {
+				spec.MSISDN = append(spec.MSISDN, number)
+			}
+		}
+	}
+	if imeisv, ok := subscriber["imeisv"].(bson.A); ok && len(imeisv) > 0 {
+		spec.IMEISV, _ = imeisv[0].(string)
+	}
+
+	if status, _ := bsonInt(subscriber["subscriber_status"]); status == 1 {
+		spec.SubscriberStatus = "OperatorDeterminedBarring"
+		if barring, ok := bsonInt(subscriber["operator_determined_barring"]); ok {
+			value := int32(barring)
+			spec.OperatorDeterminedBarring = &value
+		}
+	}
+	if mode, _ := bsonInt(subscriber["network_access_mode"]); mode == 2 {
+		spec.NetworkAccessMode = "OnlyPacket"
+	}
+	if restriction, ok := bsonInt(subscriber["access_restriction_data"]); ok && restriction != 32 {
+		value := int32(restriction)
+		spec.AccessRestrictionData = &value
+	}
+	return spec, keys, nil
+}
+
+// importSlice fills the slice and default session fields of the spec
+func importSlice(spec *netv1.Open5GSUserSpec, subscriber bson.M) error {
+	slices, ok := subscriber["slice"].(bson.A)
+	if !ok || len(slices) == 0 {
+		return fmt.Errorf("no slice")
+	}
+	slice, ok := slices[0].(bson.M)
+	if !ok {
+		return fmt.Errorf("invalid slice")
+	}
+	if sst, ok := bsonInt(slice["sst"]); ok {
+		spec.SST = strconv.FormatInt(sst, 10)
+	}
+	spec.SD, _ = slice["sd"].(string)
+
+	sessions, ok := slice["session"].(bson.A)
+	if !ok || len(sessions) == 0 {
+		return fmt.Errorf("no session")
+	}
+	session, ok := sessions[0].(bson.M)
+	if !ok {
+		return fmt.Errorf("invalid session")
+	}
+	spec.APN, _ = session["name"].(string)
+	switch sessionType, _ := bsonInt(session["type"]); sessionType {
+	case 1:
+		spec.PDUSessionType = "IPv4"
+	case 2:
+		spec.PDUSessionType = "IPv6"
+	}
+
+	if qos, ok := session["qos"].(bson.M); ok {
+		if index, ok := bsonInt(qos["index"]); ok {
+			value := int32(index)
+			spec.QoS.Index = &value
+		}
+		if arp, ok := qos["arp"].(bson.M); ok {
+			if level, ok := bsonInt(arp["priority_level"]); ok {
+				value := int32(level)
+				spec.QoS.ARP.PriorityLevel = &value
+			}
+			spec.QoS.ARP.PreEmptionCapability = importPreEmption(arp["pre_emption_capability"])
+			spec.QoS.ARP.PreEmptionVulnerability = importPreEmption(arp["pre_emption_vulnerability"])
+		}
+	}
+	if ambr, ok := session["ambr"].(bson.M); ok {
+		spec.SessionAMBR = importAMBR(ambr)
+	}
+	if ue, ok := session["ue"].(bson.M); ok {
+		spec.UE.IPv4, _ = ue["ipv4"].(string)
+		spec.UE.IPv6, _ = ue["ipv6"].(string)
+	}
+	return nil
+}
+
+func importPreEmption(value interface{}) string {
+	switch n, _ := bsonInt(value); n {
+	case 1:
+		return "Disabled"
+	case 2:
+		return "Enabled"
+	}
+	return ""
+}
+
+func importAMBR(ambr bson.M) netv1.Open5GSUserAMBR {
+	return netv1.Open5GSUserAMBR{
+		Downlink: formatBitrate(ambr["downlink"]),
+		Uplink:   formatBitrate(ambr["uplink"]),
+	}
+}
+
+// formatBitrate is the inverse of parseBitrate
+func formatBitrate(bitrate interface{}) string {
+	document, ok := bitrate.(bson.M)
+	if !ok {
+		return ""
+	}
+	value, ok := bsonInt(document["value"])
+	if !ok {
+		return ""
+	}
+	unit, _ := bsonInt(document["unit"])
+	for name, code := range bitrateUnits {
+		if int64(code) == unit {
+			return fmt.Sprintf("%d %s", value, name)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,346 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+type Open5GSUserPoolReconciler struct {
+	client.Client
+	Scheme      *runtime.Scheme
+	Subscribers SubscriberStores
+	// ResyncPeriod is the interval of the periodic reconciliation of each
+	// pool. It is jittered; zero disables it.
+	ResyncPeriod time.Duration
+	// DeletionTimeout bounds the time a deleted pool waits for its
+	// subscribers to be deleted before its finalizer is removed anyway. Zero
+	// waits forever.
+	DeletionTimeout time.Duration
+	Recorder        events.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gsuserpools,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gsuserpools/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gsuserpools/finalizers,verbs=update
+//+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gsusers,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch
+//+kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch
+//+kubebuilder:rbac:groups=net.gradiant.org,resources=open5gses,verbs=get;list;watch
+//+kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
+
+const (
+	Open5GSUserPoolFinalizer = "finalizer.open5gsuserpool.net.gradiant.org/pool"
+)
+
+func (r *Open5GSUserPoolReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	defer func(start time.Time) { observeReconcile("Open5GSUserPool", start, err) }(time.Now())
+	logger := log.FromContext(ctx)
+	pool := &netv1.Open5GSUserPool{}
+	if err := r.Get(ctx, req.NamespacedName, pool); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// Get the referenced Open5GS instance. It is nil once the instance is gone.
+	open5gs := &netv1.Open5GS{}
+	if err := r.Get(ctx, poolOpen5GSKey(pool), open5gs); err != nil {
+		if !apierrors.IsNotFound(err) {
+			logger.Error(err, "Failed to get Open5GS instance", "Open5GS", pool.Spec.Open5GS.Name)
+			return ctrl.Result{}, err
+		}
+		open5gs = nil
+	} else if !referenceAllowed(open5gs, pool.Namespace) {
+		return r.rejectReference(ctx, pool, open5gs, logger)
+	}
+
+	if !pool.ObjectMeta.DeletionTimestamp.IsZero() {
+		if containsString(pool.ObjectMeta.Finalizers, Open5GSUserPoolFinalizer) {
+			if err := r.deletePool(ctx, pool, open5gs, logger); err != nil {
+				if r.DeletionTimeout == 0 {
+					logger.Error(err, "Failed to delete pool subscribers from MongoDB")
+					return ctrl.Result{}, err
+				}
+				if remaining := time.Until(pool.DeletionTimestamp.Add(r.DeletionTimeout)); remaining > 0 {
+					logger.Error(err, "Failed to delete pool subscribers from MongoDB. Retrying.", "timeout", remaining.Round(time.Second).String())
+					return ctrl.Result{RequeueAfter: min(remaining, 10*time.Second)}, nil
+				}
+				logger.Error(err, "Deletion timeout reached. Removing finalizer without deleting the pool subscribers.")
+			}
+			pool.ObjectMeta.Finalizers = removeString(pool.ObjectMeta.Finalizers, Open5GSUserPoolFinalizer)
+			if err := r.Update(ctx, pool); err != nil {
+				logger.Error(err, "Failed to remove finalizer from Open5GSUserPool")
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if !containsString(pool.ObjectMeta.Finalizers, Open5GSUserPoolFinalizer) {
+		pool.ObjectMeta.Finalizers = append(pool.ObjectMeta.Finalizers, Open5GSUserPoolFinalizer)
+		if err := r.Update(ctx, pool); err != nil {
+			logger.Error(err, "Failed to add finalizer to Open5GSUserPool")
+			return ctrl.Result{}, err
+		}
+	}
+
+	if err := r.reconcilePool(ctx, pool, logger); err != nil {
+		logger.Error(err, "Failed to reconcile Open5GSUserPool")
+		return ctrl.Result{}, err
+	}
+
+	return resyncResult(r.ResyncPeriod), nil
+}
+
+func (r *Open5GSUserPoolReconciler) reconcilePool(ctx context.Context, pool *netv1.Open5GSUserPool, logger logr.Logger) error {
+	imsis, err := imsiRange(pool.Spec.IMSIStart, pool.Spec.Count)
+	if err != nil {
+		return err
+	}
+	keys, err := loadPoolKeys(ctx, r.Client, pool)
+	if err != nil {
+		return err
+	}
+	claimed, err := r.claimedIMSIs(ctx, pool)
+	if err != nil {
+		return err
+	}
+
+	store, err := r.Subscribers.Store(ctx, poolOpen5GSKey(pool))
+	if err != nil {
+		logger.Info("MongoDB not available. Skipping reconciliation.", "open5gs", pool.Spec.Open5GS.Name, "reason", err.Error())
+		return nil
+	}
+
+	status := netv1.Open5GSUserPoolStatus{IMSIStart: pool.Spec.IMSIStart, Count: pool.Spec.Count, Conditions: pool.Status.Conditions}
+	meta.RemoveStatusCondition(&status.Conditions, netv1.ReferenceNotAllowedCondition)
+	users := make([]netv1.Open5GSUser, 0, len(imsis))
+	for _, imsi := range imsis {
+		if claimed[imsi] {
+			status.Conflicts++
+			continue
+		}
+		imsiKeys, ok := keys[imsi]
+		if !ok {
+			status.MissingKeys++
+			continue
+		}
+		users = append(users, poolUser(pool, imsi, imsiKeys))
+	}
+
+	stale, err := r.staleIMSIs(pool, imsis, claimed)
+	if err != nil {
+		return err
+	}
+
+	open5gs := poolOpen5GSKey(pool)
+	result, err := syncPoolSubscribers(ctx, store, users, stale)
+	subscriberDriftCorrections.WithLabelValues(open5gs.Namespace, open5gs.Name).Add(float64(result.Updated))
+	if err != nil {
+		subscriberProvisioningFailures.WithLabelValues(open5gs.Namespace, open5gs.Name).Inc()
+		return err
+	}
+	if result.Created > 0 || result.Updated > 0 || result.Deleted > 0 {
+		logger.Info("Pool subscribers synchronized", "created", result.Created, "updated", result.Updated, "deleted", result.Deleted)
+	}
+
+	status.Provisioned = result.Provisioned
+	status.Created = result.Created
+	status.Updated = result.Updated
+	status.Deleted = result.Deleted
+	if equality.Semantic.DeepEqual(status, pool.Status) {
+		return nil
+	}
+	pool.Status = status
+	return r.Status().Update(ctx, pool)
+}
+
+// staleIMSIs returns the IMSIs of the previously provisioned range that are no
+// longer part of the pool, except those an Open5GSUser manages
+func (r *Open5GSUserPoolReconciler) staleIMSIs(pool *netv1.Open5GSUserPool, imsis []string, claimed map[string]bool) ([]string, error) {
+	if pool.Status.IMSIStart == "" {
+		return nil, nil
+	}
+	previous, err := imsiRange(pool.Status.IMSIStart, pool.Status.Count)
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]bool, len(imsis))
+	for _, imsi := range imsis {
+		current[imsi] = true
+	}
+	stale := []string{}
+	for _, imsi := range previous {
+		if !current[imsi] && !claimed[imsi] {
+			stale = append(stale, imsi)
+		}
+	}
+	return stale, nil
+}
+
+// claimedIMSIs returns the IMSIs managed by an Open5GSUser of the same Open5GS
+// instance, which take precedence over the pool
+func (r *Open5GSUserPoolReconciler) claimedIMSIs(ctx context.Context, pool *netv1.Open5GSUserPool) (map[string]bool, error) {
+	var userList netv1.Open5GSUserList
+	if err := r.List(ctx, &userList); err != nil {
+		return nil, err
+	}
+	claimed := make(map[string]bool)
+	for _, user := range userList.Items {
+		if open5gsKey(&user) == poolOpen5GSKey(pool) {
+			claimed[user.Spec.IMSI] = true
+		}
+	}
+	return claimed, nil
+}
+
+// deletePool deletes the subscribers of the pool that no Open5GSUser manages.
+// Nothing is left to clean up once the instance or its MongoDB is gone; an
+// unreachable MongoDB is an error so that the deletion is retried.
+func (r *Open5GSUserPoolReconciler) deletePool(ctx context.Context, pool *netv1.Open5GSUserPool, open5gs *netv1.Open5GS, logger logr.Logger) error {
+	if open5gs == nil || !open5gs.DeletionTimestamp.IsZero() || (open5gs.Spec.MongoDB.Enabled != nil && !*open5gs.Spec.MongoDB.Enabled) {
+		logger.Info("Open5GS instance or its MongoDB is gone. Nothing to clean up.")
+		return nil
+	}
+	start, count := pool.Status.IMSIStart, pool.Status.Count
+	if start == "" {
+		start, count = pool.Spec.IMSIStart, pool.Spec.Count
+	}
+	imsis, err := imsiRange(start, count)
+	if err != nil {
+		return err
+	}
+	claimed, err := r.claimedIMSIs(ctx, pool)
+	if err != nil {
+		return err
+	}
+	owned := make([]string, 0, len(imsis))
+	for _, imsi := range imsis {
+		if !claimed[imsi] {
+			owned = append(owned, imsi)
+		}
+	}
+
+	store, err := r.Subscribers.Store(ctx, poolOpen5GSKey(pool))
+	if err != nil {
+		return fmt.Errorf("MongoDB not available: %v", err)
+	}
+	if _, err := store.Delete(ctx, owned...); err != nil {
+		return err
+	}
+	logger.Info("Pool subscribers deleted from MongoDB", "count", len(owned))
+	return nil
+}
+
+// rejectReference handles a pool that references an Open5GS instance of
+// another namespace without being allowed to
+func (r *Open5GSUserPoolReconciler) rejectReference(ctx context.Context, pool *netv1.Open5GSUserPool, open5gs *netv1.Open5GS, logger logr.Logger) (ctrl.Result, error) {
+	if !pool.ObjectMeta.DeletionTimestamp.IsZero() {
+		if containsString(pool.ObjectMeta.Finalizers, Open5GSUserPoolFinalizer) {
+			pool.ObjectMeta.Finalizers = removeString(pool.ObjectMeta.Finalizers, Open5GSUserPoolFinalizer)
+			if err := r.Update(ctx, pool); err != nil {
+				logger.Error(err, "Failed to remove finalizer from Open5GSUserPool")
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+	err := fmt.Errorf("Open5GS %s/%s does not allow references from namespace %s", open5gs.Namespace, open5gs.Name, pool.Namespace)
+	logger.Error(err, "Open5GS reference not allowed", "Open5GS", open5gs.Name)
+	changed := meta.SetStatusCondition(&pool.Status.Conditions, metav1.Condition{
+		Type:               netv1.ReferenceNotAllowedCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             "ReferenceNotAllowed",
+		Message:            err.Error(),
+		ObservedGeneration: pool.Generation,
+	})
+	if changed {
+		r.Recorder.Eventf(pool, open5gs, corev1.EventTypeWarning, "ReferenceNotAllowed", "Reconcile", "%v", err)
+		if err := r.Status().Update(ctx, pool); err != nil {
+			logger.Error(err, "Failed to update Open5GSUserPool status")
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// keysRequests enqueues the pools that read their keys from the Secret or
+// ConfigMap, so that keys added for their missing IMSIs are provisioned right
+// away
+func keysRequests(c client.Client) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		var pools netv1.Open5GSUserPoolList
+		if err := c.List(ctx, &pools, client.InNamespace(obj.GetNamespace())); err != nil {
+			return nil
+		}
+		_, secret := obj.(*corev1.Secret)
+		var requests []reconcile.Request
+		for i := range pools.Items {
+			keys := pools.Items[i].Spec.Keys
+			if (secret && keys.SecretRef != nil && keys.SecretRef.Name == obj.GetName()) ||
+				(!secret && keys.ConfigMapRef != nil && keys.ConfigMapRef.Name == obj.GetName()) {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&pools.Items[i])})
+			}
+		}
+		return requests
+	}
+}
+
+// poolOpen5GSKey returns the key of the Open5GS instance referenced by the pool
+func poolOpen5GSKey(pool *netv1.Open5GSUserPool) client.ObjectKey {
+	return open5gsReferenceKey(pool.Spec.Open5GS, pool.Namespace)
+}
+
+func (r *Open5GSUserPoolReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Subscribers == nil {
+		r.Subscribers = &MongoSubscriberStores{Client: mgr.GetClient(), Clients: NewMongoClients()}
+	}
+	if r.Recorder == nil {
+		r.Recorder = mgr.GetEventRecorder("open5gsuserpool-controller")
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &netv1.Open5GSUserPool{}, open5gsRefIndex, func(obj client.Object) []string {
+		return []string{poolOpen5GSKey(obj.(*netv1.Open5GSUserPool)).String()}
+	}); err != nil {
+		return err
+	}
+
+	enqueuePools := handler.EnqueueRequestsFromMapFunc(referencingRequests(mgr.GetClient(), func() client.ObjectList {
+		return &netv1.Open5GSUserPoolList{}
+	}))
+	// Pools are also reconciled when the Secret or ConfigMap of their keys
+	// changes
+	enqueueKeyPools := handler.EnqueueRequestsFromMapFunc(keysRequests(mgr.GetClient()))
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&netv1.Open5GSUserPool{}).
+		Watches(&corev1.Secret{}, enqueueKeyPools).
+		Watches(&corev1.ConfigMap{}, enqueueKeyPools).
+		Watches(&netv1.Open5GS{}, enqueuePools, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&corev1.Service{}, enqueuePools, builder.WithPredicates(mongoServicePredicate)).
+		Watches(&discoveryv1.EndpointSlice{}, enqueuePools, builder.WithPredicates(mongoServicePredicate)).
+		Complete(r)
+}
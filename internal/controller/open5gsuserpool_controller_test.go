@@ -0,0 +1,278 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func newTestPoolReconciler(t *testing.T, objects ...client.Object) (*Open5GSUserPoolReconciler, *MemorySubscriberStores) {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := netv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	stores := NewMemorySubscriberStores()
+	reconciler := &Open5GSUserPoolReconciler{
+		Client:      fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).WithStatusSubresource(&netv1.Open5GSUserPool{}).Build(),
+		Scheme:      scheme,
+		Subscribers: stores,
+		Recorder:    events.NewFakeRecorder(10),
+	}
+	return reconciler, stores
+}
+
+func TestOpen5GSUserPoolShrink(t *testing.T) {
+	ctx := context.Background()
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default"}}
+	keys := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "keys", Namespace: "default"}, Data: map[string][]byte{}}
+	for _, imsi := range []string{"999700000000100", "999700000000101", "999700000000102", "999700000000103"} {
+		keys.Data[imsi+".k"] = []byte("465B5CE8B199B49FAA5F0A2EE238A6BC")
+		keys.Data[imsi+".opc"] = []byte("E8ED289DEBA952E4283B54E88E6183CA")
+	}
+	pool := &netv1.Open5GSUserPool{
+		ObjectMeta: metav1.ObjectMeta{Name: "pool", Namespace: "default", Finalizers: []string{Open5GSUserPoolFinalizer}},
+		Spec: netv1.Open5GSUserPoolSpec{
+			IMSIStart: "999700000000100",
+			Count:     4,
+			Keys:      netv1.Open5GSUserPoolKeys{SecretRef: &corev1.LocalObjectReference{Name: "keys"}},
+			Open5GS:   netv1.Open5GSReference{Name: "open5gs"},
+		},
+	}
+	// An Open5GSUser manages an IMSI of the range, and wrote its subscriber
+	user := &netv1.Open5GSUser{
+		ObjectMeta: metav1.ObjectMeta{Name: "user", Namespace: "default"},
+		Spec:       netv1.Open5GSUserSpec{IMSI: "999700000000103", Open5GS: netv1.Open5GSReference{Name: "open5gs"}},
+	}
+	reconciler, stores := newTestPoolReconciler(t, open5gs, keys, pool, user)
+	store := stores.For(client.ObjectKeyFromObject(open5gs))
+	if err := store.Insert(ctx, bson.M{"imsi": "999700000000103"}); err != nil {
+		t.Fatal(err)
+	}
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(pool)}
+	if _, err := reconciler.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if err := reconciler.Get(ctx, request.NamespacedName, pool); err != nil {
+		t.Fatal(err)
+	}
+	if pool.Status.Provisioned != 3 || pool.Status.Conflicts != 1 {
+		t.Fatalf("expected 3 subscribers provisioned and 1 conflict, got %+v", pool.Status)
+	}
+
+	// Shrinking the pool over the IMSI of the user keeps its subscriber
+	pool.Spec.Count = 2
+	if err := reconciler.Update(ctx, pool); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reconciler.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if _, err := store.Get(ctx, "999700000000102"); err == nil {
+		t.Error("expected the subscriber left out of the pool to be deleted")
+	}
+	if _, err := store.Get(ctx, "999700000000103"); err != nil {
+		t.Errorf("expected the subscriber of the user to be kept, got %v", err)
+	}
+}
+
+func TestKeysRequests(t *testing.T) {
+	ctx := context.Background()
+	secretPool := &netv1.Open5GSUserPool{
+		ObjectMeta: metav1.ObjectMeta{Name: "secret-pool", Namespace: "default"},
+		Spec:       netv1.Open5GSUserPoolSpec{Keys: netv1.Open5GSUserPoolKeys{SecretRef: &corev1.LocalObjectReference{Name: "keys"}}},
+	}
+	configMapPool := &netv1.Open5GSUserPool{
+		ObjectMeta: metav1.ObjectMeta{Name: "configmap-pool", Namespace: "default"},
+		Spec: netv1.Open5GSUserPoolSpec{Keys: netv1.Open5GSUserPoolKeys{ConfigMapRef: &corev1.ConfigMapKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "keys"},
+			Key:                  "keys.csv",
+		}}},
+	}
+	reconciler, _ := newTestPoolReconciler(t, secretPool, configMapPool)
+	mapKeys := keysRequests(reconciler.Client)
+
+	cases := []struct {
+		obj  client.Object
+		want string
+	}{
+		{&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "keys", Namespace: "default"}}, "secret-pool"},
+		{&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "keys", Namespace: "default"}}, "configmap-pool"},
+		{&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"}}, ""},
+		{&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "keys", Namespace: "other"}}, ""},
+	}
+	for _, c := range cases {
+		requests := mapKeys(ctx, c.obj)
+		if c.want == "" && len(requests) != 0 {
+			t.Errorf("did not expect %s/%s to enqueue a pool, got %v", c.obj.GetNamespace(), c.obj.GetName(), requests)
+		}
+		if c.want != "" && (len(requests) != 1 || requests[0].Name != c.want) {
+			t.Errorf("expected %T %s to enqueue %s, got %v", c.obj, c.obj.GetName(), c.want, requests)
+		}
+	}
+}
+
+func TestOpen5GSUserPoolDeletion(t *testing.T) {
+	ctx := context.Background()
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default"}}
+	pool := &netv1.Open5GSUserPool{
+		ObjectMeta: metav1.ObjectMeta{Name: "pool", Namespace: "default", Finalizers: []string{Open5GSUserPoolFinalizer}},
+		Spec: netv1.Open5GSUserPoolSpec{
+			IMSIStart: "999700000000100",
+			Count:     3,
+			Open5GS:   netv1.Open5GSReference{Name: "open5gs"},
+		},
+		Status: netv1.Open5GSUserPoolStatus{IMSIStart: "999700000000100", Count: 3},
+	}
+	reconciler, stores := newTestPoolReconciler(t, open5gs, pool)
+	store := stores.For(client.ObjectKeyFromObject(open5gs))
+	if err := store.Insert(ctx, bson.M{"imsi": "999700000000100"}, bson.M{"imsi": "999700000000101"}, bson.M{"imsi": "999700000000200"}); err != nil {
+		t.Fatal(err)
+	}
+	reconciler.Subscribers = unavailableStores{}
+	reconciler.DeletionTimeout = time.Hour
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(pool)}
+
+	if err := reconciler.Delete(ctx, pool); err != nil {
+		t.Fatal(err)
+	}
+	result, err := reconciler.Reconcile(ctx, request)
+	if err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if result.RequeueAfter == 0 {
+		t.Error("expected the deletion to be retried while MongoDB is unreachable")
+	}
+	if err := reconciler.Get(ctx, request.NamespacedName, pool); err != nil {
+		t.Fatalf("expected the finalizer to be kept while MongoDB is unreachable, got %v", err)
+	}
+
+	reconciler.Subscribers = stores
+	if _, err := reconciler.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if err := reconciler.Get(ctx, request.NamespacedName, pool); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the finalizer to be removed, got %v", err)
+	}
+	subscribers, _ := store.List(ctx)
+	if len(subscribers) != 1 || subscribers[0]["imsi"] != "999700000000200" {
+		t.Errorf("expected only the subscribers of the pool to be deleted, got %v", subscribers)
+	}
+}
+
+func TestOpen5GSUserPoolDeletionTimeout(t *testing.T) {
+	ctx := context.Background()
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "open5gs", Namespace: "default"}}
+	pool := &netv1.Open5GSUserPool{
+		ObjectMeta: metav1.ObjectMeta{Name: "pool", Namespace: "default", Finalizers: []string{Open5GSUserPoolFinalizer}},
+		Spec: netv1.Open5GSUserPoolSpec{
+			IMSIStart: "999700000000100",
+			Count:     3,
+			Open5GS:   netv1.Open5GSReference{Name: "open5gs"},
+		},
+	}
+	reconciler, _ := newTestPoolReconciler(t, open5gs, pool)
+	reconciler.Subscribers = unavailableStores{}
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(pool)}
+
+	if err := reconciler.Delete(ctx, pool); err != nil {
+		t.Fatal(err)
+	}
+	errors := testutil.ToFloat64(reconcileErrors.WithLabelValues("Open5GSUserPool"))
+	if _, err := reconciler.Reconcile(ctx, request); err == nil {
+		t.Error("expected an error without a deletion timeout")
+	}
+	if got := testutil.ToFloat64(reconcileErrors.WithLabelValues("Open5GSUserPool")) - errors; got != 1 {
+		t.Errorf("expected the failed deletion to be counted as a reconcile error, got %v", got)
+	}
+	if err := reconciler.Get(ctx, request.NamespacedName, pool); err != nil {
+		t.Fatalf("expected the finalizer to be kept, got %v", err)
+	}
+
+	reconciler.DeletionTimeout = time.Nanosecond
+	if _, err := reconciler.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if err := reconciler.Get(ctx, request.NamespacedName, pool); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the finalizer to be removed after the timeout, got %v", err)
+	}
+}
+
+func TestOpen5GSUserPoolCrossNamespaceReference(t *testing.T) {
+	ctx := context.Background()
+	open5gs := &netv1.Open5GS{ObjectMeta: metav1.ObjectMeta{Name: "core", Namespace: "platform"}}
+	keys := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "keys", Namespace: "team-a"},
+		Data:       map[string]string{"keys.csv": "999700000000100,465B5CE8B199B49FAA5F0A2EE238A6BC,E8ED289DEBA952E4283B54E88E6183CA\n"},
+	}
+	pool := &netv1.Open5GSUserPool{
+		ObjectMeta: metav1.ObjectMeta{Name: "pool", Namespace: "team-a", Finalizers: []string{Open5GSUserPoolFinalizer}},
+		Spec: netv1.Open5GSUserPoolSpec{
+			IMSIStart: "999700000000100",
+			Count:     1,
+			Keys:      netv1.Open5GSUserPoolKeys{ConfigMapRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "keys"}, Key: "keys.csv"}},
+			Open5GS:   netv1.Open5GSReference{Name: "core", Namespace: "platform"},
+		},
+	}
+	reconciler, stores := newTestPoolReconciler(t, open5gs, keys, pool)
+	store := stores.For(client.ObjectKeyFromObject(open5gs))
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(pool)}
+
+	if _, err := reconciler.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if _, err := store.Get(ctx, "999700000000100"); err != ErrSubscriberNotFound {
+		t.Fatalf("expected the reference to be rejected, got %v", err)
+	}
+	if err := reconciler.Get(ctx, request.NamespacedName, pool); err != nil {
+		t.Fatal(err)
+	}
+	if !meta.IsStatusConditionTrue(pool.Status.Conditions, netv1.ReferenceNotAllowedCondition) {
+		t.Errorf("expected the ReferenceNotAllowed condition, got %v", pool.Status.Conditions)
+	}
+	if event := <-reconciler.Recorder.(*events.FakeRecorder).Events; !strings.Contains(event, "Warning ReferenceNotAllowed") {
+		t.Errorf("expected a ReferenceNotAllowed warning event, got %q", event)
+	}
+
+	open5gs.Spec.AllowedUserNamespaces = []string{"team-a"}
+	if err := reconciler.Update(ctx, open5gs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reconciler.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if _, err := store.Get(ctx, "999700000000100"); err != nil {
+		t.Errorf("expected the subscriber to be created once the namespace is allowed, got %v", err)
+	}
+	if err := reconciler.Get(ctx, request.NamespacedName, pool); err != nil {
+		t.Fatal(err)
+	}
+	if meta.FindStatusCondition(pool.Status.Conditions, netv1.ReferenceNotAllowedCondition) != nil || pool.Status.Provisioned != 1 {
+		t.Errorf("expected the pool to be provisioned without the ReferenceNotAllowed condition, got %+v", pool.Status)
+	}
+}
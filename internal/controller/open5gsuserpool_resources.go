@@ -0,0 +1,213 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// simKeys is the key material of a SIM
+type simKeys struct {
+	K   string
+	OPC string
+	OP  string
+}
+
+// poolSyncResult counts the subscribers written by syncPoolSubscribers
+type poolSyncResult struct {
+	Provisioned int32
+	Created     int32
+	Updated     int32
+	Deleted     int32
+}
+
+// imsiRange returns count consecutive IMSIs starting at start, keeping the
+// number of digits of start.
+func imsiRange(start string, count int32) ([]string, error) {
+	first, err := strconv.ParseUint(start, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IMSI %q: %v", start, err)
+	}
+	if count <= 0 {
+		return []string{}, nil
+	}
+	last := strconv.FormatUint(first+uint64(count)-1, 10)
+	if len(last) > len(start) {
+		return nil, fmt.Errorf("IMSI range starting at %s with %d entries overflows %d digits", start, count, len(start))
+	}
+	imsis := make([]string, 0, count)
+	for i := uint64(0); i < uint64(count); i++ {
+		imsi := strconv.FormatUint(first+i, 10)
+		imsis = append(imsis, strings.Repeat("0", len(start)-len(imsi))+imsi)
+	}
+	return imsis, nil
+}
+
+// loadPoolKeys reads the key material of the pool from its Secret or ConfigMap
+func loadPoolKeys(ctx context.Context, c client.Client, pool *netv1.Open5GSUserPool) (map[string]simKeys, error) {
+	opField := "opc"
+	if pool.Spec.Template.OPType == "OP" {
+		opField = "op"
+	}
+	keys := pool.Spec.Keys
+	switch {
+	case keys.SecretRef != nil && keys.ConfigMapRef != nil:
+		return nil, fmt.Errorf("only one of keys.secretRef and keys.configMapRef can be set")
+	case keys.SecretRef != nil:
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, client.ObjectKey{Name: keys.SecretRef.Name, Namespace: pool.Namespace}, secret); err != nil {
+			return nil, err
+		}
+		return parseSecretKeys(secret.Data, opField), nil
+	case keys.ConfigMapRef != nil:
+		configMap := &corev1.ConfigMap{}
+		if err := c.Get(ctx, client.ObjectKey{Name: keys.ConfigMapRef.Name, Namespace: pool.Namespace}, configMap); err != nil {
+			return nil, err
+		}
+		data, ok := configMap.Data[keys.ConfigMapRef.Key]
+		if !ok {
+			return nil, fmt.Errorf("key %q not found in ConfigMap %s", keys.ConfigMapRef.Key, keys.ConfigMapRef.Name)
+		}
+		return parseCSVKeys(strings.NewReader(data), opField)
+	}
+	return nil, fmt.Errorf("one of keys.secretRef and keys.configMapRef must be set")
+}
+
+// parseSecretKeys reads the "<imsi>.k" and "<imsi>.<opField>" entries of a Secret
+func parseSecretKeys(data map[string][]byte, opField string) map[string]simKeys {
+	result := make(map[string]simKeys)
+	for name, value := range data {
+		imsi, ok := strings.CutSuffix(name, ".k")
+		if !ok {
+			continue
+		}
+		op, ok := data[imsi+"."+opField]
+		if !ok {
+			continue
+		}
+		result[imsi] = newSIMKeys(string(value), string(op), opField)
+	}
+	return result
+}
+
+// parseCSVKeys reads "imsi,k,<opField>" rows. A header row and blank lines are
+// skipped.
+func parseCSVKeys(r io.Reader, opField string) (map[string]simKeys, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+	result := make(map[string]simKeys)
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keys CSV: %v", err)
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("keys CSV line %d: expected imsi,k,%s", line, opField)
+		}
+		imsi := strings.TrimSpace(record[0])
+		if line == 1 && strings.EqualFold(imsi, "imsi") {
+			continue
+		}
+		result[imsi] = newSIMKeys(strings.TrimSpace(record[1]), strings.TrimSpace(record[2]), opField)
+	}
+}
+
+func newSIMKeys(k, op, opField string) simKeys {
+	if opField == "op" {
+		return simKeys{K: k, OP: op}
+	}
+	return simKeys{K: k, OPC: op}
+}
+
+// poolUser returns the Open5GSUser equivalent to one IMSI of the pool, so that
+// pool subscribers share the document layout of individually managed ones.
+func poolUser(pool *netv1.Open5GSUserPool, imsi string, keys simKeys) netv1.Open5GSUser {
+	spec := *pool.Spec.Template.DeepCopy()
+	spec.IMSI = imsi
+	spec.Key = keys.K
+	spec.OPC = keys.OPC
+	spec.OP = keys.OP
+	spec.UE = netv1.Open5GSUserUE{}
+	spec.KeysSecretRef = nil
+	spec.ProfileRef = nil
+	spec.Open5GS = pool.Spec.Open5GS
+	return netv1.Open5GSUser{ObjectMeta: pool.ObjectMeta, Spec: spec}
+}
+
+// syncPoolSubscribers creates or repairs the given subscribers and deletes the
+// stale IMSIs, in a single bulk write.
+func syncPoolSubscribers(ctx context.Context, store SubscriberStore, users []netv1.Open5GSUser, stale []string) (poolSyncResult, error) {
+	result := poolSyncResult{}
+
+	imsis := make([]string, 0, len(users))
+	for _, user := range users {
+		imsis = append(imsis, user.Spec.IMSI)
+	}
+	existing := make(map[string]bson.M, len(users))
+	if len(imsis) > 0 {
+		subscribers, err := store.List(ctx, imsis...)
+		if err != nil {
+			return result, err
+		}
+		for _, subscriber := range subscribers {
+			if imsi, ok := subscriber["imsi"].(string); ok {
+				existing[imsi] = subscriber
+			}
+		}
+	}
+
+	writes := []SubscriberWrite{}
+	for _, user := range users {
+		subscriber, found := existing[user.Spec.IMSI]
+		if !found {
+			document, err := newSubscriberDocument(user)
+			if err != nil {
+				return result, err
+			}
+			// The upsert creates the _id of the subscriber
+			delete(document, "_id")
+			writes = append(writes, SubscriberWrite{IMSI: user.Spec.IMSI, Set: document})
+			continue
+		}
+		repair, err := diffSubscriber(user, subscriber)
+		if err != nil {
+			return result, err
+		}
+		if !repair.Empty() {
+			writes = append(writes, SubscriberWrite{IMSI: user.Spec.IMSI, Set: repair.Set, Unset: repair.Unset})
+		}
+	}
+	for _, imsi := range stale {
+		writes = append(writes, SubscriberWrite{IMSI: imsi, Delete: true})
+	}
+
+	written, err := store.BulkWrite(ctx, writes...)
+	if err != nil {
+		return result, err
+	}
+	result.Created = int32(written.Upserted)
+	result.Updated = int32(written.Modified)
+	result.Deleted = int32(written.Deleted)
+	result.Provisioned = int32(len(users))
+	return result, nil
+}
@@ -0,0 +1,170 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestIMSIRange(t *testing.T) {
+	imsis, err := imsiRange("001010000000098", 3)
+	if err != nil {
+		t.Fatalf("imsiRange returned error: %v", err)
+	}
+	expected := []string{"001010000000098", "001010000000099", "001010000000100"}
+	if strings.Join(imsis, ",") != strings.Join(expected, ",") {
+		t.Errorf("imsiRange = %v, expected %v", imsis, expected)
+	}
+	if _, err := imsiRange("999999", 2); err == nil {
+		t.Error("expected an error for a range overflowing the IMSI length")
+	}
+}
+
+func TestParseCSVKeys(t *testing.T) {
+	csv := "imsi,k,opc\n" +
+		"999700000000100, 465B5CE8B199B49FAA5F0A2EE238A6BC, E8ED289DEBA952E4283B54E88E6183CA\n" +
+		"# comment\n" +
+		"\n" +
+		"999700000000101,00112233445566778899AABBCCDDEEFF,FFEEDDCCBBAA99887766554433221100\n"
+	keys, err := parseCSVKeys(strings.NewReader(csv), "opc")
+	if err != nil {
+		t.Fatalf("parseCSVKeys returned error: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 IMSIs, got %d", len(keys))
+	}
+	if got := keys["999700000000100"]; got.K != "465B5CE8B199B49FAA5F0A2EE238A6BC" || got.OPC != "E8ED289DEBA952E4283B54E88E6183CA" || got.OP != "" {
+		t.Errorf("unexpected keys %+v", got)
+	}
+
+	keys, err = parseCSVKeys(strings.NewReader("999700000000100,00,11\n"), "op")
+	if err != nil {
+		t.Fatalf("parseCSVKeys returned error: %v", err)
+	}
+	if got := keys["999700000000100"]; got.OP != "11" || got.OPC != "" {
+		t.Errorf("expected the third column to be used as OP, got %+v", got)
+	}
+
+	if _, err := parseCSVKeys(strings.NewReader("999700000000100,00\n"), "opc"); err == nil {
+		t.Error("expected an error for a row without OPc")
+	}
+}
+
+func TestParseSecretKeys(t *testing.T) {
+	keys := parseSecretKeys(map[string][]byte{
+		"999700000000100.k":   []byte("00"),
+		"999700000000100.opc": []byte("11"),
+		"999700000000101.k":   []byte("22"),
+	}, "opc")
+	if len(keys) != 1 {
+		t.Fatalf("expected IMSIs without OPc to be skipped, got %v", keys)
+	}
+	if got := keys["999700000000100"]; got.K != "00" || got.OPC != "11" {
+		t.Errorf("unexpected keys %+v", got)
+	}
+}
+
+// countingStore counts the calls made to a SubscriberStore
+type countingStore struct {
+	SubscriberStore
+	calls map[string]int
+}
+
+func (s *countingStore) List(ctx context.Context, imsis ...string) ([]bson.M, error) {
+	s.calls["List"]++
+	return s.SubscriberStore.List(ctx, imsis...)
+}
+
+func (s *countingStore) Insert(ctx context.Context, subscribers ...bson.M) error {
+	s.calls["Insert"]++
+	return s.SubscriberStore.Insert(ctx, subscribers...)
+}
+
+func (s *countingStore) Update(ctx context.Context, imsi string, set bson.M, unset []string) error {
+	s.calls["Update"]++
+	return s.SubscriberStore.Update(ctx, imsi, set, unset)
+}
+
+func (s *countingStore) Delete(ctx context.Context, imsis ...string) (int64, error) {
+	s.calls["Delete"]++
+	return s.SubscriberStore.Delete(ctx, imsis...)
+}
+
+func (s *countingStore) BulkWrite(ctx context.Context, writes ...SubscriberWrite) (SubscriberWriteResult, error) {
+	s.calls["BulkWrite"]++
+	return s.SubscriberStore.BulkWrite(ctx, writes...)
+}
+
+func TestSyncPoolSubscribers(t *testing.T) {
+	ctx := context.Background()
+	pool := &netv1.Open5GSUserPool{ObjectMeta: metav1.ObjectMeta{Name: "pool", Namespace: "default"}}
+	keys := simKeys{K: "465B5CE8B199B49FAA5F0A2EE238A6BC", OPC: "E8ED289DEBA952E4283B54E88E6183CA"}
+	users := []netv1.Open5GSUser{}
+	for _, imsi := range []string{"999700000000100", "999700000000101", "999700000000102"} {
+		users = append(users, poolUser(pool, imsi, keys))
+	}
+	memory := NewMemorySubscriberStore()
+	for _, user := range users[:2] {
+		document, err := newSubscriberDocument(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := memory.Insert(ctx, document); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := memory.Update(ctx, "999700000000101", bson.M{"security.opc": "00"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := memory.Insert(ctx, bson.M{"imsi": "999700000000200"}); err != nil {
+		t.Fatal(err)
+	}
+	store := &countingStore{SubscriberStore: memory, calls: map[string]int{}}
+
+	result, err := syncPoolSubscribers(ctx, store, users, []string{"999700000000200"})
+	if err != nil {
+		t.Fatalf("syncPoolSubscribers returned error: %v", err)
+	}
+	if result != (poolSyncResult{Provisioned: 3, Created: 1, Updated: 1, Deleted: 1}) {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if store.calls["BulkWrite"] != 1 || store.calls["List"] != 1 || len(store.calls) != 2 {
+		t.Errorf("expected a single list and a single bulk write, got %v", store.calls)
+	}
+	for _, user := range users {
+		subscriber, err := memory.Get(ctx, user.Spec.IMSI)
+		if err != nil {
+			t.Fatalf("expected subscriber %s, got %v", user.Spec.IMSI, err)
+		}
+		repair, err := diffSubscriber(user, subscriber)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !repair.Empty() {
+			t.Errorf("expected subscriber %s to be in sync, got %v", user.Spec.IMSI, repair.Paths)
+		}
+	}
+	if _, err := memory.Get(ctx, "999700000000200"); err != ErrSubscriberNotFound {
+		t.Errorf("expected the stale subscriber to be deleted, got %v", err)
+	}
+
+	store.calls = map[string]int{}
+	result, err = syncPoolSubscribers(ctx, store, users, nil)
+	if err != nil {
+		t.Fatalf("syncPoolSubscribers returned error: %v", err)
+	}
+	if result.Created != 0 || result.Updated != 0 || store.calls["BulkWrite"] != 1 {
+		t.Errorf("expected nothing to be written once in sync, got %+v and %v", result, store.calls)
+	}
+}
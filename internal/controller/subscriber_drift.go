@@ -0,0 +1,165 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"strconv"
+	"strings"
+
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// retainedField marks a subscriber left in MongoDB by the Retain or Orphan
+// deletion policy of its Open5GSUser. The subscriber scan never prunes it, and
+// it is removed as soon as an Open5GSUser or Open5GSUserPool manages the IMSI
+// again.
+const retainedField = "operator_retained"
+
+// managedSubscriberPaths are the fields of the subscriber document owned by
+// the operator. Any other field, such as the SQN or the identifiers added by
+// the WebUI, is left as stored.
+var managedSubscriberPaths = []string{
+	retainedField,
+	"security.k",
+	"security.op",
+	"security.opc",
+	"security.amf",
+	"ambr",
+	"msisdn",
+	"imeisv",
+	"subscriber_status",
+	"operator_determined_barring",
+	"network_access_mode",
+	"access_restriction_data",
+	"slice.0.sst",
+	"slice.0.sd",
+	"slice.0.default_indicator",
+	"slice.0.session.0.name",
+	"slice.0.session.0.type",
+	"slice.0.session.0.qos",
+	"slice.0.session.0.ambr",
+	"slice.0.session.0.ue",
+}
+
+// subscriberRepair holds the fields of a stored subscriber that differ from
+// the spec and the update that brings them back in line
+type subscriberRepair struct {
+	// Paths are the dotted paths of the drifted fields
+	Paths []string
+	Set   bson.M
+	Unset []string
+}
+
+func (r subscriberRepair) Empty() bool {
+	return len(r.Paths) == 0
+}
+
+// diffSubscriber compares every managed field of the stored subscriber with
+// the document built from the spec. A field whose parent is missing or has an
+// unexpected type is repaired by rewriting the closest valid parent, e.g. the
+// whole "slice" array when it is not an array.
+func diffSubscriber(user netv1.Open5GSUser, stored bson.M) (subscriberRepair, error) {
+	repair := subscriberRepair{Set: bson.M{}}
+
+	document, err := newSubscriberDocument(user)
+	if err != nil {
+		return repair, err
+	}
+	// Go through BSON so that the desired values have the decoded types
+	desired, err := copyDocument(document)
+	if err != nil {
+		return repair, err
+	}
+
+	for _, path := range managedSubscriberPaths {
+		if coveredByRepair(repair.Paths, path) {
+			continue
+		}
+		target, storedValue, storedFound := storedPath(stored, strings.Split(path, "."))
+		desiredValue, desiredFound := lookupPath(desired, strings.Split(target, "."))
+		switch {
+		case target != path || (desiredFound && !storedFound):
+			repair.Paths = append(repair.Paths, target)
+			if desiredFound {
+				repair.Set[target] = desiredValue
+			} else {
+				repair.Unset = append(repair.Unset, target)
+			}
+		case !desiredFound && storedFound:
+			repair.Paths = append(repair.Paths, target)
+			repair.Unset = append(repair.Unset, target)
+		case desiredFound && !bsonValuesEqual(desiredValue, storedValue):
+			repair.Paths = append(repair.Paths, target)
+			repair.Set[target] = desiredValue
+		}
+	}
+	return repair, nil
+}
+
+// storedPath walks a stored document along path. It returns the path itself
+// and the value found there, or, when the walk cannot reach the parent of the
+// last segment, the path of the first missing or mistyped parent.
+func storedPath(stored bson.M, segments []string) (string, interface{}, bool) {
+	var current interface{} = stored
+	for i, segment := range segments {
+		switch node := current.(type) {
+		case bson.M:
+			child, ok := node[segment]
+			if !ok {
+				if i == len(segments)-1 {
+					return strings.Join(segments, "."), nil, false
+				}
+				return strings.Join(segments[:i+1], "."), nil, false
+			}
+			current = child
+		case bson.A:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return strings.Join(segments[:i], "."), nil, false
+			}
+			current = node[index]
+		default:
+			return strings.Join(segments[:i], "."), nil, false
+		}
+	}
+	return strings.Join(segments, "."), current, true
+}
+
+// lookupPath returns the value at a dotted path of a document
+func lookupPath(document bson.M, segments []string) (interface{}, bool) {
+	var current interface{} = document
+	for _, segment := range segments {
+		switch node := current.(type) {
+		case bson.M:
+			child, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			current = child
+		case bson.A:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			current = node[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func coveredByRepair(repaired []string, path string) bool {
+	for _, prefix := range repaired {
+		if path == prefix || strings.HasPrefix(path, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
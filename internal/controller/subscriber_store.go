@@ -0,0 +1,248 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// mongoOperationTimeout bounds the MongoDB operations on a single subscriber
+	mongoOperationTimeout = 10 * time.Second
+	// mongoBulkTimeout bounds the MongoDB operations on several subscribers,
+	// such as the ones issued for an Open5GSUserPool
+	mongoBulkTimeout = 60 * time.Second
+)
+
+// ErrSubscriberNotFound is returned by a SubscriberStore when no subscriber
+// has the requested IMSI
+var ErrSubscriberNotFound = errors.New("subscriber not found")
+
+// SubscriberStore persists the Open5GS subscriber documents, keyed by IMSI.
+// Documents are returned as the MongoDB driver decodes them: nested documents
+// are bson.M, arrays are bson.A and integers are int32 or int64.
+type SubscriberStore interface {
+	// Get returns the subscriber with the given IMSI
+	Get(ctx context.Context, imsi string) (bson.M, error)
+	// List returns the subscribers with the given IMSIs, or every subscriber
+	// when no IMSI is given
+	List(ctx context.Context, imsis ...string) ([]bson.M, error)
+	// Insert adds new subscribers
+	Insert(ctx context.Context, subscribers ...bson.M) error
+	// Update sets and removes fields, given as dotted paths, of an existing
+	// subscriber
+	Update(ctx context.Context, imsi string, set bson.M, unset []string) error
+	// Delete removes the subscribers with the given IMSIs and returns how many
+	// were removed
+	Delete(ctx context.Context, imsis ...string) (int64, error)
+	// BulkWrite applies upserts and deletions in a single unordered batch
+	BulkWrite(ctx context.Context, writes ...SubscriberWrite) (SubscriberWriteResult, error)
+}
+
+// SubscriberWrite is one operation of a bulk write. It deletes the subscriber
+// with the IMSI when Delete is set; otherwise it sets and removes fields, given
+// as dotted paths, of the subscriber, which is created if it does not exist.
+type SubscriberWrite struct {
+	IMSI   string
+	Set    bson.M
+	Unset  []string
+	Delete bool
+}
+
+// SubscriberWriteResult counts the subscribers changed by a bulk write
+type SubscriberWriteResult struct {
+	Upserted int64
+	Modified int64
+	Deleted  int64
+}
+
+// SubscriberStores returns the SubscriberStore of an Open5GS instance
+type SubscriberStores interface {
+	Store(ctx context.Context, open5gs client.ObjectKey) (SubscriberStore, error)
+}
+
+// MongoSubscriberStores resolves the MongoDB of each Open5GS instance from
+// the ClusterIP of its "<name>-mongodb" Service and keeps one pooled client
+// per instance in Clients.
+type MongoSubscriberStores struct {
+	Client  client.Reader
+	Clients *MongoClients
+}
+
+func (s *MongoSubscriberStores) Store(ctx context.Context, open5gs client.ObjectKey) (SubscriberStore, error) {
+	var service corev1.Service
+	serviceName := fmt.Sprintf("%s-mongodb", strings.ToLower(open5gs.Name))
+	if err := s.Client.Get(ctx, client.ObjectKey{Name: serviceName, Namespace: open5gs.Namespace}, &service); err != nil {
+		if apierrors.IsNotFound(err) {
+			s.Clients.Forget(open5gs)
+		}
+		return nil, err
+	}
+
+	uri := fmt.Sprintf("mongodb://%s:27017", service.Spec.ClusterIP)
+	conn, err := connectMongo(ctx, s.Clients, open5gs, uri)
+	if err != nil {
+		return nil, err
+	}
+	return &mongoSubscriberStore{collection: conn.Database("open5gs").Collection("subscribers")}, nil
+}
+
+// mongoSubscriberStore is the SubscriberStore backed by the subscribers
+// collection of the Open5GS database. The duration and the failures of its
+// operations are recorded in the MongoDB metrics.
+type mongoSubscriberStore struct {
+	collection *mongo.Collection
+}
+
+func (s *mongoSubscriberStore) Get(ctx context.Context, imsi string) (_ bson.M, err error) {
+	defer mongoOperation("get")(&err)
+	ctx, cancel := context.WithTimeout(ctx, mongoOperationTimeout)
+	defer cancel()
+
+	var subscriber bson.M
+	err = s.collection.FindOne(ctx, bson.M{"imsi": imsi}).Decode(&subscriber)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrSubscriberNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find subscriber: %v", err)
+	}
+	return subscriber, nil
+}
+
+func (s *mongoSubscriberStore) List(ctx context.Context, imsis ...string) (_ []bson.M, err error) {
+	defer mongoOperation("list")(&err)
+	ctx, cancel := context.WithTimeout(ctx, mongoBulkTimeout)
+	defer cancel()
+
+	filter := bson.M{}
+	if len(imsis) > 0 {
+		filter = bson.M{"imsi": bson.M{"$in": imsis}}
+	}
+	cursor, err := s.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find subscribers: %v", err)
+	}
+	subscribers := []bson.M{}
+	if err := cursor.All(ctx, &subscribers); err != nil {
+		return nil, fmt.Errorf("failed to decode subscribers: %v", err)
+	}
+	return subscribers, nil
+}
+
+func (s *mongoSubscriberStore) Insert(ctx context.Context, subscribers ...bson.M) (err error) {
+	if len(subscribers) == 0 {
+		return nil
+	}
+	defer mongoOperation("insert")(&err)
+	ctx, cancel := context.WithTimeout(ctx, mongoBulkTimeout)
+	defer cancel()
+
+	documents := make([]interface{}, 0, len(subscribers))
+	for _, subscriber := range subscribers {
+		documents = append(documents, subscriber)
+	}
+	if _, err := s.collection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false)); err != nil {
+		return fmt.Errorf("failed to insert subscriber: %v", err)
+	}
+	return nil
+}
+
+func (s *mongoSubscriberStore) Update(ctx context.Context, imsi string, set bson.M, unset []string) (err error) {
+	defer mongoOperation("update")(&err)
+	ctx, cancel := context.WithTimeout(ctx, mongoOperationTimeout)
+	defer cancel()
+
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		fields := bson.M{}
+		for _, field := range unset {
+			fields[field] = ""
+		}
+		update["$unset"] = fields
+	}
+	result, err := s.collection.UpdateOne(ctx, bson.M{"imsi": imsi}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update subscriber: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrSubscriberNotFound
+	}
+	return nil
+}
+
+func (s *mongoSubscriberStore) Delete(ctx context.Context, imsis ...string) (_ int64, err error) {
+	if len(imsis) == 0 {
+		return 0, nil
+	}
+	defer mongoOperation("delete")(&err)
+	ctx, cancel := context.WithTimeout(ctx, mongoBulkTimeout)
+	defer cancel()
+
+	result, err := s.collection.DeleteMany(ctx, bson.M{"imsi": bson.M{"$in": imsis}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete subscribers: %v", err)
+	}
+	return result.DeletedCount, nil
+}
+
+func (s *mongoSubscriberStore) BulkWrite(ctx context.Context, writes ...SubscriberWrite) (_ SubscriberWriteResult, err error) {
+	if len(writes) == 0 {
+		return SubscriberWriteResult{}, nil
+	}
+	defer mongoOperation("bulk_write")(&err)
+	ctx, cancel := context.WithTimeout(ctx, mongoBulkTimeout)
+	defer cancel()
+
+	models := make([]mongo.WriteModel, 0, len(writes))
+	for _, write := range writes {
+		filter := bson.M{"imsi": write.IMSI}
+		if write.Delete {
+			models = append(models, mongo.NewDeleteManyModel().SetFilter(filter))
+			continue
+		}
+		update := bson.M{}
+		if len(write.Set) > 0 {
+			update["$set"] = write.Set
+		}
+		if len(write.Unset) > 0 {
+			fields := bson.M{}
+			for _, field := range write.Unset {
+				fields[field] = ""
+			}
+			update["$unset"] = fields
+		}
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(true))
+	}
+	result, err := s.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return SubscriberWriteResult{}, fmt.Errorf("failed to write subscribers: %v", err)
+	}
+	return SubscriberWriteResult{Upserted: result.UpsertedCount, Modified: result.ModifiedCount, Deleted: result.DeletedCount}, nil
+}
+
+// connectMongo returns the client of the MongoDB of the instance, recording
+// the connection in the MongoDB metrics
+func connectMongo(ctx context.Context, clients *MongoClients, open5gs client.ObjectKey, uri string) (_ *mongo.Client, err error) {
+	defer mongoOperation("connect")(&err)
+	return clients.Get(ctx, open5gs, uri)
+}
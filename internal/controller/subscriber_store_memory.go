@@ -0,0 +1,267 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// MemorySubscriberStores keeps an in-memory SubscriberStore per Open5GS
+// instance. It is meant for tests.
+type MemorySubscriberStores struct {
+	mu     sync.Mutex
+	stores map[client.ObjectKey]*MemorySubscriberStore
+}
+
+func NewMemorySubscriberStores() *MemorySubscriberStores {
+	return &MemorySubscriberStores{stores: make(map[client.ObjectKey]*MemorySubscriberStore)}
+}
+
+func (s *MemorySubscriberStores) Store(_ context.Context, open5gs client.ObjectKey) (SubscriberStore, error) {
+	return s.For(open5gs), nil
+}
+
+// For returns the store of the given Open5GS instance, creating it if needed
+func (s *MemorySubscriberStores) For(open5gs client.ObjectKey) *MemorySubscriberStore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	store, ok := s.stores[open5gs]
+	if !ok {
+		store = NewMemorySubscriberStore()
+		s.stores[open5gs] = store
+	}
+	return store
+}
+
+// MemorySubscriberStore is a SubscriberStore that keeps the subscribers in
+// memory. Documents go through a BSON round trip so that they have the same
+// types as the ones decoded from MongoDB.
+type MemorySubscriberStore struct {
+	mu          sync.Mutex
+	subscribers map[string]bson.M
+}
+
+func NewMemorySubscriberStore() *MemorySubscriberStore {
+	return &MemorySubscriberStore{subscribers: make(map[string]bson.M)}
+}
+
+func (s *MemorySubscriberStore) Get(_ context.Context, imsi string) (bson.M, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subscriber, ok := s.subscribers[imsi]
+	if !ok {
+		return nil, ErrSubscriberNotFound
+	}
+	return copyDocument(subscriber)
+}
+
+func (s *MemorySubscriberStore) List(_ context.Context, imsis ...string) ([]bson.M, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(imsis) == 0 {
+		for imsi := range s.subscribers {
+			imsis = append(imsis, imsi)
+		}
+		sort.Strings(imsis)
+	}
+	subscribers := []bson.M{}
+	for _, imsi := range imsis {
+		subscriber, ok := s.subscribers[imsi]
+		if !ok {
+			continue
+		}
+		document, err := copyDocument(subscriber)
+		if err != nil {
+			return nil, err
+		}
+		subscribers = append(subscribers, document)
+	}
+	return subscribers, nil
+}
+
+func (s *MemorySubscriberStore) Insert(_ context.Context, subscribers ...bson.M) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, subscriber := range subscribers {
+		imsi, ok := subscriber["imsi"].(string)
+		if !ok {
+			return fmt.Errorf("failed to insert subscriber: missing IMSI")
+		}
+		if _, exists := s.subscribers[imsi]; exists {
+			return fmt.Errorf("failed to insert subscriber: IMSI %s already exists", imsi)
+		}
+		document, err := copyDocument(subscriber)
+		if err != nil {
+			return err
+		}
+		s.subscribers[imsi] = document
+	}
+	return nil
+}
+
+func (s *MemorySubscriberStore) Update(_ context.Context, imsi string, set bson.M, unset []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subscriber, ok := s.subscribers[imsi]
+	if !ok {
+		return ErrSubscriberNotFound
+	}
+	document, err := copyDocument(subscriber)
+	if err != nil {
+		return err
+	}
+	for path, value := range set {
+		normalized, err := copyDocument(bson.M{"v": value})
+		if err != nil {
+			return err
+		}
+		if err := setPath(document, strings.Split(path, "."), normalized["v"]); err != nil {
+			return fmt.Errorf("failed to update subscriber: %v", err)
+		}
+	}
+	for _, path := range unset {
+		unsetPath(document, strings.Split(path, "."))
+	}
+	s.subscribers[imsi] = document
+	return nil
+}
+
+func (s *MemorySubscriberStore) Delete(_ context.Context, imsis ...string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for _, imsi := range imsis {
+		if _, ok := s.subscribers[imsi]; ok {
+			delete(s.subscribers, imsi)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *MemorySubscriberStore) BulkWrite(_ context.Context, writes ...SubscriberWrite) (SubscriberWriteResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := SubscriberWriteResult{}
+	for _, write := range writes {
+		subscriber, ok := s.subscribers[write.IMSI]
+		if write.Delete {
+			if ok {
+				delete(s.subscribers, write.IMSI)
+				result.Deleted++
+			}
+			continue
+		}
+		if !ok {
+			subscriber = bson.M{"imsi": write.IMSI}
+		}
+		document, err := copyDocument(subscriber)
+		if err != nil {
+			return result, err
+		}
+		for path, value := range write.Set {
+			normalized, err := copyDocument(bson.M{"v": value})
+			if err != nil {
+				return result, err
+			}
+			if err := setPath(document, strings.Split(path, "."), normalized["v"]); err != nil {
+				return result, fmt.Errorf("failed to write subscriber: %v", err)
+			}
+		}
+		for _, path := range write.Unset {
+			unsetPath(document, strings.Split(path, "."))
+		}
+		s.subscribers[write.IMSI] = document
+		if ok {
+			result.Modified++
+		} else {
+			result.Upserted++
+		}
+	}
+	return result, nil
+}
+
+// copyDocument returns a deep copy of the document with the types the MongoDB
+// driver decodes into
+func copyDocument(document bson.M) (bson.M, error) {
+	data, err := bson.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	result := bson.M{}
+	if err := bson.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// setPath sets the value at a dotted path, creating the missing documents on
+// the way like MongoDB's $set does
+func setPath(container interface{}, path []string, value interface{}) error {
+	switch node := container.(type) {
+	case bson.M:
+		if len(path) == 1 {
+			node[path[0]] = value
+			return nil
+		}
+		child, ok := node[path[0]]
+		if !ok || child == nil {
+			child = bson.M{}
+			node[path[0]] = child
+		}
+		return setPath(child, path[1:], value)
+	case bson.A:
+		index, err := strconv.Atoi(path[0])
+		if err != nil || index < 0 || index >= len(node) {
+			return fmt.Errorf("invalid array index %q", path[0])
+		}
+		if len(path) == 1 {
+			node[index] = value
+			return nil
+		}
+		return setPath(node[index], path[1:], value)
+	}
+	return fmt.Errorf("cannot set field %q of a %T", path[0], container)
+}
+
+// unsetPath removes the value at a dotted path, if present
+func unsetPath(container interface{}, path []string) {
+	switch node := container.(type) {
+	case bson.M:
+		if len(path) == 1 {
+			delete(node, path[0])
+			return
+		}
+		unsetPath(node[path[0]], path[1:])
+	case bson.A:
+		index, err := strconv.Atoi(path[0])
+		if err != nil || index < 0 || index >= len(node) {
+			return
+		}
+		if len(path) == 1 {
+			node[index] = nil
+			return
+		}
+		unsetPath(node[index], path[1:])
+	}
+}
@@ -0,0 +1,98 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// open5gsRefIndex indexes Open5GSUsers and Open5GSUserPools by the
+	// "<namespace>/<name>" of the Open5GS instance they reference
+	open5gsRefIndex = ".spec.open5gs.ref"
+	// resyncJitter is the maximum fraction added to the resync period so that
+	// the periodic drift checks of many users do not run at the same time
+	resyncJitter = 0.2
+)
+
+// resyncResult requeues the object after the jittered resync period, or not
+// at all when the period is zero
+func resyncResult(period time.Duration) ctrl.Result {
+	if period <= 0 {
+		return ctrl.Result{}
+	}
+	return ctrl.Result{RequeueAfter: wait.Jitter(period, resyncJitter)}
+}
+
+// mongoServiceOpen5GS returns the key of the Open5GS instance that owns the
+// given MongoDB Service name
+func mongoServiceOpen5GS(serviceName, namespace string) (client.ObjectKey, bool) {
+	name, ok := strings.CutSuffix(serviceName, "-mongodb")
+	if !ok || name == "" {
+		return client.ObjectKey{}, false
+	}
+	return client.ObjectKey{Name: name, Namespace: namespace}, true
+}
+
+// open5gsOf maps an Open5GS instance, its MongoDB Service or the
+// EndpointSlices of that Service to the key of the Open5GS instance
+func open5gsOf(obj client.Object) (client.ObjectKey, bool) {
+	switch o := obj.(type) {
+	case *netv1.Open5GS:
+		return client.ObjectKeyFromObject(o), true
+	case *corev1.Service:
+		return mongoServiceOpen5GS(o.Name, o.Namespace)
+	case *discoveryv1.EndpointSlice:
+		return mongoServiceOpen5GS(o.Labels[discoveryv1.LabelServiceName], o.Namespace)
+	}
+	return client.ObjectKey{}, false
+}
+
+// referencingRequests returns a map function that enqueues the objects of
+// list that reference the Open5GS instance related to the watched object
+func referencingRequests(c client.Client, newList func() client.ObjectList) func(context.Context, client.Object) []reconcile.Request {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		key, ok := open5gsOf(obj)
+		if !ok {
+			return nil
+		}
+		list := newList()
+		if err := c.List(ctx, list, client.MatchingFields{open5gsRefIndex: key.String()}); err != nil {
+			return nil
+		}
+		var requests []reconcile.Request
+		switch l := list.(type) {
+		case *netv1.Open5GSUserList:
+			for _, item := range l.Items {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&item)})
+			}
+		case *netv1.Open5GSUserPoolList:
+			for _, item := range l.Items {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&item)})
+			}
+		}
+		return requests
+	}
+}
+
+// mongoServicePredicate keeps the events of the MongoDB Services of Open5GS
+// instances and of their EndpointSlices
+var mongoServicePredicate = predicate.NewPredicateFuncs(func(obj client.Object) bool {
+	_, ok := open5gsOf(obj)
+	return ok
+})
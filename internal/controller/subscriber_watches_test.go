@@ -0,0 +1,73 @@
+/*
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	netv1 "github.com/gradiant/open5gs-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReferencingRequests(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = netv1.AddToScheme(scheme)
+
+	user := func(name, namespace, open5gsNamespace string) *netv1.Open5GSUser {
+		return &netv1.Open5GSUser{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       netv1.Open5GSUserSpec{Open5GS: netv1.Open5GSReference{Name: "core", Namespace: open5gsNamespace}},
+		}
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(user("a", "platform", ""), user("b", "team", "platform"), user("c", "team", "team")).
+		WithIndex(&netv1.Open5GSUser{}, open5gsRefIndex, func(obj client.Object) []string {
+			return []string{open5gsKey(obj.(*netv1.Open5GSUser)).String()}
+		}).
+		Build()
+	mapFunc := referencingRequests(c, func() client.ObjectList { return &netv1.Open5GSUserList{} })
+
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "core-mongodb", Namespace: "platform"}}
+	if requests := mapFunc(context.Background(), service); len(requests) != 2 {
+		t.Errorf("expected the users of platform/core to be enqueued, got %v", requests)
+	}
+
+	slice := &discoveryv1.EndpointSlice{ObjectMeta: metav1.ObjectMeta{
+		Name:      "core-mongodb-x1",
+		Namespace: "team",
+		Labels:    map[string]string{discoveryv1.LabelServiceName: "core-mongodb"},
+	}}
+	if requests := mapFunc(context.Background(), slice); len(requests) != 1 || requests[0].Name != "c" {
+		t.Errorf("expected the users of team/core to be enqueued, got %v", requests)
+	}
+
+	other := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "core-amf", Namespace: "platform"}}
+	if requests := mapFunc(context.Background(), other); len(requests) != 0 {
+		t.Errorf("expected no user to be enqueued for a non-MongoDB Service, got %v", requests)
+	}
+}
+
+func TestResyncResult(t *testing.T) {
+	if result := resyncResult(0); result.RequeueAfter != 0 {
+		t.Errorf("expected no requeue when the resync is disabled, got %v", result.RequeueAfter)
+	}
+	for i := 0; i < 10; i++ {
+		after := resyncResult(time.Minute).RequeueAfter
+		if after < time.Minute || after > time.Minute+time.Minute/5 {
+			t.Errorf("resync %v is out of the jitter range", after)
+		}
+	}
+}